@@ -1,25 +1,103 @@
 package cmd
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/urfave/cli/v2"
 	"golang.org/x/oauth2"
 
+	"github.com/Coderlane/minecraft-sidecart/daemon"
 	"github.com/Coderlane/minecraft-sidecart/firebase"
 )
 
+// oauthConfig returns the OAuth config for provider. A config in the app's
+// "oauth" metadata overrides the built in configs.
+func oauthConfig(c *cli.Context, provider firebase.AuthProvider) *oauth2.Config {
+	if cfg, ok := c.App.Metadata["oauth"].(*oauth2.Config); ok {
+		return cfg
+	}
+	return firebase.NewOAuthConfig(provider)
+}
+
+// NewAuthFunc creates the authentication client. It is stored in the app's
+// "new_auth" metadata and only called by commands which need credentials, so
+// the others work without a user cache.
+type NewAuthFunc func() (*firebase.Auth, error)
+
+// getAuth returns the authentication client from the app's "auth" metadata,
+// creating it with the "new_auth" metadata on first use.
+func getAuth(c *cli.Context) (*firebase.Auth, error) {
+	if auth, ok := c.App.Metadata["auth"].(*firebase.Auth); ok {
+		return auth, nil
+	}
+	newAuth, ok := c.App.Metadata["new_auth"].(NewAuthFunc)
+	if !ok {
+		return nil, fmt.Errorf("no authentication client is configured")
+	}
+	auth, err := newAuth()
+	if err != nil {
+		return nil, err
+	}
+	c.App.Metadata["auth"] = auth
+	return auth, nil
+}
+
+// openBrowser opens the authentication URL for the loopback sign in flow.
+var openBrowser = firebase.OpenBrowser
+
 var authSignInCommand = &cli.Command{
 	Name:    "signin",
 	Aliases: []string{"login"},
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "profile",
+			Usage: "The profile to sign in to, defaults to the current profile",
+		},
+		&cli.StringFlag{
+			Name:  "provider",
+			Usage: "The identity provider to sign in with: google, github, or microsoft",
+			Value: firebase.GoogleAuthProvider.String(),
+		},
+		&cli.BoolFlag{
+			Name:  "console",
+			Usage: "Paste the redirect URL instead of using a browser redirect",
+		},
+		&cli.BoolFlag{
+			Name:  "device",
+			Usage: "Enter a code from another device, for machines without a browser",
+		},
+		&cli.StringFlag{
+			Name:  "email",
+			Usage: "Sign in to an email and password account",
+		},
+		&cli.StringFlag{
+			Name:  "password-file",
+			Usage: "Read the password for --email from a file instead of prompting",
+		},
+		&cli.StringFlag{
+			Name:  "custom-token-file",
+			Usage: "Sign in with a custom token read from a file",
+		},
+	},
 	Action: func(c *cli.Context) error {
-		auth := c.App.Metadata["auth"].(*firebase.Auth)
-		cfg := c.App.Metadata["oauth"].(*oauth2.Config)
-
-		user, _, err := auth.SignInWithConsoleWithIO(
-			c.Context, cfg, c.App.Reader, c.App.Writer)
+		auth, err := getAuth(c)
+		if err != nil {
+			return err
+		}
+		if c.IsSet("profile") {
+			if err := validateProfile(c.String("profile")); err != nil {
+				return err
+			}
+			auth = auth.ForProfile(c.String("profile"))
+		}
+		user, err := signIn(c, auth)
 		if err != nil {
-
 			return err
 		}
 		fmt.Fprintln(c.App.Writer, "Authenticated!")
@@ -32,23 +110,244 @@ var authSignInCommand = &cli.Command{
 			daemonWarning(c.App.Writer, "minecraft-sidecart")
 			return nil
 		}
+		defer client.Close()
 
+		spec := daemon.SignInSpec{
+			Profile: auth.Profile(),
+			User:    user,
+		}
 		var token oauth2.Token
-		return client.Call("Daemon.SignIn", user, &token)
+		return client.Call("Daemon.SignIn", spec, &token)
 	},
 }
 
+// signIn signs in with the method selected by the flags.
+func signIn(c *cli.Context, auth *firebase.Auth) (*firebase.User, error) {
+	methods := 0
+	for _, flag := range []string{
+		"console", "device", "email", "custom-token-file"} {
+		if c.IsSet(flag) {
+			methods++
+		}
+	}
+	if methods > 1 {
+		return nil, fmt.Errorf(
+			"choose one of --console, --device, --email, or --custom-token-file")
+	}
+
+	var user *firebase.User
+	var err error
+	switch {
+	case c.IsSet("email"):
+		var password string
+		password, err = readPassword(c)
+		if err != nil {
+			return nil, err
+		}
+		user, _, err = auth.SignInWithEmailPassword(
+			c.Context, c.String("email"), password)
+		return user, err
+	case c.IsSet("custom-token-file"):
+		var data []byte
+		data, err = ioutil.ReadFile(c.String("custom-token-file"))
+		if err != nil {
+			return nil, err
+		}
+		user, _, err = auth.SignInWithCustomToken(
+			c.Context, strings.TrimSpace(string(data)))
+		return user, err
+	}
+
+	provider, err := firebase.ParseAuthProvider(c.String("provider"))
+	if err != nil {
+		return nil, err
+	}
+	auth.SetProvider(provider)
+	cfg := oauthConfig(c, provider)
+	switch {
+	case c.Bool("console"):
+		user, _, err = auth.SignInWithConsoleWithIO(
+			c.Context, cfg, c.App.Reader, c.App.Writer)
+	case c.Bool("device"):
+		deviceAuthURL, _ := c.App.Metadata["device_auth_url"].(string)
+		if deviceAuthURL == "" {
+			deviceAuthURL = provider.DeviceAuthURL()
+		}
+		user, _, err = auth.SignInWithDeviceWithIO(
+			c.Context, cfg, deviceAuthURL, c.App.Writer)
+	default:
+		user, _, err = auth.SignInWithLoopbackWithIO(
+			c.Context, cfg, c.App.Writer, openBrowser)
+	}
+	return user, err
+}
+
+// readPassword reads the password from --password-file or, if it is not set,
+// prompts for it. The prompt does not hide the password, prefer a file for
+// anything other than interactive use.
+func readPassword(c *cli.Context) (string, error) {
+	if c.IsSet("password-file") {
+		data, err := ioutil.ReadFile(c.String("password-file"))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	fmt.Fprintf(c.App.Writer, "Password: ")
+	password, err := bufio.NewReader(c.App.Reader).ReadString('\n')
+	if err != nil && (err != io.EOF || password == "") {
+		return "", err
+	}
+	return strings.TrimRight(password, "\r\n"), nil
+}
+
 var authSignOutCommand = &cli.Command{
 	Name:    "signout",
 	Aliases: []string{"logout"},
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "profile",
+			Usage: "The profile to sign out of, defaults to the current profile",
+		},
+		&cli.BoolFlag{
+			Name:  "revoke",
+			Usage: "Revoke the refresh token so that copies of it stop working",
+		},
+	},
 	Action: func(c *cli.Context) error {
-		auth := c.App.Metadata["auth"].(*firebase.Auth)
+		auth, err := getAuth(c)
+		if err != nil {
+			return err
+		}
+		if c.IsSet("profile") {
+			if err := validateProfile(c.String("profile")); err != nil {
+				return err
+			}
+			auth = auth.ForProfile(c.String("profile"))
+		}
+		if c.Bool("revoke") {
+			if err := auth.Revoke(c.Context); err != nil {
+				return err
+			}
+		}
 		auth.SignOut()
+		fmt.Fprintf(c.App.Writer, "Signed out of profile %s\n", auth.Profile())
+
+		client, err := NewClient()
+		if err != nil {
+			// The daemon will not find the user the next time it starts.
+			return nil
+		}
+		defer client.Close()
+		var ids []string
+		err = client.Call("Daemon.SignOut",
+			daemon.SignOutSpec{Profile: auth.Profile()}, &ids)
+		if err != nil {
+			return err
+		}
+		if len(ids) > 0 {
+			fmt.Fprintf(c.App.Writer, "Stopped uploading servers: %s\n",
+				strings.Join(ids, ", "))
+		}
+		return nil
+	},
+}
+
+var authStatusCommand = &cli.Command{
+	Name:    "status",
+	Aliases: []string{"whoami"},
+	Usage:   "Check the cached user and the user the daemon is running as",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "profile",
+			Usage: "The profile to check, defaults to the current profile",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		auth, err := getAuth(c)
+		if err != nil {
+			return err
+		}
+		if c.IsSet("profile") {
+			if err := validateProfile(c.String("profile")); err != nil {
+				return err
+			}
+			auth = auth.ForProfile(c.String("profile"))
+		}
+		status := auth.CheckStatus(c.Context)
+		tw := tabwriter.NewWriter(c.App.Writer, 0, 8, 2, ' ', 0)
+		writeAuthStatus(tw, status)
+
+		client, err := NewClient()
+		if err != nil {
+			fmt.Fprintln(tw, "Daemon:\tnot running")
+		} else {
+			defer client.Close()
+			var daemonStatus firebase.AuthStatus
+			err = client.Call("Daemon.WhoAmI",
+				daemon.WhoAmISpec{Profile: auth.Profile()}, &daemonStatus)
+			if err != nil {
+				return err
+			}
+			daemonUser := describeUser(daemonStatus.User)
+			if daemonStatus.ReauthRequired {
+				daemonUser += ", must sign in again"
+			}
+			fmt.Fprintf(tw, "Daemon:\t%s\n", daemonUser)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+
+		switch {
+		case status.User == nil:
+			return fmt.Errorf("profile %s is not signed in", status.Profile)
+		case status.Error != "":
+			return fmt.Errorf("failed to refresh the token, sign in again: %s",
+				status.Error)
+		}
 		return nil
 	},
 }
 
+func writeAuthStatus(writer io.Writer, status firebase.AuthStatus) {
+	fmt.Fprintf(writer, "Profile:\t%s\n", status.Profile)
+	if status.User == nil {
+		fmt.Fprintln(writer, "User:\tsigned out")
+		return
+	}
+	provider := status.User.ProviderID
+	if provider == "" {
+		provider = "unknown"
+	}
+	fmt.Fprintf(writer, "User ID:\t%s\n", status.User.UserID)
+	fmt.Fprintf(writer, "Email:\t%s\n", status.User.Email)
+	fmt.Fprintf(writer, "Email verified:\t%t\n", status.User.EmailVerified)
+	fmt.Fprintf(writer, "Provider:\t%s\n", provider)
+	if status.Error != "" {
+		fmt.Fprintf(writer, "Token:\tinvalid: %s\n", status.Error)
+	} else {
+		fmt.Fprintf(writer, "Token expiry:\t%s\n",
+			status.Expiry.Format(time.RFC3339))
+	}
+}
+
+// describeUser returns a short description of the user for the daemon
+// status.
+func describeUser(user *firebase.User) string {
+	switch {
+	case user == nil:
+		return "signed out"
+	case user.Email != "":
+		return fmt.Sprintf("%s (%s)", user.UserID, user.Email)
+	}
+	return user.UserID
+}
+
 var authCommand = &cli.Command{
-	Name:        "auth",
-	Subcommands: []*cli.Command{authSignInCommand, authSignOutCommand},
+	Name: "auth",
+	Subcommands: []*cli.Command{
+		authSignInCommand, authSignOutCommand, authStatusCommand,
+		authListCommand, authUseCommand,
+	},
 }
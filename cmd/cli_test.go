@@ -1,8 +1,12 @@
 package cmd
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"path"
 	"strings"
@@ -133,7 +137,7 @@ func TestAuthSignIn(t *testing.T) {
 	app := tc.newApp()
 	app.Metadata["oauth"] = tc.srv.Config(t)
 	app.Reader = strings.NewReader(internal.TestOAuthCode + "\n")
-	err := app.Run([]string{"test", "auth", "signin"})
+	err := app.Run([]string{"test", "auth", "signin", "--console"})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -151,7 +155,7 @@ func TestAuthSignInWithoutDaemonSucceeds(t *testing.T) {
 	app := tc.newApp()
 	app.Metadata["oauth"] = tc.srv.Config(t)
 	app.Reader = strings.NewReader(internal.TestOAuthCode + "\n")
-	err := app.Run([]string{"test", "auth", "signin"})
+	err := app.Run([]string{"test", "auth", "signin", "--console"})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -162,6 +166,104 @@ func TestAuthSignInWithoutDaemonSucceeds(t *testing.T) {
 	}
 }
 
+func TestAuthSignInWithLoopback(t *testing.T) {
+	tc := newTestContext(t)
+	defer tc.Stop()
+
+	restore := openBrowser
+	defer func() { openBrowser = restore }()
+	openBrowser = func(authURL string) error {
+		resp, err := http.Get(authURL)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+
+	app := tc.newApp()
+	app.Metadata["oauth"] = tc.srv.Config(t)
+	err := app.Run([]string{"test", "auth", "signin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tc.auth.CurrentUser() == nil {
+		t.Errorf("Expected to be authenticated")
+	}
+}
+
+func TestAuthSignInWithDevice(t *testing.T) {
+	tc := newTestContext(t)
+	defer tc.Stop()
+
+	app := tc.newApp()
+	app.Metadata["oauth"] = tc.srv.Config(t)
+	app.Metadata["device_auth_url"] = tc.srv.DeviceAuthURL()
+	err := app.Run([]string{"test", "auth", "signin", "--device"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tc.auth.CurrentUser() == nil {
+		t.Errorf("Expected to be authenticated")
+	}
+}
+
+func TestAuthSignInWithUnknownProviderFails(t *testing.T) {
+	tc := newTestContext(t)
+	defer tc.Stop()
+
+	app := tc.newApp()
+	err := app.Run([]string{"test", "auth", "signin", "--provider", "unknown"})
+	if err == nil {
+		t.Errorf("Expected to fail")
+	}
+	t.Log(err)
+}
+
+func TestAuthSignInWithConflictingMethodsFails(t *testing.T) {
+	tc := newTestContext(t)
+	defer tc.Stop()
+
+	app := tc.newApp()
+	err := app.Run([]string{"test", "auth", "signin", "--device",
+		"--email", "test@example.com"})
+	if err == nil {
+		t.Errorf("Expected to fail")
+	}
+	t.Log(err)
+}
+
+func TestAuthSignInWithEmail(t *testing.T) {
+	tc := newTestContext(t)
+	defer tc.Stop()
+
+	// Create the account in the emulator.
+	signUpURL := fmt.Sprintf(
+		"http://%s/identitytoolkit.googleapis.com/v1/accounts:signUp?key=%s",
+		os.Getenv("FIREBASE_AUTH_EMULATOR_HOST"), tc.app.APIKey)
+	resp, err := http.Post(signUpURL, "application/json", strings.NewReader(
+		`{"email": "test@example.com", "password": "hunter2"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	passwordFile := path.Join(tc.testDir, "password")
+	err = ioutil.WriteFile(passwordFile, []byte("hunter2\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := tc.newApp()
+	err = app.Run([]string{"test", "auth", "signin",
+		"--email", "test@example.com", "--password-file", passwordFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user := tc.auth.CurrentUser(); user == nil ||
+		user.Email != "test@example.com" {
+		t.Errorf("Unexpected user: %+v\n", user)
+	}
+}
+
 func TestAuthSignInWithBadCodeFails(t *testing.T) {
 	tc := newTestContext(t)
 	defer tc.Stop()
@@ -171,7 +273,7 @@ func TestAuthSignInWithBadCodeFails(t *testing.T) {
 	app.Metadata["oauth"] = tc.srv.Config(t)
 	app.Reader = strings.NewReader("invalid\n")
 
-	err := app.Run([]string{"test", "auth", "signin"})
+	err := app.Run([]string{"test", "auth", "signin", "--console"})
 	if err == nil {
 		t.Errorf("Expected to fail")
 	}
@@ -250,3 +352,105 @@ func TestServerAddWithoutDaemonFails(t *testing.T) {
 	}
 	t.Log(err)
 }
+
+func TestServerRemove(t *testing.T) {
+	cache := &firebase.MemoryUserCache{
+		"default": &firebase.User{},
+	}
+	tc := newTestContext(t, firebase.WithUserCache(cache))
+	defer tc.Stop()
+	tc.StartDaemon(t)
+
+	app := tc.newApp()
+	serverPath := tc.createTestServer(t)
+	err := app.Run([]string{"test", "server", "add",
+		"--name", "test", "--path", serverPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = app.Run([]string{"test", "server", "remove", "--path", serverPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = app.Run([]string{"test", "server", "remove", "--path", serverPath})
+	if err == nil {
+		t.Errorf("Expected to fail to remove an unknown server.")
+	}
+	t.Log(err)
+}
+
+func TestServerList(t *testing.T) {
+	cache := &firebase.MemoryUserCache{
+		"default": &firebase.User{},
+	}
+	tc := newTestContext(t, firebase.WithUserCache(cache))
+	defer tc.Stop()
+	tc.StartDaemon(t)
+
+	app := tc.newApp()
+	serverPath := tc.createTestServer(t)
+	err := app.Run([]string{"test", "server", "add",
+		"--name", "test", "--path", serverPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	app.Writer = &buf
+	err = app.Run([]string{"test", "server", "list", "--json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statuses []daemon.ServerStatus
+	if err := json.Unmarshal(buf.Bytes(), &statuses); err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 || statuses[0].Path != serverPath {
+		t.Errorf("Expected to find server %s: %+v\n", serverPath, statuses)
+	}
+
+	buf.Reset()
+	err = app.Run([]string{"test", "server", "list"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), serverPath) {
+		t.Errorf("Expected table to contain %s: %s\n", serverPath, buf.String())
+	}
+}
+
+func TestEvents(t *testing.T) {
+	cache := &firebase.MemoryUserCache{
+		"default": &firebase.User{},
+	}
+	tc := newTestContext(t, firebase.WithUserCache(cache))
+	defer tc.Stop()
+	tc.StartDaemon(t)
+
+	app := tc.newApp()
+	err := app.Run([]string{"test", "server", "add",
+		"--name", "test", "--path", tc.createTestServer(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	app.Writer = &buf
+	deadline := time.Now().Add(10 * time.Second)
+	for buf.Len() == 0 && time.Now().Before(deadline) {
+		err = app.Run([]string{"test", "events", "--json", "--type", "poll"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	var activity daemon.Activity
+	if err := json.NewDecoder(&buf).Decode(&activity); err != nil {
+		t.Fatal(err)
+	}
+	if activity.Type != daemon.ActivityPoll || activity.ServerID == "" {
+		t.Errorf("Expected the server to be polled: %+v", activity)
+	}
+}
@@ -13,6 +13,11 @@ func NewClient() (*rpc.Client, error) {
 	if err != nil {
 		return nil, err
 	}
+	// Make sure the daemon, rather than another user, is listening before
+	// sending it any credentials.
+	if err := daemon.CheckSocket(addr.Name); err != nil {
+		return nil, err
+	}
 	conn, err := net.DialUnix("unix", nil, addr)
 	if err != nil {
 		return nil, err
@@ -4,4 +4,5 @@ import (
 	"github.com/urfave/cli/v2"
 )
 
-var Commands = []*cli.Command{authCommand, daemonCommand, serverCommand}
+var Commands = []*cli.Command{
+	authCommand, daemonCommand, eventsCommand, serverCommand}
@@ -21,14 +21,33 @@ func daemonWarning(writer io.Writer, app string) {
 var daemonCommand = &cli.Command{
 	Name:  "daemon",
 	Usage: "",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "http",
+			Usage: "Also serve the HTTP API on this loopback address, like 127.0.0.1:8765",
+		},
+	},
+	Subcommands: []*cli.Command{daemonInstallUnitCommand},
 	Action: func(c *cli.Context) error {
 		app := c.App.Metadata["app"].(*firebase.App)
-		auth := c.App.Metadata["auth"].(*firebase.Auth)
+		auth, err := getAuth(c)
+		if err != nil {
+			return err
+		}
 		dae, err := daemon.NewRPCDaemon(c.Context, app, auth)
 		if err != nil {
 			return err
 		}
 		defer dae.Close()
+		if c.IsSet("http") {
+			addr, err := dae.ListenHTTP(c.String("http"))
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(c.App.Writer,
+				"Serving the HTTP API on http://%s, the token is in %s\n",
+				addr, dae.APITokenPath())
+		}
 		return dae.Run(c.Context)
 	},
 }
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/Coderlane/minecraft-sidecart/daemon"
+)
+
+// eventsWait is how long each follow request waits for new activity.
+var eventsWait = 30 * time.Second
+
+var eventsCommand = &cli.Command{
+	Name:  "events",
+	Usage: "Show what the daemon has been doing",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:    "follow",
+			Aliases: []string{"f"},
+			Usage:   "Keep printing activity as it happens",
+		},
+		&cli.StringFlag{
+			Name:  "id",
+			Usage: "Only show activity for the server with this id",
+		},
+		&cli.StringSliceFlag{
+			Name:  "type",
+			Usage: "Only show activity of this type: poll, change, upload, error or auth",
+		},
+		&cli.BoolFlag{
+			Name:  "json",
+			Usage: "Output each activity as a line of JSON",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		client, err := NewClient()
+		if err != nil {
+			daemonWarning(c.App.Writer, c.App.Name)
+			return err
+		}
+		types := make(map[daemon.ActivityType]bool)
+		for _, activityType := range c.StringSlice("type") {
+			types[daemon.ActivityType(activityType)] = true
+		}
+		var spec daemon.WatchActivitySpec
+		for {
+			var activities []daemon.Activity
+			err = client.Call("Daemon.WatchActivity", spec, &activities)
+			if err != nil {
+				return err
+			}
+			for _, activity := range activities {
+				spec.After = activity.Seq
+				// Gaps are always shown, the filtered activity may be missing.
+				if activity.Type != daemon.ActivityGap &&
+					!showActivity(c, types, activity) {
+					continue
+				}
+				if err := writeActivity(c.App.Writer,
+					activity, c.Bool("json")); err != nil {
+					return err
+				}
+			}
+			if !c.Bool("follow") {
+				return nil
+			}
+			spec.Wait = eventsWait
+		}
+	},
+}
+
+// showActivity reports whether the activity passes the --id and --type
+// filters.
+func showActivity(c *cli.Context,
+	types map[daemon.ActivityType]bool, activity daemon.Activity) bool {
+	if c.IsSet("id") && activity.ServerID != c.String("id") {
+		return false
+	}
+	return len(types) == 0 || types[activity.Type]
+}
+
+func writeActivity(writer io.Writer, activity daemon.Activity, asJSON bool) error {
+	if asJSON {
+		return json.NewEncoder(writer).Encode(activity)
+	}
+	var subject string
+	switch {
+	case activity.ServerID != "":
+		subject = activity.ServerID
+	case activity.Profile != "":
+		subject = "profile " + activity.Profile
+	default:
+		subject = "daemon"
+	}
+	_, err := fmt.Fprintf(writer, "%s  %-6s  %s: %s\n",
+		activity.Time.Format(time.RFC3339), activity.Type, subject,
+		activity.Message)
+	return err
+}
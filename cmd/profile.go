@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/Coderlane/minecraft-sidecart/firebase"
+)
+
+// ProfilePath holds the name of the auth profile selected with `auth use`.
+var ProfilePath = "$HOME/.config/minecraft-sidecart/profile"
+
+// CurrentProfile returns the profile selected with `auth use`, or the default
+// profile if none has been selected.
+func CurrentProfile() string {
+	data, err := ioutil.ReadFile(os.ExpandEnv(ProfilePath))
+	if err != nil {
+		return firebase.DefaultUser
+	}
+	name := strings.TrimSpace(string(data))
+	if validateProfile(name) != nil {
+		return firebase.DefaultUser
+	}
+	return name
+}
+
+func setCurrentProfile(name string) error {
+	profilePath := os.ExpandEnv(ProfilePath)
+	if err := os.MkdirAll(path.Dir(profilePath), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(profilePath, []byte(name+"\n"), 0600)
+}
+
+func validateProfile(name string) error {
+	return firebase.ValidateProfile(name)
+}
+
+var authListCommand = &cli.Command{
+	Name:    "list",
+	Aliases: []string{"ls"},
+	Usage:   "List the signed in profiles, the current profile is marked with *",
+	Action: func(c *cli.Context) error {
+		auth, err := getAuth(c)
+		if err != nil {
+			return err
+		}
+		profiles, err := auth.Profiles()
+		if err != nil {
+			return err
+		}
+		for _, name := range profiles {
+			marker := " "
+			if name == auth.Profile() {
+				marker = "*"
+			}
+			email := ""
+			if user := auth.ForProfile(name).CurrentUser(); user != nil {
+				email = user.Email
+			}
+			fmt.Fprintf(c.App.Writer, "%s %s\t%s\n", marker, name, email)
+		}
+		return nil
+	},
+}
+
+var authUseCommand = &cli.Command{
+	Name:      "use",
+	Usage:     "Select the profile used by other commands",
+	ArgsUsage: "PROFILE",
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			return fmt.Errorf("expected a profile name")
+		}
+		name := c.Args().First()
+		if err := validateProfile(name); err != nil {
+			return err
+		}
+		auth, err := getAuth(c)
+		if err != nil {
+			return err
+		}
+		if auth.ForProfile(name).CurrentUser() == nil {
+			return fmt.Errorf("profile %s is not signed in, "+
+				"run: auth signin --profile %s", name, name)
+		}
+		return setCurrentProfile(name)
+	},
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/Coderlane/minecraft-sidecart/daemon"
+	"github.com/Coderlane/minecraft-sidecart/firebase"
+)
+
+func testProfileApp(t *testing.T) (*cli.App, *bytes.Buffer) {
+	t.Helper()
+	restore := ProfilePath
+	ProfilePath = path.Join(t.TempDir(), "profile")
+	t.Cleanup(func() { ProfilePath = restore })
+
+	fbApp := &firebase.App{ProjectID: "test"}
+	cache := &firebase.MemoryUserCache{
+		"default": &firebase.User{UserID: "personal", Email: "me@example.com"},
+		"team":    &firebase.User{UserID: "team", Email: "team@example.com"},
+	}
+	app := cli.NewApp()
+	app.Setup()
+	app.Metadata = map[string]interface{}{
+		"auth": fbApp.NewAuth(firebase.WithUserCache(cache)),
+		"app":  fbApp,
+	}
+	app.Commands = Commands
+	var out bytes.Buffer
+	app.Writer = &out
+	return app, &out
+}
+
+func TestAuthListMarksCurrentProfile(t *testing.T) {
+	app, out := testProfileApp(t)
+	if err := app.Run([]string{"sidecart", "auth", "list"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "* default\tme@example.com") ||
+		!strings.Contains(out.String(), "  team\tteam@example.com") {
+		t.Errorf("Unexpected profiles:\n%s", out.String())
+	}
+}
+
+func TestAuthUseSelectsProfile(t *testing.T) {
+	app, _ := testProfileApp(t)
+	if CurrentProfile() != firebase.DefaultUser {
+		t.Errorf("Expected the default profile, got: %s", CurrentProfile())
+	}
+	if err := app.Run([]string{"sidecart", "auth", "use", "team"}); err != nil {
+		t.Fatal(err)
+	}
+	if CurrentProfile() != "team" {
+		t.Errorf("Expected the team profile, got: %s", CurrentProfile())
+	}
+}
+
+func TestAuthUseRequiresSignedInProfile(t *testing.T) {
+	app, _ := testProfileApp(t)
+	for _, name := range []string{"missing", "../team"} {
+		if err := app.Run([]string{"sidecart", "auth", "use", name}); err == nil {
+			t.Errorf("Expected using profile %q to fail", name)
+		}
+	}
+	if CurrentProfile() != firebase.DefaultUser {
+		t.Errorf("Expected the default profile, got: %s", CurrentProfile())
+	}
+}
+
+func TestAuthStatusSignedOutFails(t *testing.T) {
+	daemon.DefaultRootDir = t.TempDir()
+	app, out := testProfileApp(t)
+	err := app.Run([]string{"sidecart", "auth", "status", "--profile", "nobody"})
+	if err == nil {
+		t.Fatal("Expected a signed out profile to fail")
+	}
+	for _, line := range []string{"nobody", "signed out", "not running"} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("Expected %q in the status:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestAuthSignOutDeletesProfile(t *testing.T) {
+	daemon.DefaultRootDir = t.TempDir()
+	app, out := testProfileApp(t)
+	err := app.Run([]string{"sidecart", "auth", "signout", "--profile", "team"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := app.Metadata["auth"].(*firebase.Auth)
+	if auth.ForProfile("team").CurrentUser() != nil {
+		t.Errorf("Expected the team profile to be signed out")
+	}
+	if auth.CurrentUser() == nil {
+		t.Errorf("Expected the default profile to stay signed in")
+	}
+	if !strings.Contains(out.String(), "Signed out of profile team") {
+		t.Errorf("Unexpected output:\n%s", out.String())
+	}
+}
+
+func TestAuthSignOutRevokeUnsupportedFails(t *testing.T) {
+	app, _ := testProfileApp(t)
+	err := app.Run([]string{"sidecart", "auth", "signout", "--revoke"})
+	if !errors.Is(err, firebase.ErrRevokeUnsupported) {
+		t.Errorf("Expected revoking to be unsupported, got: %v", err)
+	}
+	if app.Metadata["auth"].(*firebase.Auth).CurrentUser() == nil {
+		t.Errorf("Expected to stay signed in when revoking fails")
+	}
+}
@@ -1,6 +1,12 @@
 package cmd
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
 	"github.com/urfave/cli/v2"
 
 	"github.com/Coderlane/minecraft-sidecart/daemon"
@@ -19,23 +25,162 @@ var serverAddCommand = &cli.Command{
 			Usage:    "The path to the root of the server",
 			Required: true,
 		},
+		&cli.StringFlag{
+			Name:  "profile",
+			Usage: "The auth profile to upload with, defaults to the current profile",
+		},
 	},
 	Action: func(c *cli.Context) error {
+		profile := c.String("profile")
+		if profile == "" {
+			profile = CurrentProfile()
+		} else if err := validateProfile(profile); err != nil {
+			return err
+		}
 		client, err := NewClient()
 		if err != nil {
 			daemonWarning(c.App.Writer, c.App.Name)
 			return err
 		}
 		spec := daemon.ServerSpec{
-			Path: c.String("path"),
-			Name: c.String("name"),
+			Path:    c.String("path"),
+			Name:    c.String("name"),
+			Profile: profile,
 		}
 		var id string
 		return client.Call("Daemon.AddServer", spec, &id)
 	},
 }
 
+var serverRemoveCommand = &cli.Command{
+	Name:    "remove",
+	Aliases: []string{"rm"},
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "id",
+			Usage: "The id of the server",
+		},
+		&cli.StringFlag{
+			Name:  "path",
+			Usage: "The path to the root of the server",
+		},
+		&cli.BoolFlag{
+			Name:  "delete",
+			Usage: "Delete the server from the database",
+		},
+		&cli.BoolFlag{
+			Name:  "archive",
+			Usage: "Archive the server in the database",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		client, err := NewClient()
+		if err != nil {
+			daemonWarning(c.App.Writer, c.App.Name)
+			return err
+		}
+		spec := daemon.RemoveServerSpec{
+			ID:      c.String("id"),
+			Path:    c.String("path"),
+			Delete:  c.Bool("delete"),
+			Archive: c.Bool("archive"),
+		}
+		var id string
+		return client.Call("Daemon.RemoveServer", spec, &id)
+	},
+}
+
+var serverMoveCommand = &cli.Command{
+	Name:    "move",
+	Aliases: []string{"mv"},
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "id",
+			Usage:    "The id of the server",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:     "path",
+			Usage:    "The new path to the root of the server",
+			Required: true,
+		},
+	},
+	Action: func(c *cli.Context) error {
+		client, err := NewClient()
+		if err != nil {
+			daemonWarning(c.App.Writer, c.App.Name)
+			return err
+		}
+		spec := daemon.MoveServerSpec{
+			ID:   c.String("id"),
+			Path: c.String("path"),
+		}
+		var id string
+		return client.Call("Daemon.MoveServer", spec, &id)
+	},
+}
+
+var serverListCommand = &cli.Command{
+	Name:    "list",
+	Aliases: []string{"ls"},
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "id",
+			Usage: "Only list the server with this id",
+		},
+		&cli.BoolFlag{
+			Name:  "json",
+			Usage: "Output the servers as JSON",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		client, err := NewClient()
+		if err != nil {
+			daemonWarning(c.App.Writer, c.App.Name)
+			return err
+		}
+		spec := daemon.ListServersSpec{
+			ID: c.String("id"),
+		}
+		var statuses []daemon.ServerStatus
+		err = client.Call("Daemon.ListServers", spec, &statuses)
+		if err != nil {
+			return err
+		}
+		if c.Bool("json") {
+			enc := json.NewEncoder(c.App.Writer)
+			enc.SetIndent("", "  ")
+			return enc.Encode(statuses)
+		}
+		return writeServerTable(c.App.Writer, statuses)
+	},
+}
+
+func writeServerTable(writer io.Writer, statuses []daemon.ServerStatus) error {
+	tw := tabwriter.NewWriter(writer, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tTYPE\tPROFILE\tPATH\tLAST UPLOAD\tLAST ERROR")
+	for _, status := range statuses {
+		profile := status.Profile
+		switch {
+		case status.ReauthRequired:
+			profile += " (sign in again)"
+		case !status.Authenticated:
+			profile += " (signed out)"
+		}
+		lastUpload := "never"
+		if !status.LastUpload.IsZero() {
+			lastUpload = status.LastUpload.Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", status.ID, status.Name,
+			status.Type, profile, status.Path, lastUpload, status.LastError)
+	}
+	return tw.Flush()
+}
+
 var serverCommand = &cli.Command{
-	Name:        "server",
-	Subcommands: []*cli.Command{serverAddCommand},
+	Name: "server",
+	Subcommands: []*cli.Command{
+		serverAddCommand, serverListCommand, serverMoveCommand,
+		serverRemoveCommand,
+	},
 }
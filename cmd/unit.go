@@ -0,0 +1,217 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path"
+	"text/template"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/Coderlane/minecraft-sidecart/daemon"
+)
+
+// unitName is the name of the systemd units install-unit writes.
+const unitName = "minecraft-sidecart"
+
+// systemRuntimeDir holds the socket of a system daemon.
+const systemRuntimeDir = "/run/" + unitName
+
+// systemUserCacheKey is the key a system daemon encrypts signed in users
+// with. A system service has no keyring, so systemd passes it the key as the
+// user-cache-key credential.
+const systemUserCacheKey = "/etc/" + unitName + "/user-cache-key"
+
+var serviceTemplate = template.Must(template.New("service").Parse(`[Unit]
+Description=Minecraft Sidecart daemon
+{{- if .System}}
+Wants=network-online.target
+After=network-online.target
+{{- end}}
+{{- if .Socket}}
+Requires={{.Name}}.socket
+After={{.Name}}.socket
+{{- end}}
+
+[Service]
+Type=notify
+NotifyAccess=main
+ExecStart={{.Executable}} --runtime-dir {{.RuntimeDir}} daemon
+Restart=on-failure
+WatchdogSec=60
+{{- if .System}}
+User={{.User}}
+RuntimeDirectory={{.Name}}
+RuntimeDirectoryPreserve=yes
+LoadCredential=user-cache-key:{{.UserCacheKey}}
+{{- end}}
+
+[Install]
+WantedBy={{if .System}}multi-user.target{{else}}default.target{{end}}
+`))
+
+var socketTemplate = template.Must(template.New("socket").Parse(`[Unit]
+Description=Minecraft Sidecart daemon socket
+
+[Socket]
+ListenStream={{.RuntimeDir}}/{{.SocketName}}
+SocketMode=0600
+{{- if .System}}
+SocketUser={{.User}}
+{{- end}}
+
+[Install]
+WantedBy=sockets.target
+`))
+
+// unitConfig fills in the unit templates.
+type unitConfig struct {
+	Name       string
+	Executable string
+	System     bool
+	Socket     bool
+	User       string
+	RuntimeDir string
+	SocketName string
+	// UserCacheKey is the key file loaded as a credential by system units.
+	UserCacheKey string
+}
+
+// defaultUnitDir is where units are installed for systemd to find.
+func defaultUnitDir(system bool) (string, error) {
+	if system {
+		return "/etc/systemd/system", nil
+	}
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if configDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		configDir = path.Join(home, ".config")
+	}
+	return path.Join(configDir, "systemd", "user"), nil
+}
+
+// writeUnit renders tmpl to unitPath, refusing to replace an existing unit
+// unless force is set.
+func writeUnit(unitPath string, tmpl *template.Template,
+	cfg unitConfig, force bool) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !force {
+		flags |= os.O_EXCL
+	}
+	file, err := os.OpenFile(unitPath, flags, 0644)
+	if os.IsExist(err) {
+		return fmt.Errorf("%s already exists, pass --force to replace it",
+			unitPath)
+	} else if err != nil {
+		return err
+	}
+	if err := tmpl.Execute(file, cfg); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+var daemonInstallUnitCommand = &cli.Command{
+	Name:  "install-unit",
+	Usage: "Write a systemd unit that runs the daemon",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "system",
+			Usage: "Write a system unit instead of a user unit",
+		},
+		&cli.StringFlag{
+			Name:  "user",
+			Usage: "The user a system unit runs the daemon as, defaults to the current user",
+		},
+		&cli.BoolFlag{
+			Name:  "socket",
+			Usage: "Also write a socket unit, so systemd starts the daemon when the CLI connects",
+		},
+		&cli.StringFlag{
+			Name:  "dir",
+			Usage: "Write the units to this directory instead of systemd's",
+		},
+		&cli.BoolFlag{
+			Name:  "force",
+			Usage: "Replace existing units",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		executable, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		cfg := unitConfig{
+			Name:       unitName,
+			Executable: executable,
+			System:     c.Bool("system"),
+			Socket:     c.Bool("socket"),
+			User:       c.String("user"),
+			RuntimeDir: "%t",
+		}
+		runAs, err := user.Current()
+		if err != nil {
+			return err
+		}
+		if cfg.System {
+			cfg.RuntimeDir = systemRuntimeDir
+			cfg.UserCacheKey = systemUserCacheKey
+			if cfg.User == "" {
+				cfg.User = runAs.Username
+			} else if runAs, err = user.Lookup(cfg.User); err != nil {
+				return err
+			}
+		} else if c.IsSet("user") {
+			return fmt.Errorf("--user is only used with --system")
+		}
+		cfg.SocketName = daemon.SocketName(runAs.Uid)
+
+		dir := c.String("dir")
+		if dir == "" {
+			if dir, err = defaultUnitDir(cfg.System); err != nil {
+				return err
+			}
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		units := []string{unitName + ".service"}
+		if cfg.Socket {
+			units = append(units, unitName+".socket")
+		}
+		for _, unit := range units {
+			tmpl := serviceTemplate
+			if path.Ext(unit) == ".socket" {
+				tmpl = socketTemplate
+			}
+			unitPath := path.Join(dir, unit)
+			if err := writeUnit(unitPath, tmpl, cfg, c.Bool("force")); err != nil {
+				return err
+			}
+			fmt.Fprintf(c.App.Writer, "Wrote %s\n", unitPath)
+		}
+
+		systemctl := "systemctl --user"
+		if cfg.System {
+			systemctl = "sudo systemctl"
+		}
+		fmt.Fprintf(c.App.Writer, "Enable it with: %s daemon-reload && "+
+			"%s enable --now %s\n", systemctl, systemctl, units[len(units)-1])
+		if cfg.System {
+			fmt.Fprintf(c.App.Writer, "The daemon keeps signed in users "+
+				"encrypted with the key in %s, which must exist before it "+
+				"starts. Create it with: sudo install -d -m 0700 %s && "+
+				"head -c 32 /dev/urandom | base64 | sudo install -m 0600 "+
+				"/dev/stdin %s\n", systemUserCacheKey,
+				path.Dir(systemUserCacheKey), systemUserCacheKey)
+			fmt.Fprintf(c.App.Writer, "Run the CLI as %s with --runtime-dir %s\n",
+				cfg.User, systemRuntimeDir)
+		}
+		return nil
+	},
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDaemonInstallUnit(t *testing.T) {
+	app, out := testProfileApp(t)
+	dir := t.TempDir()
+	args := []string{"sidecart", "daemon", "install-unit", "--socket", "--dir", dir}
+	if err := app.Run(args); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "systemctl --user enable --now minecraft-sidecart.socket") {
+		t.Errorf("Expected instructions to enable the socket:\n%s", out.String())
+	}
+
+	service, err := ioutil.ReadFile(path.Join(dir, "minecraft-sidecart.service"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"Type=notify", "WatchdogSec=60",
+		"--runtime-dir %t daemon", "Requires=minecraft-sidecart.socket",
+		"WantedBy=default.target"} {
+		if !strings.Contains(string(service), line) {
+			t.Errorf("Expected the service to contain %q:\n%s", line, service)
+		}
+	}
+	socket, err := ioutil.ReadFile(path.Join(dir, "minecraft-sidecart.socket"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	listen := "ListenStream=%t/minecraft-sidecart-" + strconv.Itoa(os.Getuid())
+	if !strings.Contains(string(socket), listen) {
+		t.Errorf("Expected the socket to contain %q:\n%s", listen, socket)
+	}
+
+	if err := app.Run(args); err == nil {
+		t.Errorf("Expected existing units not to be replaced")
+	}
+	if err := app.Run(append(args, "--force")); err != nil {
+		t.Errorf("Expected --force to replace the units: %v", err)
+	}
+}
+
+func TestDaemonInstallSystemUnit(t *testing.T) {
+	app, out := testProfileApp(t)
+	dir := t.TempDir()
+	args := []string{"sidecart", "daemon", "install-unit", "--system", "--dir", dir}
+	if err := app.Run(args); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), systemUserCacheKey) {
+		t.Errorf("Expected instructions to create the user cache key:\n%s",
+			out.String())
+	}
+
+	service, err := ioutil.ReadFile(path.Join(dir, "minecraft-sidecart.service"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"--runtime-dir /run/minecraft-sidecart daemon",
+		"LoadCredential=user-cache-key:" + systemUserCacheKey,
+		"WantedBy=multi-user.target"} {
+		if !strings.Contains(string(service), line) {
+			t.Errorf("Expected the service to contain %q:\n%s", line, service)
+		}
+	}
+}
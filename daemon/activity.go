@@ -0,0 +1,213 @@
+package daemon
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ActivityType is the kind of work an Activity describes.
+type ActivityType string
+
+const (
+	// ActivityPoll is published each time a server is polled. Only the
+	// latest poll of each server is kept for subscribers that fall behind.
+	ActivityPoll ActivityType = "poll"
+	// ActivityChange is published when a poll finds the server info changed.
+	ActivityChange ActivityType = "change"
+	// ActivityUpload is published when an update is uploaded.
+	ActivityUpload ActivityType = "upload"
+	// ActivityError is published when a subsystem fails.
+	ActivityError ActivityType = "error"
+	// ActivityAuth is published when a profile's token is refreshed, or the
+	// refresh fails.
+	ActivityAuth ActivityType = "auth"
+	// ActivityGap is never published, it is returned in place of activity a
+	// subscriber fell too far behind to receive.
+	ActivityGap ActivityType = "gap"
+)
+
+// Activity is something the daemon did. Each activity has a sequence number
+// larger than the one before it.
+type Activity struct {
+	Seq      uint64       `json:"seq"`
+	Time     time.Time    `json:"time"`
+	Type     ActivityType `json:"type"`
+	ServerID string       `json:"server_id,omitempty"`
+	Profile  string       `json:"profile,omitempty"`
+	Message  string       `json:"message"`
+}
+
+// activityBufferSize is how many activities, other than polls, are kept for
+// subscribers that fall behind.
+var activityBufferSize = 256
+
+// activityBus records the daemon's recent activity. Subscribers read the
+// activity after the last sequence number they saw, and wait on a channel
+// which is closed when more is published.
+type activityBus struct {
+	// epoch identifies this daemon's sequence numbers, which start again
+	// from one each time the daemon starts.
+	epoch string
+
+	mtx    sync.Mutex
+	seq    uint64
+	recent []Activity
+	// polls holds the latest poll of each server, polls are too frequent to
+	// buffer.
+	polls map[string]Activity
+	// dropped is the sequence number of the newest activity dropped from
+	// recent.
+	dropped uint64
+	wake    chan struct{}
+}
+
+func newActivityBus() *activityBus {
+	return &activityBus{
+		epoch: strconv.FormatInt(time.Now().UnixNano(), 36),
+		polls: make(map[string]Activity),
+		wake:  make(chan struct{}),
+	}
+}
+
+// publish records the activity and wakes every subscriber.
+func (bus *activityBus) publish(activity Activity) {
+	bus.mtx.Lock()
+	defer bus.mtx.Unlock()
+	bus.seq++
+	activity.Seq = bus.seq
+	if activity.Time.IsZero() {
+		activity.Time = time.Now()
+	}
+	if activity.Type == ActivityPoll {
+		bus.polls[activity.ServerID] = activity
+	} else {
+		bus.recent = append(bus.recent, activity)
+		if extra := len(bus.recent) - activityBufferSize; extra > 0 {
+			bus.dropped = bus.recent[extra-1].Seq
+			bus.recent = bus.recent[extra:]
+		}
+	}
+	close(bus.wake)
+	bus.wake = make(chan struct{})
+}
+
+// since returns the buffered activity after seq, and a channel that is closed
+// the next time activity is published. If activity after seq was dropped, the
+// activity starts with an ActivityGap. A seq newer than any published is from
+// before the daemon restarted, so every buffered activity is returned.
+func (bus *activityBus) since(seq uint64) ([]Activity, <-chan struct{}) {
+	bus.mtx.Lock()
+	defer bus.mtx.Unlock()
+	if seq > bus.seq {
+		seq = 0
+	}
+	start := len(bus.recent)
+	for start > 0 && bus.recent[start-1].Seq > seq {
+		start--
+	}
+	var activities []Activity
+	if seq != 0 && seq < bus.dropped {
+		activities = append(activities, Activity{
+			Seq:  bus.dropped,
+			Time: time.Now(),
+			Type: ActivityGap,
+			Message: fmt.Sprintf("fell behind, missed activity %d to %d",
+				seq+1, bus.dropped),
+		})
+	}
+	activities = append(activities, bus.recent[start:]...)
+	for _, poll := range bus.polls {
+		if poll.Seq > seq {
+			activities = append(activities, poll)
+		}
+	}
+	sort.SliceStable(activities, func(i, j int) bool {
+		return activities[i].Seq < activities[j].Seq
+	})
+	if activities == nil {
+		activities = []Activity{}
+	}
+	return activities, bus.wake
+}
+
+// publish records activity for the server, id may be empty.
+func (dae *Daemon) publish(activityType ActivityType,
+	id string, format string, args ...interface{}) {
+	dae.activity.publish(Activity{
+		Type:     activityType,
+		ServerID: id,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// reportError logs a failure and publishes it as activity for the server.
+func (dae *Daemon) reportError(id string, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	fmt.Println(message)
+	dae.publish(ActivityError, id, "%s", message)
+}
+
+// describeChange lists the fields that differ between two server infos.
+func describeChange(old, new interface{}) string {
+	oldValue, newValue := reflect.ValueOf(old), reflect.ValueOf(new)
+	if !oldValue.IsValid() || oldValue.Type() != newValue.Type() ||
+		newValue.Kind() != reflect.Struct {
+		return "server info changed"
+	}
+	var fields []string
+	for i := 0; i < newValue.NumField(); i++ {
+		if !newValue.Type().Field(i).IsExported() {
+			continue
+		}
+		if !reflect.DeepEqual(oldValue.Field(i).Interface(),
+			newValue.Field(i).Interface()) {
+			fields = append(fields, newValue.Type().Field(i).Name)
+		}
+	}
+	return "changed " + strings.Join(fields, ", ")
+}
+
+// maxActivityWait bounds how long WatchActivity waits for new activity.
+var maxActivityWait = 30 * time.Second
+
+// WatchActivitySpec asks for the activity after a sequence number. Zero
+// returns every buffered activity.
+type WatchActivitySpec struct {
+	After uint64 `json:"after"`
+	// Wait is how long to wait when there is no activity after After yet, it
+	// is capped at 30 seconds. Zero returns immediately.
+	Wait time.Duration `json:"wait"`
+}
+
+// WatchActivity returns the activity after spec.After, waiting up to
+// spec.Wait for some to be published. Callers follow the activity by passing
+// the last sequence number they received. If a caller falls behind the oldest
+// activity is dropped and an ActivityGap is returned in its place.
+func (dae *Daemon) WatchActivity(
+	spec WatchActivitySpec, activities *[]Activity) error {
+	wait := spec.Wait
+	if wait > maxActivityWait {
+		wait = maxActivityWait
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		recent, wake := dae.activity.since(spec.After)
+		if len(recent) > 0 || wait <= 0 {
+			*activities = recent
+			return nil
+		}
+		select {
+		case <-wake:
+		case <-timer.C:
+			wait = 0
+		case <-dae.ctx.Done():
+			return fmt.Errorf("the daemon is shutting down")
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package daemon
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/rpc"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestActivityBusDropsOldestActivity(t *testing.T) {
+	restore := activityBufferSize
+	activityBufferSize = 2
+	defer func() { activityBufferSize = restore }()
+
+	bus := newActivityBus()
+	for _, message := range []string{"one", "two", "three"} {
+		bus.publish(Activity{Type: ActivityChange, Message: message})
+	}
+	activities, _ := bus.since(0)
+	if len(activities) != 2 || activities[0].Seq != 2 ||
+		activities[1].Message != "three" {
+		t.Errorf("Expected the two newest activities: %+v", activities)
+	}
+	if activities, _ := bus.since(3); len(activities) != 0 {
+		t.Errorf("Expected no activity after the newest: %+v", activities)
+	}
+}
+
+func TestActivityBusReportsGaps(t *testing.T) {
+	restore := activityBufferSize
+	activityBufferSize = 2
+	defer func() { activityBufferSize = restore }()
+
+	bus := newActivityBus()
+	for _, message := range []string{"one", "two", "three", "four"} {
+		bus.publish(Activity{Type: ActivityChange, Message: message})
+	}
+	activities, _ := bus.since(1)
+	if len(activities) != 3 || activities[0].Type != ActivityGap ||
+		activities[0].Seq != 2 || activities[1].Seq != 3 {
+		t.Errorf("Expected a gap before the buffered activity: %+v", activities)
+	}
+	if activities, _ := bus.since(2); len(activities) != 2 ||
+		activities[0].Type == ActivityGap {
+		t.Errorf("Expected no gap once caught up: %+v", activities)
+	}
+}
+
+func TestActivityBusKeepsLatestPoll(t *testing.T) {
+	bus := newActivityBus()
+	bus.publish(Activity{Type: ActivityPoll, ServerID: "a"})
+	bus.publish(Activity{Type: ActivityPoll, ServerID: "b"})
+	bus.publish(Activity{Type: ActivityChange, ServerID: "a"})
+	bus.publish(Activity{Type: ActivityPoll, ServerID: "a"})
+
+	activities, _ := bus.since(0)
+	var seqs []uint64
+	for _, activity := range activities {
+		seqs = append(seqs, activity.Seq)
+	}
+	if !reflect.DeepEqual(seqs, []uint64{2, 3, 4}) {
+		t.Errorf("Expected only the latest poll of each server: %+v", activities)
+	}
+}
+
+func TestActivityBusRestartsAfterNewerSeq(t *testing.T) {
+	bus := newActivityBus()
+	bus.publish(Activity{Type: ActivityChange})
+	// A subscriber from before the daemon restarted saw more activity.
+	activities, _ := bus.since(100)
+	if len(activities) != 1 || activities[0].Seq != 1 {
+		t.Errorf("Expected the buffered activity: %+v", activities)
+	}
+}
+
+func TestDescribeChangeListsFields(t *testing.T) {
+	type info struct {
+		Players int
+		MOTD    string
+		Version string
+	}
+	message := describeChange(info{1, "hi", "1.16"}, info{2, "hello", "1.16"})
+	if message != "changed Players, MOTD" {
+		t.Errorf("Unexpected description: %s", message)
+	}
+	if message := describeChange(nil, info{}); message != "server info changed" {
+		t.Errorf("Unexpected description of the first info: %s", message)
+	}
+}
+
+func TestWatchActivityWaitsForActivity(t *testing.T) {
+	dae, _ := testNewMockDaemon(t)
+	dae.publish(ActivityUpload, "server", "uploaded server info")
+
+	var activities []Activity
+	err := dae.WatchActivity(WatchActivitySpec{After: 0}, &activities)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(activities) != 1 || activities[0].ServerID != "server" {
+		t.Fatalf("Expected the buffered activity: %+v", activities)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		dae.publish(ActivityError, "server", "failed")
+	}()
+	spec := WatchActivitySpec{After: activities[0].Seq, Wait: 5 * time.Second}
+	if err := dae.WatchActivity(spec, &activities); err != nil {
+		t.Fatal(err)
+	}
+	if len(activities) != 1 || activities[0].Type != ActivityError {
+		t.Errorf("Expected to wait for the error: %+v", activities)
+	}
+
+	spec = WatchActivitySpec{After: activities[0].Seq, Wait: 10 * time.Millisecond}
+	if err := dae.WatchActivity(spec, &activities); err != nil {
+		t.Fatal(err)
+	}
+	if len(activities) != 0 {
+		t.Errorf("Expected no activity: %+v", activities)
+	}
+}
+
+func TestWatchActivityOverRPC(t *testing.T) {
+	dae, _ := testNewMockDaemon(t)
+	server := rpc.NewServer()
+	if err := server.Register(dae); err != nil {
+		t.Fatal(err)
+	}
+	clientConn, serverConn := net.Pipe()
+	go server.ServeConn(serverConn)
+	client := rpc.NewClient(clientConn)
+	defer client.Close()
+
+	// An empty reply must survive the round trip.
+	var activities []Activity
+	err := client.Call("Daemon.WatchActivity", WatchActivitySpec{}, &activities)
+	if err != nil || len(activities) != 0 {
+		t.Fatalf("Expected no activity: %v %+v", err, activities)
+	}
+	dae.publish(ActivityPoll, "server", "polled server")
+	err = client.Call("Daemon.WatchActivity", WatchActivitySpec{}, &activities)
+	if err != nil || len(activities) != 1 {
+		t.Fatalf("Expected the poll: %v %+v", err, activities)
+	}
+}
+
+func TestHTTPAPIStreamsEvents(t *testing.T) {
+	dae, srv := testHTTPAPI(t)
+	dae.publish(ActivityPoll, "server", "polled server")
+	dae.publish(ActivityChange, "server", "changed Players")
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/v1/events", nil)
+	req.Header.Set("Authorization", "Bearer "+testAPIToken)
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Unexpected content type: %s", ct)
+	}
+
+	events := make(chan Activity)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			data := strings.TrimPrefix(scanner.Text(), "data: ")
+			if data == scanner.Text() {
+				continue
+			}
+			var activity Activity
+			if err := json.Unmarshal([]byte(data), &activity); err != nil {
+				t.Error(err)
+				return
+			}
+			events <- activity
+		}
+	}()
+	next := func() Activity {
+		t.Helper()
+		select {
+		case activity := <-events:
+			return activity
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected an event")
+		}
+		return Activity{}
+	}
+
+	if activity := next(); activity.Seq != 2 || activity.Type != ActivityChange {
+		t.Errorf("Expected to resume after the first event: %+v", activity)
+	}
+	dae.publish(ActivityUpload, "server", "uploaded server info")
+	if activity := next(); activity.Seq != 3 || activity.Type != ActivityUpload {
+		t.Errorf("Expected the new upload: %+v", activity)
+	}
+}
+
+func TestHTTPAPIEventIDsCarryEpoch(t *testing.T) {
+	dae, srv := testHTTPAPI(t)
+	dae.publish(ActivityChange, "server", "changed Players")
+	api := &httpAPI{daemon: dae}
+	epoch := dae.activity.epoch
+
+	for _, test := range []struct {
+		id   string
+		seq  uint64
+		fail bool
+	}{
+		{"", 0, false},
+		{"1", 1, false},
+		{epoch + "-1", 1, false},
+		{"previous-1", 0, false},
+		{epoch + "-x", 0, true},
+	} {
+		seq, err := api.parseEventID(test.id)
+		if seq != test.seq || (err != nil) != test.fail {
+			t.Errorf("Unexpected seq for %q: %d %v", test.id, seq, err)
+		}
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/v1/events", nil)
+	req.Header.Set("Authorization", "Bearer "+testAPIToken)
+	req.Header.Set("Last-Event-ID", "previous-5")
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	scanner := bufio.NewScanner(resp.Body)
+	if !scanner.Scan() || scanner.Text() != "id: "+epoch+"-1" {
+		t.Errorf("Expected the first activity of this daemon: %q", scanner.Text())
+	}
+}
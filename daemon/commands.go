@@ -0,0 +1,97 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Coderlane/minecraft-sidecart/db"
+	"github.com/Coderlane/minecraft-sidecart/server"
+)
+
+// commandRetryInterval is how long to wait before watching for commands again
+// after the watch fails.
+var commandRetryInterval = time.Second * 30
+
+// watchCommands runs commands queued for the server until ctx is canceled.
+func (dae *Daemon) watchCommands(ctx context.Context,
+	exec server.CommandExecutor, id string) {
+	for {
+		if database, err := dae.dbFor(id); err == nil {
+			err := database.WatchCommands(ctx, id, func(cmd db.Command) {
+				dae.runCommand(ctx, exec, id, cmd)
+			})
+			if ctx.Err() != nil || errors.Is(err, db.ErrUnsupported) {
+				return
+			}
+			dae.reportError(id, "Failed to watch commands for %s: %v", id, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(commandRetryInterval):
+		}
+	}
+}
+
+func (dae *Daemon) runCommand(ctx context.Context,
+	exec server.CommandExecutor, id string, cmd db.Command) {
+	database, err := dae.dbFor(id)
+	if err != nil {
+		dae.reportError(id, "Failed to run command %s for %s: %v", cmd.ID, id, err)
+		return
+	}
+	owners, err := database.GetServerOwners(ctx, id)
+	if err != nil {
+		dae.reportError(id, "Failed to fetch owners for %s: %v", id, err)
+		return
+	}
+	cmd.StartedAt = time.Now()
+	if !isOwner(owners, cmd.RequestedBy) {
+		cmd.Status = db.CommandRejected
+		cmd.Error = "only server owners may run commands"
+		cmd.FinishedAt = cmd.StartedAt
+		dae.updateCommand(ctx, id, cmd)
+		return
+	}
+	cmd.Status = db.CommandRunning
+	if err := dae.updateCommand(ctx, id, cmd); err != nil {
+		// Don't run a command we can not report on.
+		return
+	}
+	fmt.Printf("Running command %s for: %s\n", cmd.ID, id)
+	cmd.Output, err = exec.ExecCommand(ctx, cmd.Command)
+	cmd.FinishedAt = time.Now()
+	if err != nil {
+		cmd.Status = db.CommandFailed
+		cmd.Error = err.Error()
+	} else {
+		cmd.Status = db.CommandSucceeded
+	}
+	dae.updateCommand(ctx, id, cmd)
+}
+
+func (dae *Daemon) updateCommand(ctx context.Context,
+	id string, cmd db.Command) error {
+	database, err := dae.dbFor(id)
+	if err == nil {
+		err = database.UpdateCommand(ctx, id, cmd)
+	}
+	if err != nil {
+		dae.reportError(id, "Failed to update command %s for %s: %v", cmd.ID, id, err)
+	}
+	return err
+}
+
+func isOwner(owners []string, userID string) bool {
+	if userID == "" {
+		return false
+	}
+	for _, owner := range owners {
+		if owner == userID {
+			return true
+		}
+	}
+	return false
+}
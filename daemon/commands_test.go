@@ -0,0 +1,171 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/Coderlane/minecraft-sidecart/db"
+	"github.com/Coderlane/minecraft-sidecart/firebase"
+	"github.com/Coderlane/minecraft-sidecart/server"
+)
+
+type testExecutor struct {
+	commands []string
+	output   string
+	err      error
+}
+
+func (te *testExecutor) ExecCommand(ctx context.Context,
+	cmd string) (string, error) {
+	te.commands = append(te.commands, cmd)
+	return te.output, te.err
+}
+
+// testNewMockDaemon creates a daemon backed by a mock database with a signed
+// in user.
+func testNewMockDaemon(t *testing.T) (*Daemon, *db.MockDatabase) {
+	testDir := t.TempDir()
+	restore := testAddConfigPath(testDir)
+	t.Cleanup(restore)
+
+	ctrl := gomock.NewController(t)
+	database := db.NewMockDatabase(ctrl)
+	mgr, err := newServerManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &firebase.App{ProjectID: "test"}
+	cache := &firebase.MemoryUserCache{
+		"default": &firebase.User{UserID: "owner", RefreshToken: "test"},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	auth := app.NewAuth(firebase.WithUserCache(cache))
+	return &Daemon{
+		ctx:      ctx,
+		cancel:   cancel,
+		mgr:      mgr,
+		journal:  openJournal(path.Join(testDir, "journal.json")),
+		activity: newActivityBus(),
+		auth:     auth,
+		openDatabase: func(*firebase.Auth) (db.Database, error) {
+			return database, nil
+		},
+		newServer: server.NewServer,
+		profiles: map[string]*profile{
+			firebase.DefaultUser: {auth: auth, db: database},
+		},
+	}, database
+}
+
+func TestRunCommandRunsOwnerCommand(t *testing.T) {
+	dae, database := testNewMockDaemon(t)
+	exec := &testExecutor{output: "done"}
+	cmd := db.Command{ID: "cmd", Command: "say hi", RequestedBy: "owner"}
+
+	gomock.InOrder(
+		database.EXPECT().GetServerOwners(gomock.Any(), "srv").
+			Return([]string{"owner"}, nil),
+		database.EXPECT().UpdateCommand(gomock.Any(), "srv", gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ string, cmd db.Command) error {
+				if cmd.Status != db.CommandRunning {
+					t.Errorf("Expected: %s Got: %s\n", db.CommandRunning, cmd.Status)
+				}
+				return nil
+			}),
+		database.EXPECT().UpdateCommand(gomock.Any(), "srv", gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ string, cmd db.Command) error {
+				if cmd.Status != db.CommandSucceeded || cmd.Output != "done" {
+					t.Errorf("Unexpected command: %+v\n", cmd)
+				}
+				if cmd.FinishedAt.IsZero() {
+					t.Errorf("Expected a finish time")
+				}
+				return nil
+			}),
+	)
+
+	dae.runCommand(context.Background(), exec, "srv", cmd)
+	if len(exec.commands) != 1 || exec.commands[0] != "say hi" {
+		t.Errorf("Unexpected commands: %v\n", exec.commands)
+	}
+}
+
+func TestRunCommandRejectsNonOwner(t *testing.T) {
+	dae, database := testNewMockDaemon(t)
+	exec := &testExecutor{}
+	cmd := db.Command{ID: "cmd", Command: "stop", RequestedBy: "intruder"}
+
+	database.EXPECT().GetServerOwners(gomock.Any(), "srv").
+		Return([]string{"owner"}, nil)
+	database.EXPECT().UpdateCommand(gomock.Any(), "srv", gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ string, cmd db.Command) error {
+			if cmd.Status != db.CommandRejected {
+				t.Errorf("Expected: %s Got: %s\n", db.CommandRejected, cmd.Status)
+			}
+			return nil
+		})
+
+	dae.runCommand(context.Background(), exec, "srv", cmd)
+	if len(exec.commands) != 0 {
+		t.Errorf("Expected no commands to run: %v\n", exec.commands)
+	}
+}
+
+func TestRunCommandReportsFailure(t *testing.T) {
+	dae, database := testNewMockDaemon(t)
+	exec := &testExecutor{err: fmt.Errorf("rcon failed")}
+	cmd := db.Command{ID: "cmd", Command: "list", RequestedBy: "owner"}
+
+	database.EXPECT().GetServerOwners(gomock.Any(), "srv").
+		Return([]string{"owner"}, nil)
+	database.EXPECT().UpdateCommand(gomock.Any(), "srv", gomock.Any()).
+		Return(nil)
+	database.EXPECT().UpdateCommand(gomock.Any(), "srv", gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ string, cmd db.Command) error {
+			if cmd.Status != db.CommandFailed || cmd.Error != "rcon failed" {
+				t.Errorf("Unexpected command: %+v\n", cmd)
+			}
+			return nil
+		})
+
+	dae.runCommand(context.Background(), exec, "srv", cmd)
+}
+
+func TestRunCommandSkipsUnreportableCommand(t *testing.T) {
+	dae, database := testNewMockDaemon(t)
+	exec := &testExecutor{}
+	cmd := db.Command{ID: "cmd", Command: "list", RequestedBy: "owner"}
+
+	database.EXPECT().GetServerOwners(gomock.Any(), "srv").
+		Return([]string{"owner"}, nil)
+	database.EXPECT().UpdateCommand(gomock.Any(), "srv", gomock.Any()).
+		Return(fmt.Errorf("update failed"))
+
+	dae.runCommand(context.Background(), exec, "srv", cmd)
+	if len(exec.commands) != 0 {
+		t.Errorf("Expected no commands to run: %v\n", exec.commands)
+	}
+}
+
+func TestWatchCommandsStopsWhenUnsupported(t *testing.T) {
+	dae, database := testNewMockDaemon(t)
+	database.EXPECT().WatchCommands(gomock.Any(), "srv", gomock.Any()).
+		Return(db.ErrUnsupported)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		dae.watchCommands(context.Background(), &testExecutor{}, "srv")
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Fatal("Expected watchCommands to return")
+	}
+}
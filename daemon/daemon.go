@@ -2,11 +2,17 @@ package daemon
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"path"
 	"path/filepath"
 	"reflect"
+	"sync"
 	"time"
 
+	firestore "cloud.google.com/go/firestore"
 	"golang.org/x/oauth2"
 
 	"github.com/Coderlane/minecraft-sidecart/db"
@@ -16,81 +22,209 @@ import (
 
 var defaultPollInterval = time.Second * 5
 
+// shutdownTimeout bounds how long the daemon waits on final updates while
+// shutting down.
+var shutdownTimeout = time.Second * 10
+
+// uploadTimeout bounds each upload made while polling, so a hung database
+// call can not stop the server being polled. Two uploads fit within
+// stallTimeout.
+var uploadTimeout = time.Second * 20
+
 type Daemon struct {
-	ctx  context.Context
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	mgr     *serverManager
+	journal *journal
+	// activity is published to as the daemon works, see WatchActivity.
+	activity *activityBus
+
+	// auth is the authentication client the daemon was started with, other
+	// profiles are derived from it.
 	auth *firebase.Auth
-	db   db.Database
-	mgr  *serverManager
+	// openDatabase opens the database for a profile.
+	openDatabase func(*firebase.Auth) (db.Database, error)
+	profilesMtx  sync.Mutex
+	profiles     map[string]*profile
+	// refreshTokens refreshes each profile's token before it expires.
+	refreshTokens bool
+	// signInOptional is set when the database backend does not need
+	// profiles to be signed in.
+	signInOptional bool
+	// newServer connects to the server in a directory.
+	newServer func(string) (server.Server, error)
 }
 
 func NewDaemon(ctx context.Context,
 	app *firebase.App, auth *firebase.Auth) (*Daemon, error) {
-	store, err := app.NewFirestore(ctx, auth)
+	mgr, err := newServerManager()
 	if err != nil {
 		return nil, err
 	}
-	database, err := db.NewDatabase(ctx, store)
-	if err != nil {
-		return nil, err
+	dbCfg := mgr.cfg.Database
+	if dbCfg.Path == "" {
+		dbCfg.Path = path.Join(path.Dir(mgr.cfgPath), "local.db")
 	}
-	mgr, err := newServerManager()
+	openDatabase := func(auth *firebase.Auth) (db.Database, error) {
+		cfg := dbCfg
+		cfg.Firestore = func(ctx context.Context) (*firestore.Client, error) {
+			return app.NewFirestore(ctx, auth)
+		}
+		return db.Open(ctx, cfg)
+	}
+	database, err := openDatabase(auth)
 	if err != nil {
 		return nil, err
 	}
+	signInOptional := dbCfg.Backend != "" && dbCfg.Backend != db.DefaultBackend
+	if signInOptional {
+		// Only firestore connections are tied to a user, share the others
+		// between profiles.
+		openDatabase = func(*firebase.Auth) (db.Database, error) {
+			return database, nil
+		}
+	}
+	ctx, cancel := context.WithCancel(ctx)
 	dae := &Daemon{
-		ctx:  ctx,
-		auth: auth,
-		db:   database,
-		mgr:  mgr,
+		ctx:          ctx,
+		cancel:       cancel,
+		mgr:          mgr,
+		journal:      openJournal(path.Join(path.Dir(mgr.cfgPath), "journal.json")),
+		activity:     newActivityBus(),
+		auth:         auth,
+		openDatabase: openDatabase,
+		newServer:    server.NewServer,
+		profiles: map[string]*profile{
+			profileName(auth.Profile()): {
+				auth:           auth,
+				db:             database,
+				signInOptional: signInOptional,
+			},
+		},
+		refreshTokens:  true,
+		signInOptional: signInOptional,
+	}
+	for name, prof := range dae.profiles {
+		dae.keepFresh(name, prof)
 	}
 	for id, srv := range mgr.servers {
 		dae.monitorServer(srv, id)
 	}
+	dae.wg.Add(1)
+	go func() {
+		defer dae.wg.Done()
+		dae.retryJournal(ctx)
+	}()
 	return dae, nil
 }
 
-func (dae *Daemon) requireAuth() error {
-	if dae.auth.CurrentUser() == nil {
-		return fmt.Errorf("user is not authenticated")
-	}
-	return nil
+// SignInSpec signs a profile in to the daemon. An empty profile is the
+// default profile.
+type SignInSpec struct {
+	Profile string         `json:"profile"`
+	User    *firebase.User `json:"user"`
 }
 
 func (dae *Daemon) SignIn(
-	user *firebase.User, token *oauth2.Token) (err error) {
-	_, err = dae.auth.SignInWithUser(dae.ctx, user)
+	spec SignInSpec, token *oauth2.Token) (err error) {
+	prof, err := dae.profile(spec.Profile)
+	if err != nil {
+		return err
+	}
+	if spec.User == nil {
+		return invalidRequest("a user is required")
+	}
+	_, err = prof.auth.SignInWithUser(dae.ctx, spec.User)
+	if errors.Is(err, firebase.ErrReauthRequired) {
+		return newRequestError(http.StatusUnauthorized, "%w", err)
+	}
+	if err == nil {
+		// Upload anything that queued up while signed out.
+		dae.journal.wake()
+	}
 	return err
 }
 
+// SignOutSpec signs a profile out of the daemon. An empty profile is the
+// default profile.
+type SignOutSpec struct {
+	Profile string `json:"profile"`
+}
+
+// SignOut signs the profile out so that its servers stop uploading. The ids of
+// the servers using the profile, which are now unauthenticated, are returned.
+func (dae *Daemon) SignOut(spec SignOutSpec, ids *[]string) error {
+	prof, err := dae.profile(spec.Profile)
+	if err != nil {
+		return err
+	}
+	prof.auth.SignOut()
+	*ids = dae.mgr.profileServers(profileName(spec.Profile))
+	return nil
+}
+
+// WhoAmISpec selects the profile to describe. An empty profile is the
+// default profile.
+type WhoAmISpec struct {
+	Profile string `json:"profile"`
+}
+
+// WhoAmI reports the user the daemon is running as for a profile. The
+// refresh token is not included.
+func (dae *Daemon) WhoAmI(
+	spec WhoAmISpec, status *firebase.AuthStatus) error {
+	prof, err := dae.profile(spec.Profile)
+	if err != nil {
+		return err
+	}
+	*status = prof.auth.Status()
+	if status.User != nil {
+		user := *status.User
+		user.RefreshToken = ""
+		status.User = &user
+	}
+	return nil
+}
+
+// ServerSpec describes a server to add. The server uploads with the named
+// auth profile, or the default profile if none is set.
 type ServerSpec struct {
-	Path string
-	Name string
+	Path    string `json:"path"`
+	Name    string `json:"name"`
+	Profile string `json:"profile"`
 }
 
 func (dae *Daemon) AddServer(
 	spec ServerSpec, id *string) (err error) {
-	if err := dae.requireAuth(); err != nil {
+	prof, err := dae.profile(spec.Profile)
+	if err != nil {
+		return err
+	}
+	owner, err := prof.owner()
+	if err != nil {
 		return err
 	}
 	// Avoid collision
 	if !filepath.IsAbs(spec.Path) {
-		return fmt.Errorf("server path must be absolute")
+		return invalidRequest("server path must be absolute")
 	}
 	if dae.mgr.hasPath(spec.Path) {
-		return fmt.Errorf("server with path already exists")
+		return newRequestError(http.StatusConflict,
+			"server with path already exists")
 	}
 	// Setup a new server
-	srv, err := server.NewServer(spec.Path)
+	srv, err := dae.newServer(spec.Path)
 	if err != nil {
-		return err
+		return invalidRequest("%w", err)
 	}
-	tmpID, err := dae.db.CreateServer(dae.ctx,
-		dae.auth.CurrentUser().UserID, spec.Name,
+	tmpID, err := prof.db.CreateServer(dae.ctx, owner, spec.Name,
 		server.GetType(srv), srv.GetServerInfo())
 	if err != nil {
 		return err
 	}
-	err = dae.mgr.addServer(tmpID, spec.Path, srv)
+	err = dae.mgr.addServer(tmpID, spec.Path, spec.Name,
+		profileName(spec.Profile), srv)
 	if err != nil {
 		return err
 	}
@@ -99,26 +233,234 @@ func (dae *Daemon) AddServer(
 	return nil
 }
 
-type serverUpdate struct {
-	ID   string
-	Info interface{}
+// RemoveServerSpec selects a server to stop monitoring by its ID or its path.
+// Delete removes the server from the database entirely while Archive only
+// marks it as archived. If neither is set the database is left untouched.
+type RemoveServerSpec struct {
+	ID      string `json:"id"`
+	Path    string `json:"path"`
+	Delete  bool   `json:"delete"`
+	Archive bool   `json:"archive"`
+}
+
+func (dae *Daemon) RemoveServer(
+	spec RemoveServerSpec, id *string) (err error) {
+	if spec.Delete && spec.Archive {
+		return invalidRequest("can not both delete and archive a server")
+	}
+	tmpID := spec.ID
+	switch {
+	case tmpID != "" && spec.Path != "":
+		return invalidRequest("specify either a server id or a path, not both")
+	case tmpID != "":
+		if !dae.mgr.hasID(tmpID) {
+			return unknownServer(tmpID)
+		}
+	case spec.Path != "":
+		var ok bool
+		if tmpID, ok = dae.mgr.findPath(spec.Path); !ok {
+			return newRequestError(http.StatusNotFound,
+				"no server with path: %s", spec.Path)
+		}
+	default:
+		return invalidRequest("a server id or path is required")
+	}
+	if spec.Delete || spec.Archive {
+		database, err := dae.dbFor(tmpID)
+		if err != nil {
+			return err
+		}
+		if spec.Delete {
+			err = database.DeleteServer(dae.ctx, tmpID)
+		} else {
+			err = database.ArchiveServer(dae.ctx, tmpID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err = dae.mgr.removeServer(tmpID); err != nil {
+		return err
+	}
+	// The monitor has stopped, so nothing journals another update.
+	if err = dae.journal.forget(tmpID); err != nil {
+		fmt.Printf("Failed to drop journal entry for %s: %v\n", tmpID, err)
+	}
+	*id = tmpID
+	return nil
+}
+
+// MoveServerSpec points an existing server at a new path.
+type MoveServerSpec struct {
+	ID   string `json:"id"`
+	Path string `json:"path"`
+}
+
+func (dae *Daemon) MoveServer(
+	spec MoveServerSpec, id *string) (err error) {
+	if !filepath.IsAbs(spec.Path) {
+		return invalidRequest("server path must be absolute")
+	}
+	if !dae.mgr.hasID(spec.ID) {
+		return unknownServer(spec.ID)
+	}
+	if dae.mgr.hasPath(spec.Path) {
+		return newRequestError(http.StatusConflict,
+			"server with path already exists")
+	}
+	srv, err := dae.newServer(spec.Path)
+	if err != nil {
+		return invalidRequest("%w", err)
+	}
+	if err = dae.mgr.moveServer(spec.ID, spec.Path, srv); err != nil {
+		return err
+	}
+	dae.monitorServer(srv, spec.ID)
+	*id = spec.ID
+	return nil
+}
+
+// ListServersSpec filters the servers returned by ListServers. An empty ID
+// returns every server.
+type ListServersSpec struct {
+	ID string `json:"id"`
+}
+
+// ServerStatus describes a server watched by the daemon along with the
+// results of the most recent poll and upload.
+type ServerStatus struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	Profile string `json:"profile"`
+	// Authenticated is false if the server's profile is signed out, its
+	// updates are journaled until the profile signs in again.
+	Authenticated bool `json:"authenticated"`
+	// ReauthRequired is set if the profile's refresh token was rejected.
+	ReauthRequired bool        `json:"reauth_required"`
+	Type           server.Type `json:"type"`
+	Info           interface{} `json:"info"`
+	LastUpload     time.Time   `json:"last_upload"`
+	LastError      string      `json:"last_error"`
+}
+
+func (dae *Daemon) ListServers(
+	spec ListServersSpec, statuses *[]ServerStatus) (err error) {
+	tmpStatuses := dae.mgr.listServers(spec.ID)
+	if spec.ID != "" && len(tmpStatuses) == 0 {
+		return unknownServer(spec.ID)
+	}
+	for i := range tmpStatuses {
+		_, err := dae.dbFor(tmpStatuses[i].ID)
+		tmpStatuses[i].Authenticated = err == nil
+		tmpStatuses[i].ReauthRequired = errors.Is(err, firebase.ErrReauthRequired)
+	}
+	*statuses = tmpStatuses
+	return nil
 }
 
 func (dae *Daemon) monitorServer(srv server.Server, id string) {
-	go func() {
-		ticker := time.NewTicker(defaultPollInterval)
-		var lastInfo interface{}
-		for {
-			select {
-			case <-ticker.C:
-				info := srv.GetServerInfo()
-				if reflect.DeepEqual(info, lastInfo) {
-					continue
-				}
-				fmt.Printf("Updating server info for: %s\n", id)
-				dae.db.UpdateServerInfo(dae.ctx, id, info)
-				lastInfo = info
-			}
+	mon := newMonitor(dae.ctx)
+	dae.mgr.setMonitor(id, mon)
+	mon.spawn(func(ctx context.Context) {
+		dae.pollServer(ctx, mon, srv, id)
+	})
+	mon.spawn(func(ctx context.Context) {
+		dae.collectMetrics(ctx, mon, srv, id)
+	})
+	if exec, ok := srv.(server.CommandExecutor); ok {
+		mon.spawn(func(ctx context.Context) {
+			dae.watchCommands(ctx, exec, id)
+		})
+	}
+	if watcher, ok := srv.(server.EventWatcher); ok {
+		mon.spawn(func(ctx context.Context) {
+			dae.watchEvents(ctx, mon, watcher, id)
+		})
+	}
+}
+
+func (dae *Daemon) pollServer(ctx context.Context,
+	mon *monitor, srv server.Server, id string) {
+	ticker := time.NewTicker(defaultPollInterval)
+	defer ticker.Stop()
+	var lastInfo interface{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-mon.refresh:
+		case <-ticker.C:
 		}
-	}()
+		info := srv.GetServerInfo()
+		mon.setInfo(info)
+		dae.publish(ActivityPoll, id, "polled server")
+		sessions := mon.sessions.observe(info, time.Now())
+		uploadCtx, cancel := context.WithTimeout(ctx, uploadTimeout)
+		dae.recordSessions(uploadCtx, id, sessions)
+		cancel()
+		if reflect.DeepEqual(info, lastInfo) {
+			continue
+		}
+		dae.publish(ActivityChange, id, "%s", describeChange(lastInfo, info))
+		fmt.Printf("Updating server info for: %s\n", id)
+		uploadCtx, cancel = context.WithTimeout(ctx, uploadTimeout)
+		err := dae.uploadInfo(uploadCtx, id, srv, info)
+		cancel()
+		mon.setUploadResult(err)
+		if err != nil {
+			dae.publish(ActivityError, id, "failed to upload server info: %v", err)
+		} else {
+			dae.publish(ActivityUpload, id, "uploaded server info")
+		}
+		lastInfo = info
+	}
+}
+
+// shutdown stops monitoring every server and pushes a final offline update
+// for each of them. Offline updates which fail are journaled and uploaded
+// the next time the daemon runs.
+func (dae *Daemon) shutdown() {
+	monitors := dae.mgr.stopMonitors()
+	dae.cancel()
+	dae.wg.Wait()
+	// The daemon context is canceled, use a fresh one.
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for id, srv := range dae.mgr.activeServers() {
+		info := server.GetOfflineServerInfo(srv)
+		if info == nil {
+			continue
+		}
+		fmt.Printf("Marking server offline: %s\n", id)
+		if err := dae.uploadInfo(ctx, id, srv, info); err != nil {
+			dae.reportError(id, "Failed to mark server %s offline: %v", id, err)
+		}
+	}
+	now := time.Now()
+	for id, mon := range monitors {
+		dae.recordSessions(ctx, id, mon.sessions.closeAll(now))
+		if failed := dae.mergeRollups(ctx, id, mon.metrics.flush()); len(failed) > 0 {
+			fmt.Printf("Dropping %d metric rollups for %s\n", len(failed), id)
+		}
+	}
+	dae.closeDatabases()
+}
+
+// closeDatabases closes the databases which hold resources, like the local
+// backend's file lock.
+func (dae *Daemon) closeDatabases() {
+	dae.profilesMtx.Lock()
+	defer dae.profilesMtx.Unlock()
+	closed := make(map[db.Database]bool)
+	for _, prof := range dae.profiles {
+		closer, ok := prof.db.(io.Closer)
+		if !ok || closed[prof.db] {
+			continue
+		}
+		closed[prof.db] = true
+		if err := closer.Close(); err != nil {
+			dae.reportError("", "Failed to close the database: %v", err)
+		}
+	}
 }
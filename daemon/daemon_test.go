@@ -3,14 +3,21 @@ package daemon
 import (
 	"context"
 	"encoding/json"
+	"io"
 	"os"
+	"os/user"
+	"path"
 	"testing"
 	"time"
 
+	"github.com/golang/mock/gomock"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/jws"
 
+	"github.com/Coderlane/minecraft-sidecart/db"
 	"github.com/Coderlane/minecraft-sidecart/firebase"
+	"github.com/Coderlane/minecraft-sidecart/server"
+	"github.com/Coderlane/minecraft-sidecart/server/minecraft"
 )
 
 func testIdToken(t *testing.T) string {
@@ -59,7 +66,7 @@ func testNewUnauthDaemon(t *testing.T, ctx context.Context) (*Daemon, *firebase.
 func testNewDaemon(t *testing.T, ctx context.Context) *Daemon {
 	dae, user := testNewUnauthDaemon(t, ctx)
 	var token oauth2.Token
-	err := dae.SignIn(user, &token)
+	err := dae.SignIn(SignInSpec{User: user}, &token)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -75,7 +82,7 @@ func TestDaemonSignIn(t *testing.T) {
 	dae, user := testNewUnauthDaemon(t, ctx)
 
 	var token oauth2.Token
-	err := dae.SignIn(user, &token)
+	err := dae.SignIn(SignInSpec{User: user}, &token)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -99,3 +106,212 @@ func TestDaemonAddServerMonitorsServer(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestDaemonRemoveServer(t *testing.T) {
+	testDir := t.TempDir()
+	restore := testAddConfigPath(testDir)
+	defer restore()
+
+	ctx := context.Background()
+	dae := testNewDaemon(t, ctx)
+
+	testCreateTestServer(t, testDir)
+	var id string
+	err := dae.AddServer(ServerSpec{Path: testDir}, &id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var removedID string
+	err = dae.RemoveServer(RemoveServerSpec{Path: testDir}, &removedID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removedID != id {
+		t.Errorf("Expected: %s Got: %s\n", id, removedID)
+	}
+	if dae.mgr.hasPath(testDir) {
+		t.Errorf("Expected server to be removed")
+	}
+
+	err = dae.RemoveServer(RemoveServerSpec{ID: id}, &removedID)
+	if err == nil {
+		t.Errorf("Expected to fail to remove an unknown server")
+	}
+}
+
+func TestDaemonListServers(t *testing.T) {
+	testDir := t.TempDir()
+	restore := testAddConfigPath(testDir)
+	defer restore()
+
+	ctx := context.Background()
+	dae := testNewDaemon(t, ctx)
+
+	testCreateTestServer(t, testDir)
+	var id string
+	err := dae.AddServer(ServerSpec{Path: testDir, Name: "test"}, &id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var statuses []ServerStatus
+	err = dae.ListServers(ListServersSpec{}, &statuses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 {
+		t.Fatalf("Expected one server, got: %v\n", statuses)
+	}
+	if statuses[0].ID != id || statuses[0].Name != "test" {
+		t.Errorf("Unexpected server status: %+v\n", statuses[0])
+	}
+
+	err = dae.ListServers(ListServersSpec{ID: "unknown"}, &statuses)
+	if err == nil {
+		t.Errorf("Expected to fail to list an unknown server")
+	}
+}
+
+func TestDaemonMoveServer(t *testing.T) {
+	testDir := t.TempDir()
+	restore := testAddConfigPath(testDir)
+	defer restore()
+
+	ctx := context.Background()
+	dae := testNewDaemon(t, ctx)
+
+	oldDir := path.Join(testDir, "old")
+	newDir := path.Join(testDir, "new")
+	testCreateTestServer(t, oldDir)
+	testCreateTestServer(t, newDir)
+	var id string
+	err := dae.AddServer(ServerSpec{Path: oldDir}, &id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var movedID string
+	err = dae.MoveServer(MoveServerSpec{ID: id, Path: newDir}, &movedID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dae.mgr.hasPath(oldDir) || !dae.mgr.hasPath(newDir) {
+		t.Errorf("Expected server to move to %s\n", newDir)
+	}
+
+	err = dae.MoveServer(MoveServerSpec{ID: id, Path: newDir}, &movedID)
+	if err == nil {
+		t.Errorf("Expected to fail to move a server to a duplicate path")
+	}
+}
+
+func TestDaemonShutdownStopsMonitors(t *testing.T) {
+	testDir := t.TempDir()
+	restore := testAddConfigPath(testDir)
+	defer restore()
+
+	testCreateTestServer(t, testDir)
+	mgr, err := newServerManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = mgr.addServer("test", testDir, "test", "", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	app := &firebase.App{ProjectID: "test"}
+	dae, err := NewDaemon(context.Background(), app, app.NewAuth())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mon, ok := dae.mgr.monitors["test"]
+	if !ok {
+		t.Fatal("Expected server to be monitored")
+	}
+
+	dae.shutdown()
+	if mon.ctx.Err() == nil {
+		t.Errorf("Expected monitor to be stopped")
+	}
+	if len(dae.mgr.monitors) != 0 {
+		t.Errorf("Expected no monitors: %v\n", dae.mgr.monitors)
+	}
+}
+
+func TestDaemonShutdownClosesDatabase(t *testing.T) {
+	testDir := t.TempDir()
+	restore := testAddConfigPath(testDir)
+	defer restore()
+
+	mgr, err := newServerManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mgr.cfg.Database.Backend = "local"
+	if err := mgr.saveConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	app := &firebase.App{ProjectID: "test"}
+	dae, err := NewDaemon(context.Background(), app, app.NewAuth())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dae.shutdown()
+
+	database, err := db.NewLocalDatabase(path.Join(path.Dir(mgr.cfgPath), "local.db"))
+	if err != nil {
+		t.Fatalf("Expected the database to be closed: %v\n", err)
+	}
+	database.(io.Closer).Close()
+}
+
+func TestDaemonLocalBackendSkipsSignIn(t *testing.T) {
+	testDir := t.TempDir()
+	restore := testAddConfigPath(testDir)
+	defer restore()
+
+	mgr, err := newServerManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mgr.cfg.Database.Backend = "local"
+	if err := mgr.saveConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	app := &firebase.App{ProjectID: "test"}
+	auth := app.NewAuth(firebase.WithUserCache(&firebase.MemoryUserCache{}))
+	dae, err := NewDaemon(context.Background(), app, auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dae.shutdown()
+	// Don't ping a real server.
+	srv := server.NewMockServer(gomock.NewController(t))
+	srv.EXPECT().GetServerInfo().Return(minecraft.ServerInfo{}).AnyTimes()
+	dae.newServer = func(string) (server.Server, error) {
+		return srv, nil
+	}
+
+	var id string
+	if err := dae.AddServer(ServerSpec{Path: t.TempDir()}, &id); err != nil {
+		t.Fatal(err)
+	}
+	database, err := dae.dbFor(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	owners, err := database.GetServerOwners(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(owners) != 1 || owners[0] != localOwnerPrefix+current.Username {
+		t.Errorf("Unexpected owners: %v\n", owners)
+	}
+}
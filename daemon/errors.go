@@ -0,0 +1,48 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// requestError is an RPC error caused by the request rather than a failure
+// of the daemon, like an unknown server id. The HTTP API responds with its
+// code, any other error is an internal server error.
+type requestError struct {
+	code int
+	err  error
+}
+
+func (err *requestError) Error() string {
+	return err.err.Error()
+}
+
+func (err *requestError) Unwrap() error {
+	return err.err
+}
+
+// newRequestError formats an error, like fmt.Errorf, which the HTTP API
+// reports with code.
+func newRequestError(code int, format string, args ...interface{}) error {
+	return &requestError{code: code, err: fmt.Errorf(format, args...)}
+}
+
+// invalidRequest formats an error for a request the daemon can not accept.
+func invalidRequest(format string, args ...interface{}) error {
+	return newRequestError(http.StatusBadRequest, format, args...)
+}
+
+// unknownServer reports that the daemon is not watching a server.
+func unknownServer(id string) error {
+	return newRequestError(http.StatusNotFound, "unknown server: %s", id)
+}
+
+// errorStatus returns the HTTP status for an RPC error.
+func errorStatus(err error) int {
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		return reqErr.code
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,123 @@
+package daemon
+
+import (
+	"context"
+	"time"
+
+	"github.com/Coderlane/minecraft-sidecart/db"
+	"github.com/Coderlane/minecraft-sidecart/server"
+	"github.com/Coderlane/minecraft-sidecart/server/minecraft"
+)
+
+var (
+	// eventBurst is how many events a server may upload at once.
+	eventBurst = 30
+	// eventInterval is how often a server earns another upload, up to
+	// eventBurst.
+	eventInterval = 2 * time.Second
+	// warningWindow is how long a warning is remembered, repeats within it are
+	// not uploaded.
+	warningWindow = 10 * time.Minute
+)
+
+// eventLimiter keeps a noisy server from flooding the database with events.
+// Uploads are rate limited with a token bucket and repeated warnings are
+// dropped.
+type eventLimiter struct {
+	tokens   float64
+	last     time.Time
+	warnings map[string]time.Time
+	dropped  int
+}
+
+func newEventLimiter(now time.Time) *eventLimiter {
+	return &eventLimiter{
+		tokens:   float64(eventBurst),
+		last:     now,
+		warnings: make(map[string]time.Time),
+	}
+}
+
+// allow reports whether the event should be uploaded.
+func (el *eventLimiter) allow(event minecraft.Event, now time.Time) bool {
+	el.tokens += float64(now.Sub(el.last)) / float64(eventInterval)
+	if el.tokens > float64(eventBurst) {
+		el.tokens = float64(eventBurst)
+	}
+	el.last = now
+	if event.Type == minecraft.EventWarning {
+		for message, seen := range el.warnings {
+			if now.Sub(seen) > warningWindow {
+				delete(el.warnings, message)
+			}
+		}
+		if _, ok := el.warnings[event.Message]; ok {
+			return false
+		}
+	}
+	if el.tokens < 1 {
+		el.dropped++
+		return false
+	}
+	el.tokens--
+	if event.Type == minecraft.EventWarning {
+		el.warnings[event.Message] = now
+	}
+	return true
+}
+
+// takeDropped returns how many events were dropped by the rate limit since
+// it was last called.
+func (el *eventLimiter) takeDropped() int {
+	dropped := el.dropped
+	el.dropped = 0
+	return dropped
+}
+
+// watchEvents uploads events reported by the server until ctx is canceled.
+// Events which change the server info, like players joining, also trigger an
+// immediate poll so they aren't missed between intervals. Uploads are rate
+// limited, see eventLimiter, and bounded by uploadTimeout like uploads made
+// while polling.
+func (dae *Daemon) watchEvents(ctx context.Context,
+	mon *monitor, watcher server.EventWatcher, id string) {
+	limiter := newEventLimiter(time.Now())
+	for event := range watcher.WatchEvents(ctx) {
+		switch event.Type {
+		case minecraft.EventPlayerJoin:
+			mon.sessions.join(event.Player, event.Time)
+		case minecraft.EventPlayerLeave:
+			if session, ok := mon.sessions.leave(event.Player, event.Time); ok {
+				uploadCtx, cancel := context.WithTimeout(ctx, uploadTimeout)
+				dae.recordSessions(uploadCtx, id, []db.Session{session})
+				cancel()
+			}
+		case minecraft.EventServerStop:
+			uploadCtx, cancel := context.WithTimeout(ctx, uploadTimeout)
+			dae.recordSessions(uploadCtx, id, mon.sessions.closeAll(event.Time))
+			cancel()
+		}
+		switch event.Type {
+		case minecraft.EventPlayerJoin, minecraft.EventPlayerLeave,
+			minecraft.EventServerStart, minecraft.EventServerStop:
+			mon.requestRefresh()
+		}
+		if !limiter.allow(event, time.Now()) {
+			continue
+		}
+		if dropped := limiter.takeDropped(); dropped > 0 {
+			dae.reportError(id, "Dropped %d events for %s, it is logging "+
+				"too quickly", dropped, id)
+		}
+		database, err := dae.dbFor(id)
+		if err != nil {
+			continue
+		}
+		uploadCtx, cancel := context.WithTimeout(ctx, uploadTimeout)
+		err = database.AddServerEvent(uploadCtx, id, event)
+		cancel()
+		if err != nil {
+			dae.reportError(id, "Failed to upload event for %s: %v", id, err)
+		}
+	}
+}
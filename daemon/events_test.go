@@ -0,0 +1,137 @@
+package daemon
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/Coderlane/minecraft-sidecart/db"
+	"github.com/Coderlane/minecraft-sidecart/server/minecraft"
+)
+
+type testEventWatcher struct {
+	events chan minecraft.Event
+}
+
+func (tew *testEventWatcher) WatchEvents(
+	ctx context.Context) <-chan minecraft.Event {
+	return tew.events
+}
+
+func TestWatchEventsUploadsEvents(t *testing.T) {
+	dae, database := testNewMockDaemon(t)
+	watcher := &testEventWatcher{events: make(chan minecraft.Event, 2)}
+	mon := newMonitor(context.Background())
+
+	join := minecraft.Event{Type: minecraft.EventPlayerJoin, Player: "Steve"}
+	chat := minecraft.Event{Type: minecraft.EventChat, Player: "Steve"}
+	watcher.events <- join
+	watcher.events <- chat
+	close(watcher.events)
+	gomock.InOrder(
+		database.EXPECT().AddServerEvent(gomock.Any(), "srv", join),
+		database.EXPECT().AddServerEvent(gomock.Any(), "srv", chat),
+	)
+
+	dae.watchEvents(context.Background(), mon, watcher, "srv")
+	select {
+	case <-mon.refresh:
+	case <-time.After(time.Second):
+		t.Errorf("Expected a join to request a refresh")
+	}
+}
+
+func TestWatchEventsTimesOutUploads(t *testing.T) {
+	defer func(timeout time.Duration) { uploadTimeout = timeout }(uploadTimeout)
+	uploadTimeout = 50 * time.Millisecond
+
+	dae, database := testNewMockDaemon(t)
+	watcher := &testEventWatcher{events: make(chan minecraft.Event, 2)}
+	mon := newMonitor(context.Background())
+
+	watcher.events <- minecraft.Event{Type: minecraft.EventChat, Player: "Steve"}
+	watcher.events <- minecraft.Event{Type: minecraft.EventChat, Player: "Alex"}
+	close(watcher.events)
+	// Each upload hangs until its context is done.
+	database.EXPECT().AddServerEvent(gomock.Any(), "srv", gomock.Any()).
+		DoAndReturn(func(ctx context.Context, _ string, _ interface{}) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}).Times(2)
+
+	done := make(chan struct{})
+	go func() {
+		dae.watchEvents(context.Background(), mon, watcher, "srv")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(uploadTimeout * 10):
+		t.Fatal("Expected hung uploads to time out")
+	}
+}
+
+func TestWatchEventsRecordsSessions(t *testing.T) {
+	dae, database := testNewMockDaemon(t)
+	watcher := &testEventWatcher{events: make(chan minecraft.Event, 2)}
+	mon := newMonitor(context.Background())
+
+	now := time.Now()
+	join := minecraft.Event{Time: now,
+		Type: minecraft.EventPlayerJoin, Player: "Steve"}
+	leave := minecraft.Event{Time: now.Add(time.Minute),
+		Type: minecraft.EventPlayerLeave, Player: "Steve"}
+	watcher.events <- join
+	watcher.events <- leave
+	close(watcher.events)
+	database.EXPECT().AddServerEvent(gomock.Any(), "srv", gomock.Any()).Times(2)
+	database.EXPECT().RecordSession(gomock.Any(), "srv", gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ string, session db.Session) error {
+			if session.PlayerName != "Steve" || session.DurationSeconds != 60 {
+				t.Errorf("Unexpected session: %+v\n", session)
+			}
+			return nil
+		})
+
+	dae.watchEvents(context.Background(), mon, watcher, "srv")
+}
+
+func TestEventLimiterDropsRepeatedWarnings(t *testing.T) {
+	now := time.Now()
+	limiter := newEventLimiter(now)
+	warning := minecraft.Event{Type: minecraft.EventWarning, Message: "Can't keep up!"}
+	if !limiter.allow(warning, now) {
+		t.Fatal("Expected the first warning to be uploaded")
+	}
+	if limiter.allow(warning, now.Add(time.Minute)) {
+		t.Error("Expected the repeated warning to be dropped")
+	}
+	if !limiter.allow(warning, now.Add(warningWindow+time.Minute)) {
+		t.Error("Expected the warning to be uploaded once the window passed")
+	}
+	if dropped := limiter.takeDropped(); dropped != 0 {
+		t.Errorf("Expected repeats not to count as dropped, got %d", dropped)
+	}
+}
+
+func TestEventLimiterRateLimits(t *testing.T) {
+	now := time.Now()
+	limiter := newEventLimiter(now)
+	chat := minecraft.Event{Type: minecraft.EventChat, Player: "Steve"}
+	for i := 0; i < eventBurst; i++ {
+		if !limiter.allow(chat, now) {
+			t.Fatalf("Expected event %d of the burst to be uploaded", i)
+		}
+	}
+	if limiter.allow(chat, now) {
+		t.Error("Expected events past the burst to be dropped")
+	}
+	if !limiter.allow(chat, now.Add(eventInterval)) {
+		t.Error("Expected an upload once the interval passed")
+	}
+	if dropped := limiter.takeDropped(); dropped != 1 {
+		t.Errorf("Expected one dropped event, got %d", dropped)
+	}
+}
@@ -0,0 +1,346 @@
+package daemon
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/Coderlane/minecraft-sidecart/firebase"
+)
+
+// apiTokenName is the file, next to the daemon config, holding the bearer
+// token for the HTTP API.
+const apiTokenName = "api-token"
+
+// maxRequestSize bounds the size of HTTP API request bodies.
+const maxRequestSize = 1 << 20
+
+// eventKeepAlive is how often an idle event stream sends a comment.
+var eventKeepAlive = 15 * time.Second
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+// httpAPI exposes the Daemon's RPCs as a JSON API. It is described by
+// openapi.json, served at /v1/openapi.json.
+type httpAPI struct {
+	daemon *Daemon
+	token  string
+}
+
+func newHTTPAPI(dae *Daemon, token string) http.Handler {
+	api := &httpAPI{daemon: dae, token: token}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/servers", api.servers)
+	mux.HandleFunc("/v1/servers/", api.server)
+	mux.HandleFunc("/v1/auth/status", api.authStatus)
+	mux.HandleFunc("/v1/auth/signin", api.signIn)
+	mux.HandleFunc("/v1/auth/signout", api.signOut)
+	mux.HandleFunc("/v1/events", api.events)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The description is public, everything else needs the token.
+		if r.URL.Path == "/v1/openapi.json" {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(openAPISpec)
+			return
+		}
+		if !api.authorized(r) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeAPIError(w, http.StatusUnauthorized,
+				fmt.Errorf("a valid bearer token is required"))
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func (api *httpAPI) authorized(r *http.Request) bool {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return false
+	}
+	token := strings.TrimPrefix(header, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(api.token)) == 1
+}
+
+// loadAPIToken reads the HTTP API token, generating it the first time.
+func loadAPIToken(tokenPath string) (string, error) {
+	data, err := ioutil.ReadFile(tokenPath)
+	if err == nil {
+		if token := strings.TrimSpace(string(data)); token != "" {
+			return token, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+	secret := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, secret); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(secret)
+	if err := os.MkdirAll(path.Dir(tokenPath), 0700); err != nil {
+		return "", err
+	}
+	return token, ioutil.WriteFile(tokenPath, []byte(token+"\n"), 0600)
+}
+
+// servers handles /v1/servers.
+func (api *httpAPI) servers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		var statuses []ServerStatus
+		spec := ListServersSpec{ID: r.URL.Query().Get("id")}
+		api.respond(w, http.StatusOK,
+			api.daemon.ListServers(spec, &statuses), statuses)
+	case http.MethodPost:
+		var spec ServerSpec
+		if !decodeAPIRequest(w, r, &spec) {
+			return
+		}
+		var id string
+		api.respond(w, http.StatusCreated,
+			api.daemon.AddServer(spec, &id), idResponse{ID: id})
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// server handles /v1/servers/{id} and /v1/servers/{id}/move.
+func (api *httpAPI) server(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/servers/"), "/")
+	id := parts[0]
+	if id == "" || len(parts) > 2 || (len(parts) == 2 && parts[1] != "move") {
+		http.NotFound(w, r)
+		return
+	}
+	if !api.daemon.mgr.hasID(id) {
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf("unknown server: %s", id))
+		return
+	}
+
+	if len(parts) == 2 {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		var spec MoveServerSpec
+		if !decodeAPIRequest(w, r, &spec) {
+			return
+		}
+		spec.ID = id
+		var movedID string
+		api.respond(w, http.StatusOK,
+			api.daemon.MoveServer(spec, &movedID), idResponse{ID: movedID})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		var statuses []ServerStatus
+		err := api.daemon.ListServers(ListServersSpec{ID: id}, &statuses)
+		if err != nil {
+			writeAPIError(w, errorStatus(err), err)
+			return
+		}
+		writeAPIResponse(w, http.StatusOK, statuses[0])
+	case http.MethodDelete:
+		query := r.URL.Query()
+		spec := RemoveServerSpec{
+			ID:      id,
+			Delete:  query.Get("delete") == "true",
+			Archive: query.Get("archive") == "true",
+		}
+		var removedID string
+		api.respond(w, http.StatusOK,
+			api.daemon.RemoveServer(spec, &removedID), idResponse{ID: removedID})
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodDelete)
+	}
+}
+
+// authStatus handles /v1/auth/status.
+func (api *httpAPI) authStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	var status firebase.AuthStatus
+	spec := WhoAmISpec{Profile: r.URL.Query().Get("profile")}
+	api.respond(w, http.StatusOK, api.daemon.WhoAmI(spec, &status), status)
+}
+
+// signIn handles /v1/auth/signin.
+func (api *httpAPI) signIn(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	var spec SignInSpec
+	if !decodeAPIRequest(w, r, &spec) {
+		return
+	}
+	var token oauth2.Token
+	if err := api.daemon.SignIn(spec, &token); err != nil {
+		writeAPIError(w, errorStatus(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// signOut handles /v1/auth/signout.
+func (api *httpAPI) signOut(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	var spec SignOutSpec
+	if !decodeAPIRequest(w, r, &spec) {
+		return
+	}
+	var ids []string
+	api.respond(w, http.StatusOK, api.daemon.SignOut(spec, &ids),
+		signOutResponse{Servers: ids})
+}
+
+// events handles /v1/events, streaming activity as server-sent events. A
+// reconnecting client resumes after the Last-Event-ID it sends.
+func (api *httpAPI) events(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeAPIError(w, http.StatusInternalServerError,
+			fmt.Errorf("streaming is not supported"))
+		return
+	}
+	after := r.Header.Get("Last-Event-ID")
+	if after == "" {
+		after = r.URL.Query().Get("after")
+	}
+	seq, err := api.parseEventID(after)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		activities, wake := api.daemon.activity.since(seq)
+		for _, activity := range activities {
+			data, err := json.Marshal(activity)
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(w, "id: %s-%d\nevent: %s\ndata: %s\n\n",
+				api.daemon.activity.epoch, activity.Seq, activity.Type, data)
+			seq = activity.Seq
+		}
+		flusher.Flush()
+		select {
+		case <-wake:
+		case <-keepAlive.C:
+			// Comments keep idle connections from being closed.
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			return
+		case <-api.daemon.ctx.Done():
+			return
+		}
+	}
+}
+
+// parseEventID returns the sequence number to resume streaming after. Event
+// ids are the daemon's epoch and the activity's sequence number, an id from
+// before the daemon restarted resumes from the start. A bare sequence number
+// is from this daemon.
+func (api *httpAPI) parseEventID(id string) (uint64, error) {
+	if id == "" {
+		return 0, nil
+	}
+	seqPart := id
+	if i := strings.LastIndex(id, "-"); i >= 0 {
+		if id[:i] != api.daemon.activity.epoch {
+			return 0, nil
+		}
+		seqPart = id[i+1:]
+	}
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid event id: %s", id)
+	}
+	return seq, nil
+}
+
+type idResponse struct {
+	ID string `json:"id"`
+}
+
+type signOutResponse struct {
+	Servers []string `json:"servers"`
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// respond writes resp with code, or err if the RPC failed. Errors caused by
+// the request are a 4xx, others are an internal server error.
+func (api *httpAPI) respond(w http.ResponseWriter,
+	code int, err error, resp interface{}) {
+	if err != nil {
+		writeAPIError(w, errorStatus(err), err)
+		return
+	}
+	writeAPIResponse(w, code, resp)
+}
+
+// decodeAPIRequest decodes the JSON body in to spec. An empty body leaves
+// spec unchanged. On failure an error is written and false is returned.
+func decodeAPIRequest(w http.ResponseWriter,
+	r *http.Request, spec interface{}) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(spec); err != nil && !errors.Is(err, io.EOF) {
+		writeAPIError(w, http.StatusBadRequest,
+			fmt.Errorf("invalid request body: %v", err))
+		return false
+	}
+	return true
+}
+
+func writeAPIResponse(w http.ResponseWriter, code int, resp interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func writeAPIError(w http.ResponseWriter, code int, err error) {
+	writeAPIResponse(w, code, apiError{Error: err.Error()})
+}
+
+func methodNotAllowed(w http.ResponseWriter, methods ...string) {
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeAPIError(w, http.StatusMethodNotAllowed,
+		fmt.Errorf("method not allowed"))
+}
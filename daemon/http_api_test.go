@@ -0,0 +1,204 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/Coderlane/minecraft-sidecart/firebase"
+)
+
+const testAPIToken = "test_api_token"
+
+func testHTTPAPI(t *testing.T) (*Daemon, *httptest.Server) {
+	t.Helper()
+	dae, _ := testNewMockDaemon(t)
+	srv := httptest.NewServer(newHTTPAPI(dae, testAPIToken))
+	t.Cleanup(srv.Close)
+	return dae, srv
+}
+
+// testAPIRequest sends an authorized request and decodes the response in to
+// resp, if not nil.
+func testAPIRequest(t *testing.T, srv *httptest.Server, method, url, body string,
+	resp interface{}) int {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testAPIToken)
+	httpResp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer httpResp.Body.Close()
+	if resp != nil {
+		if err := json.NewDecoder(httpResp.Body).Decode(resp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return httpResp.StatusCode
+}
+
+func TestHTTPAPIRequiresToken(t *testing.T) {
+	_, srv := testHTTPAPI(t)
+	for _, auth := range []string{"", "Bearer wrong", testAPIToken} {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/v1/servers", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected %q to be unauthorized: %s", auth, resp.Status)
+		}
+	}
+
+	resp, err := srv.Client().Get(srv.URL + "/v1/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the description to be public: %s", resp.Status)
+	}
+}
+
+func TestHTTPAPIServers(t *testing.T) {
+	dae, srv := testHTTPAPI(t)
+	var statuses []ServerStatus
+	if code := testAPIRequest(t, srv, http.MethodGet, "/v1/servers", "", &statuses); code != http.StatusOK || len(statuses) != 0 {
+		t.Fatalf("Expected no servers: %d %+v", code, statuses)
+	}
+
+	if err := dae.mgr.addServer("srv", t.TempDir(), "test", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	var status ServerStatus
+	if code := testAPIRequest(t, srv, http.MethodGet, "/v1/servers/srv", "", &status); code != http.StatusOK || status.ID != "srv" || !status.Authenticated {
+		t.Errorf("Unexpected server: %d %+v", code, status)
+	}
+	if code := testAPIRequest(t, srv, http.MethodGet, "/v1/servers/unknown", "", nil); code != http.StatusNotFound {
+		t.Errorf("Expected an unknown server to be missing: %d", code)
+	}
+
+	var apiErr apiError
+	if code := testAPIRequest(t, srv, http.MethodPost, "/v1/servers",
+		`{"path": "relative", "name": "test"}`, &apiErr); code != http.StatusBadRequest || apiErr.Error == "" {
+		t.Errorf("Expected a relative path to fail: %d %+v", code, apiErr)
+	}
+	if code := testAPIRequest(t, srv, http.MethodPost, "/v1/servers",
+		`{"unknown": true}`, &apiErr); code != http.StatusBadRequest {
+		t.Errorf("Expected an unknown field to fail: %d", code)
+	}
+	if code := testAPIRequest(t, srv, http.MethodPut, "/v1/servers", "", &apiErr); code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected PUT to not be allowed: %d", code)
+	}
+
+	var removed idResponse
+	if code := testAPIRequest(t, srv, http.MethodDelete, "/v1/servers/srv", "", &removed); code != http.StatusOK || removed.ID != "srv" {
+		t.Errorf("Unexpected remove: %d %+v", code, removed)
+	}
+	if dae.mgr.hasID("srv") {
+		t.Errorf("Expected the server to be removed")
+	}
+}
+
+func TestHTTPAPIAuth(t *testing.T) {
+	dae, srv := testHTTPAPI(t)
+	if err := dae.mgr.addServer("srv", t.TempDir(), "test", "", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var status firebase.AuthStatus
+	if code := testAPIRequest(t, srv, http.MethodGet, "/v1/auth/status", "", &status); code != http.StatusOK ||
+		status.User == nil || status.User.UserID != "owner" || status.User.RefreshToken != "" {
+		t.Errorf("Unexpected status: %d %+v", code, status)
+	}
+
+	var signedOut signOutResponse
+	if code := testAPIRequest(t, srv, http.MethodPost, "/v1/auth/signout", "", &signedOut); code != http.StatusOK ||
+		!reflect.DeepEqual(signedOut.Servers, []string{"srv"}) {
+		t.Errorf("Unexpected sign out: %d %+v", code, signedOut)
+	}
+	if dae.auth.CurrentUser() != nil {
+		t.Errorf("Expected the daemon to be signed out")
+	}
+	if code := testAPIRequest(t, srv, http.MethodPost, "/v1/auth/signin", `{}`, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected signing in without a user to fail: %d", code)
+	}
+}
+
+func TestHTTPAPIErrorStatus(t *testing.T) {
+	dae, database := testNewMockDaemon(t)
+	srv := httptest.NewServer(newHTTPAPI(dae, testAPIToken))
+	defer srv.Close()
+	testDir := t.TempDir()
+	if err := dae.mgr.addServer("srv", testDir, "test", "", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	body := fmt.Sprintf(`{"path": %q, "name": "test"}`, testDir)
+	if code := testAPIRequest(t, srv, http.MethodPost, "/v1/servers", body, nil); code != http.StatusConflict {
+		t.Errorf("Expected a duplicate path to conflict: %d", code)
+	}
+	database.EXPECT().DeleteServer(gomock.Any(), "srv").
+		Return(fmt.Errorf("database unavailable"))
+	if code := testAPIRequest(t, srv, http.MethodDelete, "/v1/servers/srv?delete=true", "", nil); code != http.StatusInternalServerError {
+		t.Errorf("Expected a database failure to be an internal error: %d", code)
+	}
+	if !dae.mgr.hasID("srv") {
+		t.Errorf("Expected the server to still be watched")
+	}
+}
+
+func TestOpenAPIDescribesEveryRPC(t *testing.T) {
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage
+	}
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		t.Fatal(err)
+	}
+	operations := make(map[string]bool)
+	for _, methods := range spec.Paths {
+		for _, raw := range methods {
+			var op struct {
+				OperationID string
+			}
+			json.Unmarshal(raw, &op)
+			operations[op.OperationID] = true
+		}
+	}
+	daeType := reflect.TypeOf(&Daemon{})
+	for i := 0; i < daeType.NumMethod(); i++ {
+		if name := daeType.Method(i).Name; !operations[name] {
+			t.Errorf("Expected the HTTP API to describe Daemon.%s", name)
+		}
+	}
+}
+
+func TestLoadAPITokenIsStable(t *testing.T) {
+	tokenPath := path.Join(t.TempDir(), apiTokenName)
+	first, err := loadAPIToken(tokenPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := loadAPIToken(tokenPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == "" || first != second {
+		t.Errorf("Expected the token to be reused: %q %q", first, second)
+	}
+}
@@ -0,0 +1,115 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"time"
+)
+
+// ErrAlreadyRunning is returned when another daemon is running for the user.
+var ErrAlreadyRunning = errors.New("another minecraft-sidecart daemon is already running")
+
+// staleSocketTimeout bounds how long probing an existing socket may take.
+var staleSocketTimeout = time.Second
+
+// openSocket returns the socket passed by systemd, or listens on addr. Either
+// way the instance lock is held until unlockInstance is called.
+func openSocket(addr *net.UnixAddr) (*net.UnixListener, *os.File, error) {
+	listener, err := activatedListener()
+	if err != nil {
+		return nil, nil, err
+	}
+	if listener == nil {
+		return listenSocket(addr)
+	}
+	if err := makeRuntimeDir(path.Dir(addr.Name)); err != nil {
+		listener.Close()
+		return nil, nil, err
+	}
+	lock, err := lockInstance(addr.Name + ".lock")
+	if err != nil {
+		listener.Close()
+		return nil, nil, err
+	}
+	return listener, lock, nil
+}
+
+// listenSocket locks the daemon's instance lock and listens on addr. A socket
+// left behind by a daemon that crashed is removed. The lock is held until
+// unlockInstance is called.
+func listenSocket(addr *net.UnixAddr) (*net.UnixListener, *os.File, error) {
+	if err := makeRuntimeDir(path.Dir(addr.Name)); err != nil {
+		return nil, nil, err
+	}
+	lock, err := lockInstance(addr.Name + ".lock")
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := removeStaleSocket(addr.Name); err != nil {
+		unlockInstance(lock)
+		return nil, nil, err
+	}
+	// Only the owner may connect, connections are also checked against the
+	// access config as they are accepted.
+	listener, err := listenPrivate(addr)
+	if err != nil {
+		unlockInstance(lock)
+		return nil, nil, err
+	}
+	listener.SetUnlinkOnClose(true)
+	return listener, lock, nil
+}
+
+// makeRuntimeDir creates the directory holding the socket if it is missing,
+// and checks other users can not replace the socket or lock in it.
+func makeRuntimeDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	return checkPrivate(dir, info)
+}
+
+// CheckSocket returns an error unless name is a socket which only the
+// current user, or root, could have created. Clients check the socket before
+// sending it credentials.
+func CheckSocket(name string) error {
+	info, err := os.Lstat(name)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s is not a socket", name)
+	}
+	return checkPrivate(name, info)
+}
+
+// removeStaleSocket removes the socket at name unless a daemon is still
+// accepting connections on it.
+func removeStaleSocket(name string) error {
+	info, err := os.Lstat(name)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", name)
+	}
+	conn, err := net.DialTimeout("unix", name, staleSocketTimeout)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("%w: %s is in use", ErrAlreadyRunning, name)
+	}
+	fmt.Printf("Removing stale socket %s: %v\n", name, err)
+	return os.Remove(name)
+}
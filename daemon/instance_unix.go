@@ -0,0 +1,81 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// lockInstance takes an exclusive lock on the file at name and records the
+// daemon's pid in it. The lock is released when the process exits, even if
+// it crashes.
+func lockInstance(name string) (*os.File, error) {
+	file, err := os.OpenFile(name,
+		os.O_RDWR|os.O_CREATE|syscall.O_NOFOLLOW, 0600)
+	if err != nil {
+		return nil, err
+	}
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		pid, _ := ioutil.ReadAll(file)
+		file.Close()
+		return nil, fmt.Errorf("%w (pid %s)",
+			ErrAlreadyRunning, strings.TrimSpace(string(pid)))
+	} else if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := file.Truncate(0); err != nil {
+		unlockInstance(file)
+		return nil, err
+	}
+	if _, err := fmt.Fprintf(file, "%d\n", os.Getpid()); err != nil {
+		unlockInstance(file)
+		return nil, err
+	}
+	return file, nil
+}
+
+// unlockInstance releases a lock taken by lockInstance.
+func unlockInstance(file *os.File) {
+	if file == nil {
+		return
+	}
+	file.Truncate(0)
+	syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+	file.Close()
+}
+
+// checkPrivate returns an error unless the file at name, described by info,
+// is owned by the current user or root, and other users may not write to it.
+func checkPrivate(name string, info os.FileInfo) error {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fmt.Errorf("unable to find the owner of %s", name)
+	}
+	if int(stat.Uid) != os.Getuid() && stat.Uid != 0 {
+		return fmt.Errorf("%s is owned by uid %d", name, stat.Uid)
+	}
+	if info.Mode().Perm()&0022 != 0 {
+		return fmt.Errorf("%s may be written by other users (mode %v)",
+			name, info.Mode().Perm())
+	}
+	return nil
+}
+
+// listenPrivate listens on addr, creating the socket with permissions that
+// only let its owner connect.
+func listenPrivate(addr *net.UnixAddr) (*net.UnixListener, error) {
+	// The umask is shared by the whole process, but nothing else creates
+	// files while the daemon is starting.
+	umask := syscall.Umask(0177)
+	defer syscall.Umask(umask)
+	return net.ListenUnix("unix", addr)
+}
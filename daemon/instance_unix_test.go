@@ -0,0 +1,89 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestListenSocketRejectsSharedDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	addr := &net.UnixAddr{Name: path.Join(dir, "socket"), Net: "unix"}
+	listener, lock, err := listenSocket(addr)
+	if err == nil {
+		listener.Close()
+		unlockInstance(lock)
+		t.Fatal("Expected a directory other users may write to be rejected")
+	}
+}
+
+func TestListenSocketCreatesPrivateSocket(t *testing.T) {
+	dir := path.Join(t.TempDir(), "runtime")
+	addr := &net.UnixAddr{Name: path.Join(dir, "socket"), Net: "unix"}
+	listener, lock, err := listenSocket(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlockInstance(lock)
+	defer listener.Close()
+
+	info, err := os.Lstat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0700 {
+		t.Errorf("Expected the runtime dir to be 0700, got %v", info.Mode().Perm())
+	}
+	info, err = os.Lstat(addr.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the socket to be 0600, got %v", info.Mode().Perm())
+	}
+	if err := CheckSocket(addr.Name); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLockInstanceRefusesSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := path.Join(dir, "target")
+	if err := ioutil.WriteFile(target, []byte("keep"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	name := path.Join(dir, "socket.lock")
+	if err := os.Symlink(target, name); err != nil {
+		t.Fatal(err)
+	}
+	lock, err := lockInstance(name)
+	if err == nil {
+		unlockInstance(lock)
+		t.Fatal("Expected a symlinked lock to be refused")
+	}
+	data, err := ioutil.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "keep" {
+		t.Errorf("Expected the symlink target to be untouched, got %q", data)
+	}
+}
+
+func TestCheckSocketRejectsFile(t *testing.T) {
+	name := path.Join(t.TempDir(), "socket")
+	if err := ioutil.WriteFile(name, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckSocket(name); err == nil {
+		t.Error("Expected a regular file to be rejected")
+	}
+}
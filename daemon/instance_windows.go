@@ -0,0 +1,31 @@
+//go:build windows
+// +build windows
+
+package daemon
+
+import (
+	"net"
+	"os"
+)
+
+// lockInstance is not supported on windows, a second daemon fails to listen
+// on the socket instead.
+func lockInstance(name string) (*os.File, error) {
+	return nil, nil
+}
+
+func unlockInstance(file *os.File) {
+	if file != nil {
+		file.Close()
+	}
+}
+
+// checkPrivate does nothing on windows, where file modes do not describe who
+// may access a file.
+func checkPrivate(name string, info os.FileInfo) error {
+	return nil
+}
+
+func listenPrivate(addr *net.UnixAddr) (*net.UnixListener, error) {
+	return net.ListenUnix("unix", addr)
+}
@@ -0,0 +1,307 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/Coderlane/minecraft-sidecart/server"
+)
+
+var (
+	// minJournalRetry is the initial delay before retrying failed uploads.
+	minJournalRetry = time.Second * 5
+	// maxJournalRetry caps the delay between retries.
+	maxJournalRetry = time.Minute * 5
+)
+
+// journalEntry is a server info update waiting to be uploaded.
+type journalEntry struct {
+	Type server.Type     `json:"type"`
+	Info json.RawMessage `json:"info"`
+	Time time.Time       `json:"time"`
+	// Seq increases with each update so a retry does not discard an update
+	// made while it was uploading.
+	Seq uint64 `json:"seq"`
+}
+
+// journal durably records server info updates which have not been uploaded.
+// Only the latest update for each server is kept. The journal is stored as a
+// JSON file and rewritten on every change.
+type journal struct {
+	path   string
+	notify chan struct{}
+
+	mtx     sync.Mutex
+	seq     uint64
+	entries map[string]journalEntry
+	// uploads serializes uploads for each server so an older update can
+	// never overwrite a newer one.
+	uploads map[string]*sync.Mutex
+}
+
+// openJournal loads the journal at path. A missing or corrupt journal is
+// replaced with an empty one.
+func openJournal(path string) *journal {
+	jrnl := &journal{
+		path:    path,
+		notify:  make(chan struct{}, 1),
+		entries: make(map[string]journalEntry),
+		uploads: make(map[string]*sync.Mutex),
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return jrnl
+	}
+	if err := json.Unmarshal(data, &jrnl.entries); err != nil {
+		fmt.Printf("Discarding corrupt journal %s: %v\n", path, err)
+		jrnl.entries = make(map[string]journalEntry)
+	}
+	for _, entry := range jrnl.entries {
+		if entry.Seq > jrnl.seq {
+			jrnl.seq = entry.Seq
+		}
+	}
+	return jrnl
+}
+
+// put records the latest info for a server, replacing any pending update.
+func (jrnl *journal) put(id string, srvType server.Type,
+	info interface{}) (uint64, error) {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return 0, err
+	}
+	jrnl.mtx.Lock()
+	defer jrnl.mtx.Unlock()
+	jrnl.seq++
+	jrnl.entries[id] = journalEntry{
+		Type: srvType,
+		Info: data,
+		Time: time.Now(),
+		Seq:  jrnl.seq,
+	}
+	return jrnl.seq, jrnl.save()
+}
+
+// remove drops the update for a server if it has not been replaced since seq.
+func (jrnl *journal) remove(id string, seq uint64) error {
+	jrnl.mtx.Lock()
+	defer jrnl.mtx.Unlock()
+	entry, ok := jrnl.entries[id]
+	if !ok || entry.Seq != seq {
+		return nil
+	}
+	delete(jrnl.entries, id)
+	return jrnl.save()
+}
+
+// forget drops any update for a server, for servers which were removed.
+func (jrnl *journal) forget(id string) error {
+	jrnl.mtx.Lock()
+	defer jrnl.mtx.Unlock()
+	if _, ok := jrnl.entries[id]; !ok {
+		return nil
+	}
+	delete(jrnl.entries, id)
+	return jrnl.save()
+}
+
+// get returns the pending update for a server, if any.
+func (jrnl *journal) get(id string) (journalEntry, bool) {
+	jrnl.mtx.Lock()
+	defer jrnl.mtx.Unlock()
+	entry, ok := jrnl.entries[id]
+	return entry, ok
+}
+
+// lockUploads blocks until no other upload for the server is in progress.
+// The returned function must be called once the upload completes.
+func (jrnl *journal) lockUploads(id string) func() {
+	jrnl.mtx.Lock()
+	lock, ok := jrnl.uploads[id]
+	if !ok {
+		lock = &sync.Mutex{}
+		jrnl.uploads[id] = lock
+	}
+	jrnl.mtx.Unlock()
+	lock.Lock()
+	return lock.Unlock
+}
+
+// pending returns a copy of the pending updates.
+func (jrnl *journal) pending() map[string]journalEntry {
+	jrnl.mtx.Lock()
+	defer jrnl.mtx.Unlock()
+	entries := make(map[string]journalEntry, len(jrnl.entries))
+	for id, entry := range jrnl.entries {
+		entries[id] = entry
+	}
+	return entries
+}
+
+// wake asks the retry loop to try uploading again right away.
+func (jrnl *journal) wake() {
+	select {
+	case jrnl.notify <- struct{}{}:
+	default:
+	}
+}
+
+// save writes the journal to disk. mtx must be held.
+func (jrnl *journal) save() error {
+	data, err := json.Marshal(jrnl.entries)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path.Dir(jrnl.path), 0700); err != nil {
+		return err
+	}
+	// Write to a temporary file first so a crash never leaves a partial
+	// journal behind.
+	tmpPath := jrnl.path + ".tmp"
+	if err := writeFileSync(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, jrnl.path); err != nil {
+		return err
+	}
+	return syncDir(path.Dir(jrnl.path))
+}
+
+// writeFileSync writes data to the file at name and flushes it to disk.
+func writeFileSync(name string, data []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir flushes the directory to disk so a rename in to it survives a
+// crash.
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+// uploadInfo journals the info for a server and then tries to upload it. If
+// the upload fails, the update is retried by retryJournal.
+func (dae *Daemon) uploadInfo(ctx context.Context,
+	id string, srv server.Server, info interface{}) error {
+	defer dae.journal.lockUploads(id)()
+	seq, err := dae.journal.put(id, server.GetType(srv), info)
+	if err != nil {
+		dae.reportError(id, "Failed to journal update for %s: %v", id, err)
+	}
+	database, err := dae.dbFor(id)
+	if err != nil {
+		return err
+	}
+	if err := database.UpdateServerInfo(ctx, id, info); err != nil {
+		return err
+	}
+	return dae.journal.remove(id, seq)
+}
+
+// flushJournal tries to upload every pending update and reports whether all
+// of them succeeded.
+func (dae *Daemon) flushJournal(ctx context.Context) bool {
+	flushed := true
+	for id := range dae.journal.pending() {
+		if !dae.flushEntry(ctx, id) {
+			flushed = false
+		}
+	}
+	return flushed
+}
+
+// flushEntry uploads the pending update for a server and reports whether it
+// succeeded. The entry is read again once no other upload is in progress,
+// so it is skipped if a newer update was already uploaded.
+func (dae *Daemon) flushEntry(ctx context.Context, id string) bool {
+	defer dae.journal.lockUploads(id)()
+	entry, ok := dae.journal.get(id)
+	if !ok {
+		return true
+	}
+	if !dae.mgr.hasID(id) {
+		fmt.Printf("Dropping journal entry for removed server %s\n", id)
+		dae.journal.forget(id)
+		return true
+	}
+	info, err := server.DecodeServerInfo(entry.Type, entry.Info)
+	if err != nil {
+		fmt.Printf("Dropping invalid journal entry for %s: %v\n", id, err)
+		dae.journal.remove(id, entry.Seq)
+		return true
+	}
+	database, err := dae.dbFor(id)
+	if err != nil {
+		return false
+	}
+	// Bound the upload like uploads made while polling, the server's lock
+	// is held until it returns.
+	ctx, cancel := context.WithTimeout(ctx, uploadTimeout)
+	defer cancel()
+	if err = database.UpdateServerInfo(ctx, id, info); err != nil {
+		dae.reportError(id, "Failed to retry update for %s: %v", id, err)
+		return false
+	}
+	dae.journal.remove(id, entry.Seq)
+	dae.publish(ActivityUpload, id, "uploaded journaled server info")
+	return true
+}
+
+// retryJournal retries pending updates with exponential backoff until ctx is
+// canceled.
+func (dae *Daemon) retryJournal(ctx context.Context) {
+	delay := minJournalRetry
+	for {
+		wait := minJournalRetry
+		if len(dae.journal.pending()) > 0 {
+			if dae.flushJournal(ctx) {
+				delay = minJournalRetry
+			} else {
+				wait = jitter(delay)
+				delay *= 2
+				if delay > maxJournalRetry {
+					delay = maxJournalRetry
+				}
+			}
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-dae.journal.notify:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// jitter returns a random duration between d/2 and d.
+func jitter(d time.Duration) time.Duration {
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
@@ -0,0 +1,246 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/Coderlane/minecraft-sidecart/server"
+	"github.com/Coderlane/minecraft-sidecart/server/minecraft"
+)
+
+func TestJournalCollapsesAndPersists(t *testing.T) {
+	journalPath := path.Join(t.TempDir(), "journal.json")
+	jrnl := openJournal(journalPath)
+
+	_, err := jrnl.put("srv", server.ServerTypeMinecraft,
+		minecraft.ServerInfo{MotD: "old"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	seq, err := jrnl.put("srv", server.ServerTypeMinecraft,
+		minecraft.ServerInfo{MotD: "new"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jrnl = openJournal(journalPath)
+	pending := jrnl.pending()
+	if len(pending) != 1 {
+		t.Fatalf("Expected one pending update: %v\n", pending)
+	}
+	info, err := server.DecodeServerInfo(pending["srv"].Type, pending["srv"].Info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.(minecraft.ServerInfo).MotD != "new" {
+		t.Errorf("Expected the latest update: %+v\n", info)
+	}
+
+	// Removing a stale update keeps the newer one.
+	if err = jrnl.remove("srv", seq-1); err != nil {
+		t.Fatal(err)
+	}
+	if len(jrnl.pending()) != 1 {
+		t.Errorf("Expected to keep the newer update")
+	}
+	if err = jrnl.remove("srv", seq); err != nil {
+		t.Fatal(err)
+	}
+	if len(openJournal(journalPath).pending()) != 0 {
+		t.Errorf("Expected no pending updates after reload")
+	}
+}
+
+func TestJournalDiscardsCorruptJournal(t *testing.T) {
+	journalPath := path.Join(t.TempDir(), "journal.json")
+	err := ioutil.WriteFile(journalPath, []byte("{["), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(openJournal(journalPath).pending()) != 0 {
+		t.Errorf("Expected an empty journal")
+	}
+}
+
+func TestUploadInfoRetriesFailures(t *testing.T) {
+	dae, database := testNewMockDaemon(t)
+	if err := dae.mgr.addServer("srv", t.TempDir(), "srv", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	srv := &minecraft.Server{}
+	info := minecraft.ServerInfo{MotD: "test"}
+
+	database.EXPECT().UpdateServerInfo(gomock.Any(), "srv", info).
+		Return(fmt.Errorf("unavailable"))
+	err := dae.uploadInfo(context.Background(), "srv", srv, info)
+	if err == nil {
+		t.Errorf("Expected the upload to fail")
+	}
+	if len(dae.journal.pending()) != 1 {
+		t.Fatalf("Expected the update to be journaled")
+	}
+
+	database.EXPECT().UpdateServerInfo(gomock.Any(), "srv", info).
+		Return(fmt.Errorf("unavailable"))
+	if dae.flushJournal(context.Background()) {
+		t.Errorf("Expected the flush to fail")
+	}
+
+	database.EXPECT().UpdateServerInfo(gomock.Any(), "srv", info).Return(nil)
+	if !dae.flushJournal(context.Background()) {
+		t.Errorf("Expected the flush to succeed")
+	}
+	if len(dae.journal.pending()) != 0 {
+		t.Errorf("Expected no pending updates: %v\n", dae.journal.pending())
+	}
+}
+
+func TestUploadInfoClearsJournal(t *testing.T) {
+	dae, database := testNewMockDaemon(t)
+	info := minecraft.ServerInfo{MotD: "test"}
+
+	database.EXPECT().UpdateServerInfo(gomock.Any(), "srv", info).Return(nil)
+	err := dae.uploadInfo(context.Background(), "srv", &minecraft.Server{}, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dae.journal.pending()) != 0 {
+		t.Errorf("Expected no pending updates: %v\n", dae.journal.pending())
+	}
+}
+
+func TestRemovedServersLeaveJournal(t *testing.T) {
+	dae, _ := testNewMockDaemon(t)
+	for _, id := range []string{"removed", "unknown"} {
+		_, err := dae.journal.put(id, server.ServerTypeMinecraft,
+			minecraft.ServerInfo{MotD: id})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dae.mgr.addServer("removed", t.TempDir(), "removed", "", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var id string
+	if err := dae.RemoveServer(RemoveServerSpec{ID: "removed"}, &id); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := dae.journal.pending()["removed"]; ok {
+		t.Errorf("Expected the removed server's update to be dropped")
+	}
+	// Updates for servers which are not configured are dropped, not retried.
+	if !dae.flushJournal(context.Background()) {
+		t.Errorf("Expected the flush to succeed")
+	}
+	if pending := dae.journal.pending(); len(pending) != 0 {
+		t.Errorf("Expected no pending updates: %v", pending)
+	}
+}
+
+func TestFlushJournalWaitsForNewerUploads(t *testing.T) {
+	dae, database := testNewMockDaemon(t)
+	if err := dae.mgr.addServer("srv", t.TempDir(), "srv", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	older := minecraft.ServerInfo{MotD: "older"}
+	newer := minecraft.ServerInfo{MotD: "newer"}
+	_, err := dae.journal.put("srv", server.ServerTypeMinecraft, older)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var olderDone int32
+	database.EXPECT().UpdateServerInfo(gomock.Any(), "srv", older).
+		DoAndReturn(func(context.Context, string, interface{}) error {
+			close(started)
+			<-release
+			atomic.StoreInt32(&olderDone, 1)
+			return nil
+		})
+	database.EXPECT().UpdateServerInfo(gomock.Any(), "srv", newer).
+		DoAndReturn(func(context.Context, string, interface{}) error {
+			if atomic.LoadInt32(&olderDone) == 0 {
+				t.Errorf("Uploaded while an older update was uploading")
+			}
+			return nil
+		})
+
+	flushed := make(chan bool)
+	go func() { flushed <- dae.flushJournal(context.Background()) }()
+	<-started
+	uploaded := make(chan error)
+	go func() {
+		uploaded <- dae.uploadInfo(context.Background(), "srv",
+			&minecraft.Server{}, newer)
+	}()
+	time.Sleep(time.Millisecond * 20)
+	close(release)
+	if !<-flushed {
+		t.Errorf("Expected the flush to succeed")
+	}
+	if err := <-uploaded; err != nil {
+		t.Fatal(err)
+	}
+	if pending := dae.journal.pending(); len(pending) != 0 {
+		t.Errorf("Expected no pending updates: %v", pending)
+	}
+}
+
+func TestFlushJournalTimesOut(t *testing.T) {
+	defer func(timeout time.Duration) { uploadTimeout = timeout }(uploadTimeout)
+	uploadTimeout = 50 * time.Millisecond
+
+	dae, database := testNewMockDaemon(t)
+	if err := dae.mgr.addServer("srv", t.TempDir(), "srv", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	older := minecraft.ServerInfo{MotD: "older"}
+	newer := minecraft.ServerInfo{MotD: "newer"}
+	_, err := dae.journal.put("srv", server.ServerTypeMinecraft, older)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan struct{})
+	// The retried upload hangs until its context is done.
+	database.EXPECT().UpdateServerInfo(gomock.Any(), "srv", older).
+		DoAndReturn(func(ctx context.Context, _ string, _ interface{}) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	database.EXPECT().UpdateServerInfo(gomock.Any(), "srv", newer).Return(nil)
+
+	flushed := make(chan bool)
+	go func() { flushed <- dae.flushJournal(context.Background()) }()
+	<-started
+	uploaded := make(chan error)
+	go func() {
+		uploaded <- dae.uploadInfo(context.Background(), "srv",
+			&minecraft.Server{}, newer)
+	}()
+	select {
+	case err := <-uploaded:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(uploadTimeout * 10):
+		t.Fatal("Expected the upload to wait no longer than the upload timeout")
+	}
+	if <-flushed {
+		t.Errorf("Expected the hung flush to fail")
+	}
+	if pending := dae.journal.pending(); len(pending) != 0 {
+		t.Errorf("Expected no pending updates: %v", pending)
+	}
+}
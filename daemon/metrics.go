@@ -0,0 +1,157 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Coderlane/minecraft-sidecart/db"
+	"github.com/Coderlane/minecraft-sidecart/server"
+)
+
+// defaultMetricsInterval is how often metric samples are taken.
+var defaultMetricsInterval = time.Minute
+
+// maxUnmergedRollups caps how many closed rollups are kept while they can not
+// be merged, a week of hourly and daily rollups.
+const maxUnmergedRollups = 24*7 + 7
+
+// metricsAggregator down-samples metric samples in to hourly and daily
+// rollups.
+type metricsAggregator struct {
+	mtx     sync.Mutex
+	rollups map[db.RollupPeriod]*db.MetricRollup
+	// unmerged holds closed rollups which failed to merge, oldest first.
+	unmerged []db.MetricRollup
+}
+
+func newMetricsAggregator() *metricsAggregator {
+	return &metricsAggregator{
+		rollups: make(map[db.RollupPeriod]*db.MetricRollup),
+	}
+}
+
+// add includes the sample in the current rollups. Rollups for periods which
+// have ended are returned.
+func (ma *metricsAggregator) add(sample db.MetricSample) []db.MetricRollup {
+	ma.mtx.Lock()
+	defer ma.mtx.Unlock()
+	var closed []db.MetricRollup
+	for _, period := range []db.RollupPeriod{db.RollupHourly, db.RollupDaily} {
+		rollup, ok := ma.rollups[period]
+		if ok && !rollup.Contains(sample.Time) {
+			closed = append(closed, *rollup)
+			ok = false
+		}
+		if !ok {
+			tmp := db.NewMetricRollup(period, sample.Time)
+			rollup = &tmp
+			ma.rollups[period] = rollup
+		}
+		rollup.Add(sample)
+	}
+	return closed
+}
+
+// requeue keeps rollups which failed to merge so they are retried. If too
+// many build up, the oldest are dropped.
+func (ma *metricsAggregator) requeue(rollups []db.MetricRollup) {
+	ma.mtx.Lock()
+	defer ma.mtx.Unlock()
+	ma.unmerged = append(ma.unmerged, rollups...)
+	if extra := len(ma.unmerged) - maxUnmergedRollups; extra > 0 {
+		fmt.Printf("Dropping %d unmerged metric rollups\n", extra)
+		ma.unmerged = append([]db.MetricRollup{}, ma.unmerged[extra:]...)
+	}
+}
+
+// takeUnmerged returns the rollups waiting to be retried and forgets them.
+func (ma *metricsAggregator) takeUnmerged() []db.MetricRollup {
+	ma.mtx.Lock()
+	defer ma.mtx.Unlock()
+	rollups := ma.unmerged
+	ma.unmerged = nil
+	return rollups
+}
+
+// flush returns the unmerged and partial rollups and resets the aggregator.
+func (ma *metricsAggregator) flush() []db.MetricRollup {
+	ma.mtx.Lock()
+	defer ma.mtx.Unlock()
+	rollups := ma.unmerged
+	ma.unmerged = nil
+	for period, rollup := range ma.rollups {
+		rollups = append(rollups, *rollup)
+		delete(ma.rollups, period)
+	}
+	return rollups
+}
+
+// sampleServer takes a metric sample from srv.
+func sampleServer(ctx context.Context, srv server.Server) db.MetricSample {
+	start := time.Now()
+	info := srv.GetServerInfo()
+	sample := db.MetricSample{
+		Time: start,
+	}
+	sample.Online, sample.OnlinePlayers = server.GetOnlinePlayers(info)
+	if !sample.Online {
+		return sample
+	}
+	sample.LatencyMS = float64(time.Since(start)) / float64(time.Millisecond)
+	if reporter, ok := srv.(server.TPSReporter); ok {
+		if tps, err := reporter.GetTPS(ctx); err == nil {
+			sample.TPS = &tps
+		}
+	}
+	return sample
+}
+
+// collectMetrics samples the server until ctx is canceled.
+func (dae *Daemon) collectMetrics(ctx context.Context,
+	mon *monitor, srv server.Server, id string) {
+	ticker := time.NewTicker(defaultMetricsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		sample := sampleServer(ctx, srv)
+		closed := mon.metrics.add(sample)
+		rollups := append(mon.metrics.takeUnmerged(), closed...)
+		database, err := dae.dbFor(id)
+		if err != nil {
+			mon.metrics.requeue(rollups)
+			continue
+		}
+		if err := database.AddMetricSample(ctx, id, sample); err != nil {
+			dae.reportError(id, "Failed to upload metrics for %s: %v", id, err)
+		}
+		mon.metrics.requeue(dae.mergeRollups(ctx, id, rollups))
+	}
+}
+
+// mergeRollups merges the rollups in to the stored rollups and returns the
+// ones which failed.
+func (dae *Daemon) mergeRollups(ctx context.Context,
+	id string, rollups []db.MetricRollup) []db.MetricRollup {
+	if len(rollups) == 0 {
+		return nil
+	}
+	database, err := dae.dbFor(id)
+	if err != nil {
+		return rollups
+	}
+	var failed []db.MetricRollup
+	for _, rollup := range rollups {
+		if err := database.MergeMetricRollup(ctx, id, rollup); err != nil {
+			dae.reportError(id, "Failed to upload %s rollup for %s: %v",
+				rollup.Period, id, err)
+			failed = append(failed, rollup)
+		}
+	}
+	return failed
+}
@@ -0,0 +1,122 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/Coderlane/minecraft-sidecart/db"
+	"github.com/Coderlane/minecraft-sidecart/server"
+	"github.com/Coderlane/minecraft-sidecart/server/minecraft"
+)
+
+func TestMetricsAggregatorClosesRollups(t *testing.T) {
+	ma := newMetricsAggregator()
+	start := time.Date(2021, 2, 3, 23, 30, 0, 0, time.UTC)
+
+	if closed := ma.add(db.MetricSample{Time: start, Online: true}); len(closed) != 0 {
+		t.Errorf("Expected no closed rollups: %v\n", closed)
+	}
+	closed := ma.add(db.MetricSample{Time: start.Add(time.Minute * 10)})
+	if len(closed) != 0 {
+		t.Errorf("Expected no closed rollups: %v\n", closed)
+	}
+
+	// Crossing midnight closes both the hourly and daily rollups.
+	closed = ma.add(db.MetricSample{Time: start.Add(time.Hour)})
+	if len(closed) != 2 {
+		t.Fatalf("Expected two closed rollups: %v\n", closed)
+	}
+	for _, rollup := range closed {
+		if rollup.Samples != 2 || rollup.Uptime != 0.5 {
+			t.Errorf("Unexpected rollup: %+v\n", rollup)
+		}
+	}
+
+	partial := ma.flush()
+	if len(partial) != 2 || partial[0].Samples != 1 {
+		t.Errorf("Unexpected partial rollups: %+v\n", partial)
+	}
+	if len(ma.flush()) != 0 {
+		t.Errorf("Expected flush to reset the aggregator")
+	}
+}
+
+func TestMergeRollupsRequeuesFailures(t *testing.T) {
+	dae, database := testNewMockDaemon(t)
+	ma := newMetricsAggregator()
+	start := time.Date(2021, 2, 3, 23, 30, 0, 0, time.UTC)
+	ma.add(db.MetricSample{Time: start, Online: true})
+	closed := ma.add(db.MetricSample{Time: start.Add(time.Minute * 40)})
+	if len(closed) != 2 {
+		t.Fatalf("Expected two closed rollups: %v\n", closed)
+	}
+
+	ctx := context.Background()
+	gomock.InOrder(
+		database.EXPECT().MergeMetricRollup(gomock.Any(), "srv", closed[0]).
+			Return(nil),
+		database.EXPECT().MergeMetricRollup(gomock.Any(), "srv", closed[1]).
+			Return(fmt.Errorf("unavailable")),
+		database.EXPECT().MergeMetricRollup(gomock.Any(), "srv", closed[1]).
+			Return(nil),
+	)
+	ma.requeue(dae.mergeRollups(ctx, "srv", closed))
+	unmerged := ma.takeUnmerged()
+	if len(unmerged) != 1 || unmerged[0].Period != closed[1].Period {
+		t.Fatalf("Expected the failed rollup to be kept: %+v\n", unmerged)
+	}
+	ma.requeue(dae.mergeRollups(ctx, "srv", unmerged))
+	if unmerged := ma.takeUnmerged(); len(unmerged) != 0 {
+		t.Errorf("Expected no unmerged rollups: %+v\n", unmerged)
+	}
+}
+
+func TestMetricsAggregatorCapsUnmerged(t *testing.T) {
+	ma := newMetricsAggregator()
+	start := time.Date(2021, 2, 3, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < maxUnmergedRollups+5; i++ {
+		ma.requeue([]db.MetricRollup{db.NewMetricRollup(db.RollupHourly,
+			start.Add(time.Duration(i)*time.Hour))})
+	}
+	unmerged := ma.flush()
+	if len(unmerged) != maxUnmergedRollups {
+		t.Fatalf("Expected: %d Got: %d\n", maxUnmergedRollups, len(unmerged))
+	}
+	if !unmerged[0].Start.Equal(start.Add(time.Hour * 5)) {
+		t.Errorf("Expected the oldest rollups to be dropped: %v\n",
+			unmerged[0].Start)
+	}
+}
+
+type testTPSServer struct {
+	*server.MockServer
+}
+
+func (tts testTPSServer) GetTPS(ctx context.Context) (float64, error) {
+	return 19.5, nil
+}
+
+func TestSampleServer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	srv := testTPSServer{server.NewMockServer(ctrl)}
+	srv.EXPECT().GetServerInfo().Return(
+		minecraft.ServerInfo{Online: true, OnlinePlayers: 2})
+
+	sample := sampleServer(context.Background(), srv)
+	if !sample.Online || sample.OnlinePlayers != 2 {
+		t.Errorf("Unexpected sample: %+v\n", sample)
+	}
+	if sample.TPS == nil || *sample.TPS != 19.5 {
+		t.Errorf("Expected TPS in sample: %+v\n", sample)
+	}
+
+	srv.EXPECT().GetServerInfo().Return(minecraft.ServerInfo{})
+	sample = sampleServer(context.Background(), srv)
+	if sample.Online || sample.TPS != nil {
+		t.Errorf("Expected an offline sample: %+v\n", sample)
+	}
+}
@@ -0,0 +1,99 @@
+package daemon
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// monitor tracks the state of a single server being polled by the daemon.
+type monitor struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	// refresh requests the server be polled before the next interval.
+	refresh chan struct{}
+
+	sessions *sessionTracker
+	metrics  *metricsAggregator
+
+	mtx        sync.Mutex
+	lastInfo   interface{}
+	lastPoll   time.Time
+	lastUpload time.Time
+	lastErr    error
+}
+
+func newMonitor(parent context.Context) *monitor {
+	ctx, cancel := context.WithCancel(parent)
+	return &monitor{
+		ctx:     ctx,
+		cancel:  cancel,
+		refresh: make(chan struct{}, 1),
+
+		sessions: newSessionTracker(),
+		metrics:  newMetricsAggregator(),
+
+		lastPoll: time.Now(),
+	}
+}
+
+// requestRefresh asks the poller to poll the server as soon as possible.
+func (mon *monitor) requestRefresh() {
+	select {
+	case mon.refresh <- struct{}{}:
+	default:
+	}
+}
+
+// spawn runs fn in a goroutine tied to the lifetime of the monitor.
+func (mon *monitor) spawn(fn func(ctx context.Context)) {
+	mon.wg.Add(1)
+	go func() {
+		defer mon.wg.Done()
+		fn(mon.ctx)
+	}()
+}
+
+// wait waits for the monitor's goroutines to exit. It does nothing for a nil
+// monitor.
+func (mon *monitor) wait() {
+	if mon == nil {
+		return
+	}
+	mon.wg.Wait()
+}
+
+func (mon *monitor) setInfo(info interface{}) {
+	mon.mtx.Lock()
+	mon.lastInfo = info
+	mon.lastPoll = time.Now()
+	mon.mtx.Unlock()
+}
+
+// stalled reports whether the server has not been polled within limit.
+func (mon *monitor) stalled(now time.Time, limit time.Duration) bool {
+	mon.mtx.Lock()
+	defer mon.mtx.Unlock()
+	return now.Sub(mon.lastPoll) > limit
+}
+
+func (mon *monitor) setUploadResult(err error) {
+	mon.mtx.Lock()
+	if err == nil {
+		mon.lastUpload = time.Now()
+	}
+	mon.lastErr = err
+	mon.mtx.Unlock()
+}
+
+// status fills in the runtime fields of a ServerStatus.
+func (mon *monitor) status(status *ServerStatus) {
+	mon.mtx.Lock()
+	defer mon.mtx.Unlock()
+	status.Info = mon.lastInfo
+	status.LastUpload = mon.lastUpload
+	if mon.lastErr != nil {
+		status.LastError = mon.lastErr.Error()
+	}
+}
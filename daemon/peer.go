@@ -0,0 +1,68 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+)
+
+// errPeerCredentialsUnsupported is returned on platforms where the daemon can
+// not tell who is connected to the socket. Only the socket's permissions
+// protect it there.
+var errPeerCredentialsUnsupported = errors.New("peer credentials are not supported")
+
+// daemonUID is the user the daemon runs as, it may always use the socket.
+var daemonUID = uint32(os.Getuid())
+
+// accessConfig lists who, besides the user the daemon runs as, may use the
+// daemon's socket. The socket is only writable by its owner, so other users
+// must also be given access to it, for example root or with an ACL.
+type accessConfig struct {
+	AllowUIDs []uint32 `json:",omitempty"`
+	AllowGIDs []uint32 `json:",omitempty"`
+}
+
+// peerCredentials identify the process on the other end of a connection.
+type peerCredentials struct {
+	PID int32
+	UID uint32
+	GID uint32
+}
+
+func (access accessConfig) allows(cred peerCredentials) bool {
+	if cred.UID == daemonUID {
+		return true
+	}
+	for _, uid := range access.AllowUIDs {
+		if cred.UID == uid {
+			return true
+		}
+	}
+	for _, gid := range access.AllowGIDs {
+		if cred.GID == gid {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPeer returns an error if the process connected to conn may not use
+// the daemon.
+func (access accessConfig) checkPeer(conn net.Conn) error {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return fmt.Errorf("unexpected connection type: %T", conn)
+	}
+	cred, err := getPeerCredentials(unixConn)
+	if errors.Is(err, errPeerCredentialsUnsupported) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read peer credentials: %v", err)
+	}
+	if !access.allows(cred) {
+		return fmt.Errorf("uid %d gid %d pid %d is not allowed",
+			cred.UID, cred.GID, cred.PID)
+	}
+	return nil
+}
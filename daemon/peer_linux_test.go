@@ -0,0 +1,68 @@
+//go:build linux
+// +build linux
+
+package daemon
+
+import (
+	"context"
+	"net"
+	"net/rpc"
+	"os"
+	"testing"
+
+	"github.com/Coderlane/minecraft-sidecart/firebase"
+)
+
+func TestRPCDaemonChecksPeerCredentials(t *testing.T) {
+	DefaultRootDir = t.TempDir()
+	restore := testAddConfigPath(t.TempDir())
+	defer restore()
+	app := &firebase.App{ProjectID: "test"}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rpcDaemon, err := NewRPCDaemon(ctx, app, app.NewAuth())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rpcDaemon.Close()
+
+	addr, err := DefaultAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(addr.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the socket to be private: %v", info.Mode())
+	}
+
+	// Pretend the daemon runs as someone else.
+	restoreUID := daemonUID
+	daemonUID = uint32(os.Getuid()) + 1
+	defer func() { daemonUID = restoreUID }()
+
+	done := make(chan error, 1)
+	go func() { done <- rpcDaemon.Run(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	conn, err := net.DialUnix("unix", nil, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.NewClient(conn)
+	defer client.Close()
+	var statuses []ServerStatus
+	err = client.Call("Daemon.ListServers", ListServersSpec{}, &statuses)
+	if err == nil {
+		t.Errorf("Expected the connection to be rejected")
+	}
+	var activities []Activity
+	rpcDaemon.daemon.WatchActivity(WatchActivitySpec{}, &activities)
+	if len(activities) != 1 || activities[0].Type != ActivityError {
+		t.Errorf("Expected the rejection to be reported: %+v", activities)
+	}
+}
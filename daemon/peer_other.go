@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package daemon
+
+import "net"
+
+func getPeerCredentials(conn *net.UnixConn) (peerCredentials, error) {
+	return peerCredentials{}, errPeerCredentialsUnsupported
+}
@@ -0,0 +1,25 @@
+package daemon
+
+import "testing"
+
+func TestAccessConfigAllows(t *testing.T) {
+	restore := daemonUID
+	daemonUID = 1000
+	defer func() { daemonUID = restore }()
+
+	access := accessConfig{AllowUIDs: []uint32{1001}, AllowGIDs: []uint32{50}}
+	tests := []struct {
+		cred    peerCredentials
+		allowed bool
+	}{
+		{peerCredentials{UID: 1000, GID: 1}, true},
+		{peerCredentials{UID: 1001, GID: 1}, true},
+		{peerCredentials{UID: 1002, GID: 50}, true},
+		{peerCredentials{UID: 1002, GID: 51}, false},
+	}
+	for _, test := range tests {
+		if access.allows(test.cred) != test.allowed {
+			t.Errorf("Expected %+v allowed to be %v", test.cred, test.allowed)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os/user"
+
+	"github.com/Coderlane/minecraft-sidecart/db"
+	"github.com/Coderlane/minecraft-sidecart/firebase"
+)
+
+// localOwnerPrefix marks owners which are local users rather than signed in
+// users.
+const localOwnerPrefix = "local:"
+
+// maxProfiles bounds how many profiles the daemon keeps, each one refreshes
+// its token in the background until the daemon stops.
+const maxProfiles = 64
+
+// profile is a signed in account that servers upload with. Each profile has
+// its own authentication and database connection.
+type profile struct {
+	auth *firebase.Auth
+	db   db.Database
+	// signInOptional is set when the database is not tied to a user, so
+	// servers can be added and uploaded without signing in.
+	signInOptional bool
+}
+
+func (prof *profile) requireAuth() error {
+	if prof.signInOptional {
+		return nil
+	}
+	if prof.auth.CurrentUser() == nil {
+		return newRequestError(http.StatusConflict, "user is not authenticated")
+	}
+	if err := prof.auth.ReauthRequired(); err != nil {
+		return newRequestError(http.StatusConflict, "%w", err)
+	}
+	return nil
+}
+
+// owner returns the ID recorded as the owner of the servers the profile
+// adds. Without a signed in user it is the local user running the daemon.
+func (prof *profile) owner() (string, error) {
+	if signedIn := prof.auth.CurrentUser(); signedIn != nil {
+		return signedIn.UserID, nil
+	}
+	if err := prof.requireAuth(); err != nil {
+		return "", err
+	}
+	current, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+	return localOwnerPrefix + current.Username, nil
+}
+
+// keepFresh refreshes the profile's token in the background until the daemon
+// stops.
+func (dae *Daemon) keepFresh(name string, prof *profile) {
+	prof.auth.OnRefresh(func(err error) {
+		activity := Activity{
+			Type:    ActivityAuth,
+			Profile: name,
+			Message: "refreshed token",
+		}
+		if err != nil {
+			activity.Message = fmt.Sprintf("failed to refresh token: %v", err)
+		}
+		if errors.Is(err, firebase.ErrReauthRequired) {
+			fmt.Printf("Profile %s must sign in again: %v\n", name, err)
+		}
+		dae.activity.publish(activity)
+	})
+	dae.wg.Add(1)
+	go func() {
+		defer dae.wg.Done()
+		prof.auth.KeepFresh(dae.ctx)
+	}()
+}
+
+// profileName returns the name of the profile used for name. Servers added
+// before profiles existed use the default profile.
+func profileName(name string) string {
+	if name == "" {
+		return firebase.DefaultUser
+	}
+	return name
+}
+
+// profile returns the named profile, creating it the first time it is used.
+func (dae *Daemon) profile(name string) (*profile, error) {
+	name = profileName(name)
+	dae.profilesMtx.Lock()
+	defer dae.profilesMtx.Unlock()
+	if prof, ok := dae.profiles[name]; ok {
+		return prof, nil
+	}
+	if err := firebase.ValidateProfile(name); err != nil {
+		return nil, invalidRequest("%w", err)
+	}
+	if len(dae.profiles) >= maxProfiles {
+		return nil, invalidRequest("too many profiles, at most %d are allowed",
+			maxProfiles)
+	}
+	auth := dae.auth.ForProfile(name)
+	database, err := dae.openDatabase(auth)
+	if err != nil {
+		return nil, err
+	}
+	prof := &profile{
+		auth:           auth,
+		db:             database,
+		signInOptional: dae.signInOptional,
+	}
+	dae.profiles[name] = prof
+	if dae.refreshTokens {
+		dae.keepFresh(name, prof)
+	}
+	return prof, nil
+}
+
+// serverProfile returns the profile the server uploads with.
+func (dae *Daemon) serverProfile(id string) (*profile, error) {
+	return dae.profile(dae.mgr.profileOf(id))
+}
+
+// dbFor returns the database for the server if its profile is signed in.
+func (dae *Daemon) dbFor(id string) (db.Database, error) {
+	prof, err := dae.serverProfile(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := prof.requireAuth(); err != nil {
+		return nil, err
+	}
+	return prof.db, nil
+}
@@ -0,0 +1,206 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Coderlane/minecraft-sidecart/firebase"
+)
+
+func TestServersUseTheirProfile(t *testing.T) {
+	dae, database := testNewMockDaemon(t)
+	testDir := t.TempDir()
+	if err := dae.mgr.addServer("default", testDir, "default", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := dae.mgr.addServer("team", testDir, "team", "team", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := dae.dbFor("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != database {
+		t.Errorf("Expected the default profile's database")
+	}
+	if _, err := dae.dbFor("team"); err == nil {
+		t.Errorf("Expected the team profile to be signed out")
+	}
+
+	prof, err := dae.serverProfile("team")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prof.auth.Profile() != "team" {
+		t.Errorf("Expected the team profile, got: %s", prof.auth.Profile())
+	}
+	defaultProf, err := dae.profile("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if defaultProf.auth.Profile() != firebase.DefaultUser {
+		t.Errorf("Expected the default profile, got: %s", defaultProf.auth.Profile())
+	}
+
+	var statuses []ServerStatus
+	if err := dae.ListServers(ListServersSpec{ID: "team"}, &statuses); err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 || statuses[0].Profile != "team" {
+		t.Errorf("Expected the team profile in the status: %+v", statuses)
+	}
+}
+
+func TestRemovedServerForgetsProfile(t *testing.T) {
+	dae, _ := testNewMockDaemon(t)
+	if err := dae.mgr.addServer("team", t.TempDir(), "team", "team", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := dae.mgr.removeServer("team"); err != nil {
+		t.Fatal(err)
+	}
+	if name := dae.mgr.profileOf("team"); name != firebase.DefaultUser {
+		t.Errorf("Expected the default profile, got: %s", name)
+	}
+}
+
+func TestDaemonWhoAmIHidesRefreshToken(t *testing.T) {
+	dae, _ := testNewMockDaemon(t)
+	var status firebase.AuthStatus
+	if err := dae.WhoAmI(WhoAmISpec{}, &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Profile != firebase.DefaultUser || status.User == nil ||
+		status.User.UserID != "owner" {
+		t.Errorf("Unexpected status: %+v\n", status)
+	}
+	if status.User.RefreshToken != "" {
+		t.Errorf("Expected the refresh token to be hidden")
+	}
+	if dae.auth.CurrentUser().RefreshToken == "" {
+		t.Errorf("Expected the daemon to keep its refresh token")
+	}
+
+	if err := dae.WhoAmI(WhoAmISpec{Profile: "team"}, &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Profile != "team" || status.User != nil {
+		t.Errorf("Expected the team profile to be signed out: %+v\n", status)
+	}
+}
+
+func TestDaemonSignOutStopsUploads(t *testing.T) {
+	dae, _ := testNewMockDaemon(t)
+	if err := dae.mgr.addServer("srv", t.TempDir(), "srv", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := dae.mgr.addServer("team", t.TempDir(), "team", "team", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	if err := dae.SignOut(SignOutSpec{}, &ids); err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != "srv" {
+		t.Errorf("Expected srv to be signed out: %v", ids)
+	}
+	if _, err := dae.dbFor("srv"); err == nil {
+		t.Errorf("Expected srv to stop uploading")
+	}
+	if dae.auth.ForProfile(firebase.DefaultUser).CurrentUser() != nil {
+		t.Errorf("Expected the user to be deleted from the cache")
+	}
+
+	var statuses []ServerStatus
+	if err := dae.ListServers(ListServersSpec{ID: "srv"}, &statuses); err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 || statuses[0].Authenticated {
+		t.Errorf("Expected srv to be unauthenticated: %+v", statuses)
+	}
+}
+
+func TestRejectedRefreshTokenRequiresReauth(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, `{"error": {"message": "TOKEN_EXPIRED"}}`,
+				http.StatusBadRequest)
+		}))
+	defer srv.Close()
+
+	dae, database := testNewMockDaemon(t)
+	app := &firebase.App{APIKey: "test_api_key"}
+	cache := &firebase.MemoryUserCache{
+		"team": &firebase.User{UserID: "team", RefreshToken: "test"},
+	}
+	auth := app.NewAuth(firebase.WithUserCache(cache), firebase.WithProfile("team"),
+		firebase.WithEmulatorHost(strings.TrimPrefix(srv.URL, "http://")))
+	prof := &profile{auth: auth, db: database}
+	dae.profiles["team"] = prof
+	dae.keepFresh("team", prof)
+	if err := dae.mgr.addServer("team", t.TempDir(), "team", "team", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := auth.Token(); !errors.Is(err, firebase.ErrReauthRequired) {
+		t.Fatalf("Expected ErrReauthRequired, got: %v", err)
+	}
+	var activities []Activity
+	spec := WatchActivitySpec{Wait: 5 * time.Second}
+	if err := dae.WatchActivity(spec, &activities); err != nil {
+		t.Fatal(err)
+	}
+	if len(activities) != 1 || activities[0].Type != ActivityAuth ||
+		activities[0].Profile != "team" {
+		t.Errorf("Expected the failed refresh to be published: %+v", activities)
+	}
+	if _, err := dae.dbFor("team"); err == nil {
+		t.Errorf("Expected the team profile to stop uploading")
+	}
+	var statuses []ServerStatus
+	if err := dae.ListServers(ListServersSpec{ID: "team"}, &statuses); err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 || !statuses[0].ReauthRequired ||
+		statuses[0].Authenticated {
+		t.Errorf("Expected the server to require signing in: %+v", statuses)
+	}
+}
+
+func TestInvalidProfilesAreRejected(t *testing.T) {
+	dae, _ := testNewMockDaemon(t)
+	for _, name := range []string{"..", ".users", " ", "team/..",
+		strings.Repeat("a", 65)} {
+		_, err := dae.profile(name)
+		if err == nil {
+			t.Errorf("Expected profile %q to be rejected", name)
+		} else if errorStatus(err) != http.StatusBadRequest {
+			t.Errorf("Expected profile %q to be a bad request: %v", name, err)
+		}
+	}
+	if len(dae.profiles) != 1 {
+		t.Errorf("Expected only the default profile: %v", dae.profiles)
+	}
+}
+
+func TestProfilesAreLimited(t *testing.T) {
+	dae, _ := testNewMockDaemon(t)
+	for i := len(dae.profiles); i < maxProfiles; i++ {
+		if _, err := dae.profile(fmt.Sprintf("profile-%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := dae.profile("one-too-many"); err == nil {
+		t.Errorf("Expected profiles beyond the limit to be rejected")
+	}
+	if _, err := dae.profile("profile-1"); err != nil {
+		t.Errorf("Expected existing profiles to still be found: %v", err)
+	}
+}
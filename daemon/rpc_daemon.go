@@ -4,47 +4,63 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"net/http"
 	"net/rpc"
 	"os"
 	"os/signal"
 	"os/user"
 	"path"
+	"strconv"
+	"syscall"
 
 	"github.com/Coderlane/minecraft-sidecart/firebase"
 )
 
 type RPCDaemon struct {
-	listener *net.UnixListener
-	server   *rpc.Server
-	errs     chan error
-	conns    chan net.Conn
+	daemon     *Daemon
+	listener   *net.UnixListener
+	server     *rpc.Server
+	httpServer *http.Server
+	access     accessConfig
+	errs       chan error
+	conns      chan net.Conn
+
+	// lock is held while the daemon runs so only one runs per user.
+	lock *os.File
 }
 
 func NewRPCDaemon(ctx context.Context,
 	app *firebase.App, auth *firebase.Auth) (*RPCDaemon, error) {
-	daemon, err := NewDaemon(ctx, app, auth)
+	addr, err := DefaultAddress()
 	if err != nil {
 		return nil, err
 	}
-	addr, err := DefaultAddress()
+	// Listen first, so a second daemon fails before watching any servers.
+	listener, lock, err := openSocket(addr)
 	if err != nil {
 		return nil, err
 	}
-
-	listener, err := net.ListenUnix("unix", addr)
+	daemon, err := NewDaemon(ctx, app, auth)
 	if err != nil {
+		listener.Close()
+		unlockInstance(lock)
 		return nil, err
 	}
 
 	server := rpc.NewServer()
 	err = server.Register(daemon)
 	if err != nil {
+		listener.Close()
+		unlockInstance(lock)
 		return nil, err
 	}
 
 	return &RPCDaemon{
+		daemon:   daemon,
 		listener: listener,
+		lock:     lock,
 		server:   server,
+		access:   daemon.mgr.cfg.Access,
 		errs:     make(chan error, 1),
 		conns:    make(chan net.Conn, 1),
 	}, nil
@@ -61,11 +77,24 @@ func (dae *RPCDaemon) listen() {
 	}
 }
 
+// Run serves RPC requests until ctx is canceled or the process is signaled.
+// Before returning, every server monitor is stopped. When run by systemd,
+// readiness is reported and the watchdog is pinged while servers are polled.
 func (dae *RPCDaemon) Run(ctx context.Context) error {
 	go dae.listen()
+	defer dae.daemon.shutdown()
+	defer notify("STOPPING=1")
+
+	done := make(chan struct{})
+	defer close(done)
+	if interval := watchdogInterval(); interval > 0 {
+		go dae.daemon.watchdog(done, interval)
+	}
+	notify("READY=1\nSTATUS=" + dae.daemon.statusLine())
 
 	sigc := make(chan os.Signal, 1)
-	signal.Notify(sigc, os.Interrupt, os.Kill)
+	signal.Notify(sigc, os.Interrupt, os.Kill, syscall.SIGTERM)
+	defer signal.Stop(sigc)
 	for {
 		select {
 		case <-sigc:
@@ -75,16 +104,73 @@ func (dae *RPCDaemon) Run(ctx context.Context) error {
 		case err := <-dae.errs:
 			return err
 		case conn := <-dae.conns:
+			if err := dae.access.checkPeer(conn); err != nil {
+				dae.daemon.reportError("", "Rejected connection: %v", err)
+				conn.Close()
+				continue
+			}
 			go dae.server.ServeConn(conn)
 		}
 	}
 }
 
+// ListenHTTP serves the HTTP API on addr, see openapi.json. Requests must
+// carry the token stored at `APITokenPath`. The API is served without TLS,
+// so addr must be a loopback address. The address being listened on is
+// returned.
+func (dae *RPCDaemon) ListenHTTP(addr string) (net.Addr, error) {
+	token, err := loadAPIToken(dae.APITokenPath())
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	// Check the bound address, a host name like localhost could resolve to
+	// anything.
+	if tcpAddr, ok := listener.Addr().(*net.TCPAddr); !ok || !tcpAddr.IP.IsLoopback() {
+		listener.Close()
+		return nil, fmt.Errorf("the HTTP API must listen on a loopback "+
+			"address, it is served without TLS: %s", addr)
+	}
+	dae.httpServer = &http.Server{Handler: newHTTPAPI(dae.daemon, token)}
+	go func() {
+		err := dae.httpServer.Serve(listener)
+		if err != http.ErrServerClosed {
+			dae.errs <- err
+		}
+	}()
+	return listener.Addr(), nil
+}
+
+// APITokenPath returns the path of the HTTP API's bearer token.
+func (dae *RPCDaemon) APITokenPath() string {
+	return path.Join(path.Dir(dae.daemon.mgr.cfgPath), apiTokenName)
+}
+
+// Close stops listening, removing the socket, and releases the instance lock.
 func (dae *RPCDaemon) Close() {
 	dae.listener.Close()
+	if dae.httpServer != nil {
+		dae.httpServer.Close()
+	}
+	unlockInstance(dae.lock)
+	dae.lock = nil
 }
 
-var DefaultRootDir = os.TempDir()
+// DefaultRootDir is the directory holding the daemon's socket. It is
+// $XDG_RUNTIME_DIR when set, since only the user may access it. Otherwise it
+// is a directory in the system temporary directory which only the user may
+// access, since anyone may create files there.
+var DefaultRootDir = defaultRootDir()
+
+func defaultRootDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return dir
+	}
+	return path.Join(os.TempDir(), SocketName(strconv.Itoa(os.Getuid())))
+}
 
 func DefaultAddress() (*net.UnixAddr, error) {
 	user, err := user.Current()
@@ -92,5 +178,11 @@ func DefaultAddress() (*net.UnixAddr, error) {
 		return nil, err
 	}
 	return net.ResolveUnixAddr("unix",
-		path.Join(DefaultRootDir, fmt.Sprintf("minecraft-sidecart-%s", user.Uid)))
+		path.Join(DefaultRootDir, SocketName(user.Uid)))
+}
+
+// SocketName is the name of the daemon's socket for the user, within
+// DefaultRootDir.
+func SocketName(uid string) string {
+	return fmt.Sprintf("minecraft-sidecart-%s", uid)
 }
@@ -2,9 +2,14 @@ package daemon
 
 import (
 	"context"
+	"errors"
+	"net"
+	"net/rpc"
+	"os"
 	"testing"
 
 	"github.com/Coderlane/minecraft-sidecart/firebase"
+	"github.com/Coderlane/minecraft-sidecart/server"
 )
 
 func TestRPCDaemonRunAndCancel(t *testing.T) {
@@ -38,8 +43,8 @@ func TestRPCDaemonDuplicateFails(t *testing.T) {
 	defer rpcDaemon.Close()
 
 	_, err = NewRPCDaemon(ctx, app, auth)
-	if err == nil {
-		t.Errorf("Expected to fail to create duplicate daemon.")
+	if !errors.Is(err, ErrAlreadyRunning) {
+		t.Errorf("Expected to fail to create duplicate daemon: %v", err)
 	}
 
 	ctx, cancel := context.WithCancel(ctx)
@@ -49,3 +54,127 @@ func TestRPCDaemonDuplicateFails(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestRPCDaemonListServers(t *testing.T) {
+	DefaultRootDir = t.TempDir()
+	testDir := t.TempDir()
+	restore := testAddConfigPath(testDir)
+	defer restore()
+
+	testCreateTestServer(t, testDir)
+	mgr, err := newServerManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = mgr.addServer("test", testDir, "test", "", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	app := &firebase.App{ProjectID: "test"}
+	auth := app.NewAuth()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rpcDaemon, err := NewRPCDaemon(ctx, app, auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rpcDaemon.Close()
+	done := make(chan error, 1)
+	go func() { done <- rpcDaemon.Run(ctx) }()
+	// Shutting down writes to the config directory, wait for it to finish.
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	addr, err := DefaultAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.DialUnix("unix", nil, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.NewClient(conn)
+	defer client.Close()
+
+	var statuses []ServerStatus
+	err = client.Call("Daemon.ListServers", ListServersSpec{}, &statuses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 || statuses[0].ID != "test" {
+		t.Errorf("Expected to find server: %+v\n", statuses)
+	}
+	if statuses[0].Type != server.ServerTypeMinecraft {
+		t.Errorf("Expected a minecraft server: %v\n", statuses[0].Type)
+	}
+}
+
+func TestRPCDaemonRemovesStaleSocket(t *testing.T) {
+	DefaultRootDir = t.TempDir()
+	addr, err := DefaultAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Leave a socket behind, like a daemon that crashed.
+	stale, err := net.ListenUnix("unix", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.SetUnlinkOnClose(false)
+	stale.Close()
+
+	app := &firebase.App{ProjectID: "test"}
+	rpcDaemon, err := NewRPCDaemon(context.Background(), app, app.NewAuth())
+	if err != nil {
+		t.Fatalf("Expected the stale socket to be replaced: %v", err)
+	}
+	rpcDaemon.Close()
+	if _, err := os.Stat(addr.Name); !os.IsNotExist(err) {
+		t.Errorf("Expected Close to remove the socket: %v", err)
+	}
+}
+
+func TestRPCDaemonLiveSocketFails(t *testing.T) {
+	DefaultRootDir = t.TempDir()
+	addr, err := DefaultAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A daemon that does not hold the lock, but is still accepting.
+	live, err := net.ListenUnix("unix", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer live.Close()
+
+	app := &firebase.App{ProjectID: "test"}
+	_, err = NewRPCDaemon(context.Background(), app, app.NewAuth())
+	if !errors.Is(err, ErrAlreadyRunning) {
+		t.Errorf("Expected ErrAlreadyRunning, got: %v", err)
+	}
+}
+
+func TestRPCDaemonHTTPRequiresLoopback(t *testing.T) {
+	DefaultRootDir = t.TempDir()
+	restore := testAddConfigPath(t.TempDir())
+	defer restore()
+	app := &firebase.App{ProjectID: "test"}
+	rpcDaemon, err := NewRPCDaemon(context.Background(), app, app.NewAuth())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rpcDaemon.Close()
+
+	if _, err := rpcDaemon.ListenHTTP(":0"); err == nil {
+		t.Errorf("Expected to refuse listening on every address")
+	}
+	addr, err := rpcDaemon.ListenHTTP("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !addr.(*net.TCPAddr).IP.IsLoopback() {
+		t.Errorf("Expected a loopback address: %v", addr)
+	}
+}
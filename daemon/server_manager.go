@@ -2,10 +2,15 @@ package daemon
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
+	"sort"
+	"sync"
+	"time"
 
+	"github.com/Coderlane/minecraft-sidecart/db"
 	"github.com/Coderlane/minecraft-sidecart/server"
 )
 
@@ -20,16 +25,32 @@ var ConfigPaths = []string{
 
 type serverConfig struct {
 	Path string
+	Name string
+	// Profile is the auth profile the server uploads with. Empty means the
+	// default profile.
+	Profile string `json:",omitempty"`
 }
 
 type config struct {
 	Servers map[string]serverConfig
+	// Database selects where server updates are sent. Firestore is used
+	// when no backend is set.
+	Database db.Config `json:",omitempty"`
+	// Access lists the other users that may use the daemon's socket.
+	Access accessConfig `json:",omitempty"`
 }
 
 type serverManager struct {
-	cfg     config
-	cfgPath string
-	servers map[string]server.Server
+	mtx      sync.Mutex
+	cfg      config
+	cfgPath  string
+	servers  map[string]server.Server
+	monitors map[string]*monitor
+
+	// profiles maps server ids to their profile. It has its own lock since
+	// monitors look it up on every upload.
+	profileMtx sync.Mutex
+	profiles   map[string]string
 }
 
 func newServerManager() (*serverManager, error) {
@@ -37,12 +58,15 @@ func newServerManager() (*serverManager, error) {
 		cfg: config{
 			Servers: make(map[string]serverConfig),
 		},
-		servers: make(map[string]server.Server),
+		servers:  make(map[string]server.Server),
+		monitors: make(map[string]*monitor),
+		profiles: make(map[string]string),
 	}
 	if err := mgr.loadConfig(); err != nil {
 		return nil, err
 	}
 	for id, srvCfg := range mgr.cfg.Servers {
+		mgr.profiles[id] = profileName(srvCfg.Profile)
 		srv, err := server.NewServer(srvCfg.Path)
 		if err != nil {
 			continue
@@ -78,18 +102,199 @@ func (mgr *serverManager) saveConfig() error {
 }
 
 func (mgr *serverManager) hasPath(path string) bool {
-	for _, existingServer := range mgr.cfg.Servers {
+	_, ok := mgr.findPath(path)
+	return ok
+}
+
+func (mgr *serverManager) findPath(path string) (string, bool) {
+	mgr.mtx.Lock()
+	defer mgr.mtx.Unlock()
+	for id, existingServer := range mgr.cfg.Servers {
 		if existingServer.Path == path {
-			return true
+			return id, true
 		}
 	}
-	return false
+	return "", false
 }
 
-func (mgr *serverManager) addServer(id, path string, srv server.Server) error {
+func (mgr *serverManager) hasID(id string) bool {
+	mgr.mtx.Lock()
+	defer mgr.mtx.Unlock()
+	_, ok := mgr.cfg.Servers[id]
+	return ok
+}
+
+func (mgr *serverManager) addServer(
+	id, path, name, profile string, srv server.Server) error {
+	mgr.mtx.Lock()
+	defer mgr.mtx.Unlock()
 	mgr.cfg.Servers[id] = serverConfig{
-		Path: path,
+		Path:    path,
+		Name:    name,
+		Profile: profile,
 	}
 	mgr.servers[id] = srv
+	mgr.setProfile(id, profileName(profile))
 	return mgr.saveConfig()
 }
+
+// profileOf returns the name of the profile the server uploads with.
+func (mgr *serverManager) profileOf(id string) string {
+	mgr.profileMtx.Lock()
+	defer mgr.profileMtx.Unlock()
+	return profileName(mgr.profiles[id])
+}
+
+// profileServers returns the sorted ids of the servers using profile.
+func (mgr *serverManager) profileServers(profile string) []string {
+	mgr.profileMtx.Lock()
+	defer mgr.profileMtx.Unlock()
+	ids := []string{}
+	for id, name := range mgr.profiles {
+		if name == profile {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// setProfile records the server's profile, an empty profile removes it.
+func (mgr *serverManager) setProfile(id, profile string) {
+	mgr.profileMtx.Lock()
+	defer mgr.profileMtx.Unlock()
+	if profile == "" {
+		delete(mgr.profiles, id)
+		return
+	}
+	mgr.profiles[id] = profile
+}
+
+func (mgr *serverManager) setMonitor(id string, mon *monitor) {
+	mgr.mtx.Lock()
+	defer mgr.mtx.Unlock()
+	mgr.monitors[id] = mon
+}
+
+// listServers returns the status of each configured server. If id is set,
+// only that server is returned.
+func (mgr *serverManager) listServers(id string) []ServerStatus {
+	mgr.mtx.Lock()
+	defer mgr.mtx.Unlock()
+	statuses := make([]ServerStatus, 0, len(mgr.cfg.Servers))
+	for srvID, srvCfg := range mgr.cfg.Servers {
+		if id != "" && id != srvID {
+			continue
+		}
+		status := ServerStatus{
+			ID:      srvID,
+			Name:    srvCfg.Name,
+			Path:    srvCfg.Path,
+			Profile: profileName(srvCfg.Profile),
+			Type:    server.GetType(mgr.servers[srvID]),
+		}
+		if mon, ok := mgr.monitors[srvID]; ok {
+			mon.status(&status)
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].ID < statuses[j].ID
+	})
+	return statuses
+}
+
+// removeServer stops monitoring the server and removes it from the config.
+func (mgr *serverManager) removeServer(id string) error {
+	mgr.mtx.Lock()
+	if _, ok := mgr.cfg.Servers[id]; !ok {
+		mgr.mtx.Unlock()
+		return fmt.Errorf("unknown server: %s", id)
+	}
+	mon := mgr.detachMonitor(id)
+	delete(mgr.cfg.Servers, id)
+	delete(mgr.servers, id)
+	mgr.setProfile(id, "")
+	err := mgr.saveConfig()
+	mgr.mtx.Unlock()
+	mon.wait()
+	return err
+}
+
+// moveServer stops monitoring the server at its old path and points the
+// config at the new path. The caller is responsible for monitoring srv.
+func (mgr *serverManager) moveServer(
+	id, path string, srv server.Server) error {
+	mgr.mtx.Lock()
+	srvCfg, ok := mgr.cfg.Servers[id]
+	if !ok {
+		mgr.mtx.Unlock()
+		return fmt.Errorf("unknown server: %s", id)
+	}
+	mon := mgr.detachMonitor(id)
+	srvCfg.Path = path
+	mgr.cfg.Servers[id] = srvCfg
+	mgr.servers[id] = srv
+	err := mgr.saveConfig()
+	mgr.mtx.Unlock()
+	mon.wait()
+	return err
+}
+
+// detachMonitor cancels the monitor for id, if any, and forgets it. The
+// caller waits for it after releasing mtx, since a poll in progress can take
+// a while. mtx must be held.
+func (mgr *serverManager) detachMonitor(id string) *monitor {
+	mon, ok := mgr.monitors[id]
+	if !ok {
+		return nil
+	}
+	mon.cancel()
+	delete(mgr.monitors, id)
+	return mon
+}
+
+// stopMonitors stops every monitor and waits for them to exit. The stopped
+// monitors are returned.
+func (mgr *serverManager) stopMonitors() map[string]*monitor {
+	mgr.mtx.Lock()
+	monitors := mgr.monitors
+	for _, mon := range monitors {
+		mon.cancel()
+	}
+	mgr.monitors = make(map[string]*monitor)
+	mgr.mtx.Unlock()
+	for _, mon := range monitors {
+		mon.wait()
+	}
+	return monitors
+}
+
+// stalledServers returns the ids of the servers which have not been polled
+// within limit, in order.
+func (mgr *serverManager) stalledServers(limit time.Duration) []string {
+	mgr.mtx.Lock()
+	defer mgr.mtx.Unlock()
+	now := time.Now()
+	var ids []string
+	for id, mon := range mgr.monitors {
+		if mon.stalled(now, limit) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// activeServers returns a copy of the servers which could be loaded.
+func (mgr *serverManager) activeServers() map[string]server.Server {
+	mgr.mtx.Lock()
+	defer mgr.mtx.Unlock()
+	servers := make(map[string]server.Server, len(mgr.servers))
+	for id, srv := range mgr.servers {
+		if srv != nil {
+			servers[id] = srv
+		}
+	}
+	return servers
+}
@@ -1,10 +1,12 @@
 package daemon
 
 import (
+	"context"
 	"io/ioutil"
 	"os"
 	"path"
 	"testing"
+	"time"
 )
 
 const testServerConfig = `
@@ -45,7 +47,7 @@ func TestServerManagerAddStoresServer(t *testing.T) {
 	}
 
 	testCreateTestServer(t, testDir)
-	err = mgr.addServer("test", testDir, nil)
+	err = mgr.addServer("test", testDir, "test", "", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -78,3 +80,111 @@ func TestServerManagerHandlesInvalidConfig(t *testing.T) {
 		t.Errorf("Expected to fail")
 	}
 }
+
+func TestServerManagerRemoveServer(t *testing.T) {
+	testDir := t.TempDir()
+	restore := testAddConfigPath(testDir)
+	defer restore()
+
+	mgr, err := newServerManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCreateTestServer(t, testDir)
+	err = mgr.addServer("test", testDir, "test", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = mgr.removeServer("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mgr, err = newServerManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mgr.hasPath(testDir) {
+		t.Errorf("expected server to be removed after reload")
+	}
+
+	err = mgr.removeServer("test")
+	if err == nil {
+		t.Errorf("expected to fail to remove an unknown server")
+	}
+}
+
+func TestServerManagerListServers(t *testing.T) {
+	testDir := t.TempDir()
+	restore := testAddConfigPath(testDir)
+	defer restore()
+
+	mgr, err := newServerManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCreateTestServer(t, testDir)
+	err = mgr.addServer("test", testDir, "name", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := mgr.listServers("")
+	if len(statuses) != 1 {
+		t.Fatalf("expected one server, got: %v", statuses)
+	}
+	if statuses[0].Name != "name" || statuses[0].Path != testDir {
+		t.Errorf("unexpected server status: %+v", statuses[0])
+	}
+	if len(mgr.listServers("unknown")) != 0 {
+		t.Errorf("expected to not find an unknown server")
+	}
+}
+
+func TestServerManagerListsWhileMonitorStops(t *testing.T) {
+	testDir := t.TempDir()
+	restore := testAddConfigPath(testDir)
+	defer restore()
+
+	mgr, err := newServerManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCreateTestServer(t, testDir)
+	if err := mgr.addServer("test", testDir, "test", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	// A poll which takes a while to notice it was canceled.
+	release := make(chan struct{})
+	mon := newMonitor(context.Background())
+	mon.spawn(func(context.Context) { <-release })
+	mgr.setMonitor("test", mon)
+
+	removed := make(chan error, 1)
+	go func() { removed <- mgr.removeServer("test") }()
+	listed := make(chan []ServerStatus, 1)
+	go func() {
+		<-mon.ctx.Done()
+		listed <- mgr.listServers("")
+	}()
+	select {
+	case statuses := <-listed:
+		if len(statuses) != 0 {
+			t.Errorf("Expected the server to be removed: %+v", statuses)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected listing servers not to wait on the monitor")
+	}
+	select {
+	case <-removed:
+		t.Error("Expected removing the server to wait on the monitor")
+	default:
+	}
+	close(release)
+	if err := <-removed; err != nil {
+		t.Fatal(err)
+	}
+}
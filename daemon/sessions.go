@@ -0,0 +1,147 @@
+package daemon
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Coderlane/minecraft-sidecart/db"
+	"github.com/Coderlane/minecraft-sidecart/server"
+)
+
+// sessionOfflinePolls is how many polls in a row must find the server
+// offline before its open sessions are closed. A single failed status ping
+// shouldn't split a player's session in two.
+const sessionOfflinePolls = 3
+
+// sessionTracker follows which players are on a server. Sessions are opened
+// and closed from polled player lists and from log events, whichever sees
+// the change first. Players are keyed by name since log events do not
+// include a UUID.
+type sessionTracker struct {
+	mtx  sync.Mutex
+	open map[string]*db.Session
+
+	// offlinePolls counts the polls in a row which found the server
+	// offline, starting at offlineSince.
+	offlinePolls int
+	offlineSince time.Time
+}
+
+func newSessionTracker() *sessionTracker {
+	return &sessionTracker{
+		open: make(map[string]*db.Session),
+	}
+}
+
+// observe updates the tracker with a polled server info and returns any
+// sessions which have ended. Sessions are only closed for an offline server
+// once it has been offline for sessionOfflinePolls polls, they end when it
+// was first found offline.
+func (st *sessionTracker) observe(info interface{}, now time.Time) []db.Session {
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+	if up, _ := server.GetOnlinePlayers(info); !up {
+		if st.offlinePolls == 0 {
+			st.offlineSince = now
+		}
+		st.offlinePolls++
+		if st.offlinePolls < sessionOfflinePolls {
+			return nil
+		}
+		return st.closeAllLocked(st.offlineSince)
+	}
+	st.offlinePolls = 0
+	players, complete := server.GetPlayers(info)
+	online := make(map[string]bool, len(players))
+	for _, player := range players {
+		online[player.Name] = true
+		if session, ok := st.open[player.Name]; ok {
+			session.PlayerUUID = player.UUID
+			continue
+		}
+		st.open[player.Name] = &db.Session{
+			PlayerUUID: player.UUID,
+			PlayerName: player.Name,
+			JoinedAt:   now,
+		}
+	}
+	// A partial list can't tell us who left.
+	if !complete {
+		return nil
+	}
+	var closed []db.Session
+	for name := range st.open {
+		if !online[name] {
+			closed = append(closed, st.close(name, now))
+		}
+	}
+	return closed
+}
+
+// join opens a session for a player if one isn't already open.
+func (st *sessionTracker) join(name string, when time.Time) {
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+	if _, ok := st.open[name]; ok {
+		return
+	}
+	st.open[name] = &db.Session{
+		PlayerName: name,
+		JoinedAt:   when,
+	}
+}
+
+// leave closes the session for a player, if one is open.
+func (st *sessionTracker) leave(name string, when time.Time) (db.Session, bool) {
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+	if _, ok := st.open[name]; !ok {
+		return db.Session{}, false
+	}
+	return st.close(name, when), true
+}
+
+// closeAll ends every open session.
+func (st *sessionTracker) closeAll(now time.Time) []db.Session {
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+	return st.closeAllLocked(now)
+}
+
+// closeAllLocked ends every open session. mtx must be held.
+func (st *sessionTracker) closeAllLocked(now time.Time) []db.Session {
+	var closed []db.Session
+	for name := range st.open {
+		closed = append(closed, st.close(name, now))
+	}
+	return closed
+}
+
+// close ends the session for name. mtx must be held.
+func (st *sessionTracker) close(name string, when time.Time) db.Session {
+	session := *st.open[name]
+	delete(st.open, name)
+	if when.Before(session.JoinedAt) {
+		when = session.JoinedAt
+	}
+	session.LeftAt = when
+	session.DurationSeconds = int64(when.Sub(session.JoinedAt) / time.Second)
+	return session
+}
+
+func (dae *Daemon) recordSessions(ctx context.Context,
+	id string, sessions []db.Session) {
+	if len(sessions) == 0 {
+		return
+	}
+	database, err := dae.dbFor(id)
+	if err != nil {
+		return
+	}
+	for _, session := range sessions {
+		if err := database.RecordSession(ctx, id, session); err != nil {
+			dae.reportError(id, "Failed to record session for %s: %v", id, err)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package daemon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Coderlane/minecraft-sidecart/db"
+	"github.com/Coderlane/minecraft-sidecart/server/minecraft"
+)
+
+func testServerInfo(names ...string) minecraft.ServerInfo {
+	info := minecraft.ServerInfo{
+		Online:        true,
+		OnlinePlayers: len(names),
+	}
+	for _, name := range names {
+		info.Players = append(info.Players,
+			minecraft.PlayerInfo{Name: name, UUID: name + "-uuid"})
+	}
+	return info
+}
+
+func TestSessionTrackerObserve(t *testing.T) {
+	st := newSessionTracker()
+	start := time.Now()
+
+	if closed := st.observe(testServerInfo("alex", "steve"), start); len(closed) != 0 {
+		t.Errorf("Expected no closed sessions: %v\n", closed)
+	}
+	closed := st.observe(testServerInfo("steve"), start.Add(time.Minute))
+	if len(closed) != 1 {
+		t.Fatalf("Expected one closed session: %v\n", closed)
+	}
+	session := closed[0]
+	if session.PlayerName != "alex" || session.PlayerUUID != "alex-uuid" {
+		t.Errorf("Unexpected session: %+v\n", session)
+	}
+	if session.DurationSeconds != 60 {
+		t.Errorf("Expected: 60 Got: %d\n", session.DurationSeconds)
+	}
+}
+
+func TestSessionTrackerIgnoresPartialLists(t *testing.T) {
+	st := newSessionTracker()
+	now := time.Now()
+
+	st.observe(testServerInfo("alex", "steve"), now)
+	info := testServerInfo("steve")
+	info.OnlinePlayers = 2
+	if closed := st.observe(info, now); len(closed) != 0 {
+		t.Errorf("Expected no closed sessions: %v\n", closed)
+	}
+}
+
+func TestSessionTrackerToleratesFailedPolls(t *testing.T) {
+	st := newSessionTracker()
+	start := time.Now()
+	offline := minecraft.ServerInfo{}
+
+	st.observe(testServerInfo("alex"), start)
+	for i := 1; i < sessionOfflinePolls; i++ {
+		when := start.Add(time.Duration(i) * time.Minute)
+		if closed := st.observe(offline, when); len(closed) != 0 {
+			t.Fatalf("Expected no closed sessions: %v\n", closed)
+		}
+	}
+	// A good poll keeps the original session open.
+	st.observe(testServerInfo("alex"), start.Add(time.Hour))
+	closed := st.closeAll(start.Add(time.Hour))
+	if len(closed) != 1 || !closed[0].JoinedAt.Equal(start) {
+		t.Fatalf("Expected the original session: %+v\n", closed)
+	}
+
+	// Sessions end when the server was first found offline.
+	st.observe(testServerInfo("alex"), start)
+	var ended []db.Session
+	for i := 1; i <= sessionOfflinePolls; i++ {
+		when := start.Add(time.Duration(i) * time.Minute)
+		ended = append(ended, st.observe(offline, when)...)
+	}
+	if len(ended) != 1 || ended[0].DurationSeconds != 60 {
+		t.Errorf("Unexpected sessions: %+v\n", ended)
+	}
+}
+
+func TestSessionTrackerEvents(t *testing.T) {
+	st := newSessionTracker()
+	start := time.Now()
+
+	// A short session entirely between polls.
+	st.join("alex", start)
+	st.join("alex", start.Add(time.Second))
+	session, ok := st.leave("alex", start.Add(time.Second*30))
+	if !ok {
+		t.Fatal("Expected to close session")
+	}
+	if session.DurationSeconds != 30 {
+		t.Errorf("Expected: 30 Got: %d\n", session.DurationSeconds)
+	}
+	if _, ok = st.leave("alex", start); ok {
+		t.Errorf("Expected no open session")
+	}
+
+	// A session opened by an event is kept open by polls.
+	st.join("steve", start)
+	st.observe(testServerInfo("steve"), start.Add(time.Second))
+	closed := st.closeAll(start.Add(time.Minute))
+	if len(closed) != 1 || closed[0].PlayerUUID != "steve-uuid" {
+		t.Errorf("Unexpected sessions: %+v\n", closed)
+	}
+	if !closed[0].JoinedAt.Equal(start) {
+		t.Errorf("Expected: %v Got: %v\n", start, closed[0].JoinedAt)
+	}
+}
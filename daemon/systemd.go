@@ -0,0 +1,128 @@
+package daemon
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// listenFDsStart is the first file descriptor passed by socket activation.
+var listenFDsStart = 3
+
+// stallTimeout is how long a server may go without being polled before the
+// daemon stops answering the systemd watchdog.
+var stallTimeout = time.Minute
+
+// sdNotify sends state to the service manager, see sd_notify(3). It does
+// nothing when the daemon was not started by systemd.
+func sdNotify(state string) error {
+	name := os.Getenv("NOTIFY_SOCKET")
+	if name == "" {
+		return nil
+	}
+	if strings.HasPrefix(name, "@") {
+		// An abstract socket.
+		name = "\x00" + name[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil,
+		&net.UnixAddr{Name: name, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// notify sends state to the service manager, logging failures.
+func notify(state string) {
+	if err := sdNotify(state); err != nil {
+		fmt.Printf("Failed to notify systemd: %v\n", err)
+	}
+}
+
+// watchdogInterval returns how often systemd expects a watchdog ping, or
+// zero if the watchdog is disabled.
+func watchdogInterval() time.Duration {
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" &&
+		pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// activatedListener returns the socket passed by systemd socket activation,
+// see sd_listen_fds(3), or nil if there is none. The environment variables are
+// cleared so commands the daemon runs do not inherit them.
+func activatedListener() (*net.UnixListener, error) {
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		return nil, nil
+	}
+	if count > 1 {
+		return nil, fmt.Errorf("expected one socket from systemd, got %d", count)
+	}
+	file := os.NewFile(uintptr(listenFDsStart), "systemd-socket")
+	defer file.Close()
+	listener, err := net.FileListener(file)
+	if err != nil {
+		return nil, err
+	}
+	unixListener, ok := listener.(*net.UnixListener)
+	if !ok {
+		listener.Close()
+		return nil, fmt.Errorf("expected a unix socket from systemd, got %s",
+			listener.Addr().Network())
+	}
+	// systemd owns the socket, leave it for the next activation.
+	unixListener.SetUnlinkOnClose(false)
+	return unixListener, nil
+}
+
+// checkLiveness returns an error if any server has stopped being polled.
+func (dae *Daemon) checkLiveness() error {
+	if ids := dae.mgr.stalledServers(stallTimeout); len(ids) > 0 {
+		return fmt.Errorf("servers not polled in %v: %s",
+			stallTimeout, strings.Join(ids, ", "))
+	}
+	return nil
+}
+
+// statusLine summarizes the daemon for `systemctl status`.
+func (dae *Daemon) statusLine() string {
+	return fmt.Sprintf("Watching %d servers", len(dae.mgr.activeServers()))
+}
+
+// watchdog pings the systemd watchdog every half interval while every server
+// is being polled, until done is closed. If a server stalls the pings stop so
+// systemd restarts the daemon.
+func (dae *Daemon) watchdog(done <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		if err := dae.checkLiveness(); err != nil {
+			dae.reportError("", "Skipping watchdog ping: %v", err)
+			notify("STATUS=" + err.Error())
+			continue
+		}
+		notify("WATCHDOG=1\nSTATUS=" + dae.statusLine())
+	}
+}
@@ -0,0 +1,159 @@
+package daemon
+
+import (
+	"context"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/Coderlane/minecraft-sidecart/firebase"
+	"github.com/Coderlane/minecraft-sidecart/server"
+)
+
+// testNotifySocket listens for sd_notify messages.
+func testNotifySocket(t *testing.T) *net.UnixConn {
+	t.Helper()
+	name := path.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram",
+		&net.UnixAddr{Name: name, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", name)
+	return conn
+}
+
+func testReadNotification(t *testing.T, conn *net.UnixConn) string {
+	t.Helper()
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buf[:n])
+}
+
+func TestSdNotifyWithoutSystemdDoesNothing(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if err := sdNotify("READY=1"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRPCDaemonNotifiesSystemd(t *testing.T) {
+	conn := testNotifySocket(t)
+	DefaultRootDir = t.TempDir()
+	restore := testAddConfigPath(t.TempDir())
+	defer restore()
+	app := &firebase.App{ProjectID: "test"}
+	rpcDaemon, err := NewRPCDaemon(context.Background(), app, app.NewAuth())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rpcDaemon.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- rpcDaemon.Run(ctx) }()
+	if state := testReadNotification(t, conn); state != "READY=1\nSTATUS=Watching 0 servers" {
+		t.Errorf("Unexpected state: %q", state)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if state := testReadNotification(t, conn); state != "STOPPING=1" {
+		t.Errorf("Unexpected state: %q", state)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	t.Setenv("WATCHDOG_PID", "")
+	if interval := watchdogInterval(); interval != 30*time.Second {
+		t.Errorf("Expected 30s, got: %v", interval)
+	}
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()+1))
+	if interval := watchdogInterval(); interval != 0 {
+		t.Errorf("Expected the watchdog for another process to be ignored: %v",
+			interval)
+	}
+}
+
+func TestWatchdogStopsWhenServersStall(t *testing.T) {
+	conn := testNotifySocket(t)
+	dae, _ := testNewMockDaemon(t)
+	mon := newMonitor(dae.ctx)
+	dae.mgr.setMonitor("stalled", mon)
+
+	done := make(chan struct{})
+	defer close(done)
+	go dae.watchdog(done, 100*time.Millisecond)
+	if state := testReadNotification(t, conn); !strings.HasPrefix(state, "WATCHDOG=1\n") {
+		t.Errorf("Expected a watchdog ping: %q", state)
+	}
+
+	mon.mtx.Lock()
+	mon.lastPoll = time.Now().Add(-2 * stallTimeout)
+	mon.mtx.Unlock()
+	// Skip pings which may have been sent before the stall.
+	for i := 0; i < 5; i++ {
+		state := testReadNotification(t, conn)
+		if state == "STATUS=servers not polled in 1m0s: stalled" {
+			return
+		}
+	}
+	t.Error("Expected the watchdog pings to stop")
+}
+
+func TestPollServerBoundsUploads(t *testing.T) {
+	defer func(interval, timeout time.Duration) {
+		defaultPollInterval, uploadTimeout = interval, timeout
+	}(defaultPollInterval, uploadTimeout)
+	defaultPollInterval, uploadTimeout = 10*time.Millisecond, 50*time.Millisecond
+
+	dae, database := testNewMockDaemon(t)
+	if err := dae.mgr.addServer("srv", t.TempDir(), "test", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	srv := server.NewMockServer(gomock.NewController(t))
+	srv.EXPECT().GetServerInfo().Return("info").AnyTimes()
+	// The upload hangs until its deadline.
+	database.EXPECT().UpdateServerInfo(gomock.Any(), "srv", "info").
+		DoAndReturn(func(ctx context.Context, id string, info interface{}) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+
+	mon := newMonitor(dae.ctx)
+	mon.spawn(func(ctx context.Context) {
+		dae.pollServer(ctx, mon, srv, "srv")
+	})
+	defer mon.wait()
+	defer dae.cancel()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var status ServerStatus
+		mon.status(&status)
+		if status.LastError != "" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the upload to time out")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if mon.stalled(time.Now(), 40*time.Millisecond) {
+		t.Errorf("Expected polling to continue after the upload timed out")
+	}
+}
@@ -0,0 +1,56 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestActivatedListener(t *testing.T) {
+	listener, err := net.ListenUnix("unix",
+		&net.UnixAddr{Name: path.Join(t.TempDir(), "socket"), Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	file, err := listener.File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// activatedListener closes the descriptor it is passed, give it a copy
+	// so file doesn't close the number again once it has been reused.
+	fd, err := syscall.Dup(int(file.Fd()))
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restore := listenFDsStart
+	listenFDsStart = fd
+	defer func() { listenFDsStart = restore }()
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "1")
+
+	activated, err := activatedListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if activated == nil {
+		t.Fatal("Expected the passed socket to be used")
+	}
+	defer activated.Close()
+	if activated.Addr().String() != listener.Addr().String() {
+		t.Errorf("Expected %s, got %s", listener.Addr(), activated.Addr())
+	}
+	if os.Getenv("LISTEN_FDS") != "" {
+		t.Errorf("Expected the environment to be cleared")
+	}
+	if activated, err := activatedListener(); activated != nil || err != nil {
+		t.Errorf("Expected no socket the second time: %v %v", activated, err)
+	}
+}
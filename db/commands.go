@@ -0,0 +1,81 @@
+package db
+
+import (
+	"context"
+	"sort"
+
+	firestore "cloud.google.com/go/firestore"
+)
+
+func (db *database) commands(serverID string) *firestore.CollectionRef {
+	return db.store.Collection("servers").Doc(serverID).Collection("commands")
+}
+
+// GetServerOwners fetches the IDs of the users who own the server.
+func (db *database) GetServerOwners(ctx context.Context,
+	serverID string) ([]string, error) {
+	snap, err := db.store.Collection("servers").Doc(serverID).Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var doc serverDoc
+	if err := snap.DataTo(&doc); err != nil {
+		return nil, err
+	}
+	return doc.Owners, nil
+}
+
+// WatchCommands listens for pending commands queued for the server.
+func (db *database) WatchCommands(ctx context.Context,
+	serverID string, handler func(Command)) error {
+	it := db.commands(serverID).
+		Where("status", "==", CommandPending).Snapshots(ctx)
+	defer it.Stop()
+	for {
+		snap, err := it.Next()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		var cmds []Command
+		for _, change := range snap.Changes {
+			if change.Kind != firestore.DocumentAdded {
+				continue
+			}
+			var cmd Command
+			if err := change.Doc.DataTo(&cmd); err != nil {
+				return err
+			}
+			cmd.ID = change.Doc.Ref.ID
+			cmds = append(cmds, cmd)
+		}
+		sort.SliceStable(cmds, func(i, j int) bool {
+			return cmds[i].CreatedAt.Before(cmds[j].CreatedAt)
+		})
+		for _, cmd := range cmds {
+			handler(cmd)
+		}
+	}
+}
+
+// UpdateCommand records the status, output, and timestamps of a command.
+func (db *database) UpdateCommand(ctx context.Context,
+	serverID string, cmd Command) error {
+	updates := []firestore.Update{
+		{Path: "status", Value: cmd.Status},
+		{Path: "output", Value: cmd.Output},
+		{Path: "error", Value: cmd.Error},
+	}
+	if !cmd.StartedAt.IsZero() {
+		updates = append(updates,
+			firestore.Update{Path: "started_at", Value: cmd.StartedAt})
+	}
+	if !cmd.FinishedAt.IsZero() {
+		updates = append(updates,
+			firestore.Update{Path: "finished_at", Value: cmd.FinishedAt})
+	}
+	_, err := db.commands(serverID).Doc(cmd.ID).Update(ctx, updates)
+	return err
+}
@@ -0,0 +1,162 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Coderlane/minecraft-sidecart/server"
+	"github.com/Coderlane/minecraft-sidecart/server/minecraft"
+)
+
+// testConformance runs the tests every backend must pass against databases
+// created by newDB.
+func testConformance(t *testing.T, newDB func(*testing.T) Database) {
+	tests := []struct {
+		name string
+		fn   func(*testing.T, Database)
+	}{
+		{"CreateAndUpdate", testConformanceCreateAndUpdate},
+		{"CreateHandlesCanceledContext", testConformanceCreateCanceled},
+		{"UpdateUnknownFails", testConformanceUpdateUnknown},
+		{"ArchiveAndDelete", testConformanceArchiveAndDelete},
+		{"ArchiveUnknownFails", testConformanceArchiveUnknown},
+		{"Owners", testConformanceOwners},
+		{"Events", testConformanceEvents},
+		{"Sessions", testConformanceSessions},
+		{"Metrics", testConformanceMetrics},
+		{"MetricsBadPeriodFails", testConformanceMetricsBadPeriod},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			test.fn(t, newDB(t))
+		})
+	}
+}
+
+func testCreateServer(t *testing.T, db Database) string {
+	t.Helper()
+	id, err := db.CreateServer(context.Background(), "test", "test",
+		server.ServerTypeMinecraft, minecraft.ServerInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id == "" {
+		t.Fatal("Expected a server id")
+	}
+	return id
+}
+
+func testConformanceCreateAndUpdate(t *testing.T, db Database) {
+	id := testCreateServer(t, db)
+	if other := testCreateServer(t, db); other == id {
+		t.Errorf("Expected unique ids: %s\n", id)
+	}
+	err := db.UpdateServerInfo(context.Background(), id,
+		minecraft.ServerInfo{MotD: "updated"})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testConformanceCreateCanceled(t *testing.T, db Database) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := db.CreateServer(ctx, "test", "test",
+		server.ServerTypeMinecraft, minecraft.ServerInfo{})
+	if err == nil {
+		t.Error("Expected an error")
+	}
+}
+
+func testConformanceUpdateUnknown(t *testing.T, db Database) {
+	err := db.UpdateServerInfo(context.Background(), "unknown",
+		minecraft.ServerInfo{})
+	if err == nil {
+		t.Error("Expected an error")
+	}
+}
+
+func testConformanceArchiveAndDelete(t *testing.T, db Database) {
+	ctx := context.Background()
+	id := testCreateServer(t, db)
+	if err := db.ArchiveServer(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteServer(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testConformanceArchiveUnknown(t *testing.T, db Database) {
+	if err := db.ArchiveServer(context.Background(), "unknown"); err == nil {
+		t.Error("Expected an error")
+	}
+}
+
+func testConformanceOwners(t *testing.T, db Database) {
+	id := testCreateServer(t, db)
+	owners, err := db.GetServerOwners(context.Background(), id)
+	if errors.Is(err, ErrUnsupported) {
+		t.Skip("Backend does not support owners")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(owners) != 1 || owners[0] != "test" {
+		t.Errorf("Unexpected owners: %v\n", owners)
+	}
+}
+
+func testConformanceEvents(t *testing.T, db Database) {
+	id := testCreateServer(t, db)
+	err := db.AddServerEvent(context.Background(), id, minecraft.Event{
+		Time:   time.Now(),
+		Type:   minecraft.EventPlayerJoin,
+		Player: "test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testConformanceSessions(t *testing.T, db Database) {
+	id := testCreateServer(t, db)
+	now := time.Now()
+	err := db.RecordSession(context.Background(), id, Session{
+		PlayerName:      "test",
+		JoinedAt:        now.Add(-time.Minute),
+		LeftAt:          now,
+		DurationSeconds: 60,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testConformanceMetrics(t *testing.T, db Database) {
+	ctx := context.Background()
+	id := testCreateServer(t, db)
+	sample := MetricSample{Time: time.Now(), Online: true, OnlinePlayers: 1}
+	if err := db.AddMetricSample(ctx, id, sample); err != nil {
+		t.Fatal(err)
+	}
+	rollup := NewMetricRollup(RollupHourly, sample.Time)
+	rollup.Add(sample)
+	for i := 0; i < 2; i++ {
+		if err := db.MergeMetricRollup(ctx, id, rollup); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func testConformanceMetricsBadPeriod(t *testing.T, db Database) {
+	id := testCreateServer(t, db)
+	err := db.MergeMetricRollup(context.Background(), id,
+		MetricRollup{Period: "weekly", Start: time.Now()})
+	if err == nil {
+		t.Error("Expected an error")
+	}
+}
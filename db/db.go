@@ -8,11 +8,32 @@ import (
 	"github.com/Coderlane/minecraft-sidecart/server"
 )
 
+//go:generate mockgen -destination=mock_database.go -package=db -self_package=github.com/Coderlane/minecraft-sidecart/db github.com/Coderlane/minecraft-sidecart/db Database
+
 // Database wraps a firestore database connection
 type Database interface {
 	CreateServer(context.Context, string, string,
 		server.Type, interface{}) (string, error)
 	UpdateServerInfo(context.Context, string, interface{}) error
+	DeleteServer(context.Context, string) error
+	ArchiveServer(context.Context, string) error
+	GetServerOwners(context.Context, string) ([]string, error)
+
+	// WatchCommands calls the handler, in order, with each pending command
+	// queued for the server. It blocks until the context is canceled or the
+	// watch fails.
+	WatchCommands(context.Context, string, func(Command)) error
+	UpdateCommand(context.Context, string, Command) error
+
+	// AddServerEvent records an event, like a player joining, for the server.
+	AddServerEvent(context.Context, string, interface{}) error
+	// RecordSession records a completed player session for the server.
+	RecordSession(context.Context, string, Session) error
+
+	AddMetricSample(context.Context, string, MetricSample) error
+	// MergeMetricRollup adds a partial rollup to the stored rollup for the
+	// same period.
+	MergeMetricRollup(context.Context, string, MetricRollup) error
 }
 
 type database struct {
@@ -52,3 +73,75 @@ func (db *database) UpdateServerInfo(ctx context.Context,
 		})
 	return err
 }
+
+// serverSubcollections are the subcollections stored under each server
+// document. Firestore does not delete them along with the server.
+var serverSubcollections = []string{
+	"commands", "events", "sessions",
+	"metrics", "metrics_hourly", "metrics_daily",
+}
+
+// deleteBatchSize is the number of documents deleted per batch, Firestore
+// allows at most 500 writes in a batch.
+const deleteBatchSize = 100
+
+// DeleteServer deletes the server document along with its subcollections.
+// The subcollections are deleted first, the owner check in the security
+// rules reads the server document.
+func (db *database) DeleteServer(ctx context.Context, serverID string) error {
+	ref := db.store.Collection("servers").Doc(serverID)
+	for _, name := range serverSubcollections {
+		if err := db.deleteCollection(ctx, ref.Collection(name)); err != nil {
+			return err
+		}
+	}
+	_, err := ref.Delete(ctx)
+	return err
+}
+
+// deleteCollection deletes every document in the collection in batches.
+func (db *database) deleteCollection(ctx context.Context,
+	coll *firestore.CollectionRef) error {
+	for {
+		docs, err := coll.Limit(deleteBatchSize).Documents(ctx).GetAll()
+		if err != nil {
+			return err
+		}
+		if len(docs) == 0 {
+			return nil
+		}
+		batch := db.store.Batch()
+		for _, doc := range docs {
+			batch.Delete(doc.Ref)
+		}
+		if _, err := batch.Commit(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// ArchiveServer marks the server document as archived, preserving its
+// contents.
+func (db *database) ArchiveServer(ctx context.Context, serverID string) error {
+	_, err := db.store.Collection("servers").Doc(serverID).Update(
+		ctx, []firestore.Update{
+			{Path: "archived", Value: true},
+		})
+	return err
+}
+
+// AddServerEvent adds an event to the server's events subcollection.
+func (db *database) AddServerEvent(ctx context.Context,
+	serverID string, event interface{}) error {
+	_, _, err := db.store.Collection("servers").Doc(serverID).
+		Collection("events").Add(ctx, event)
+	return err
+}
+
+// RecordSession adds a session to the server's sessions subcollection.
+func (db *database) RecordSession(ctx context.Context,
+	serverID string, session Session) error {
+	_, _, err := db.store.Collection("servers").Doc(serverID).
+		Collection("sessions").Add(ctx, session)
+	return err
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"testing"
+	"time"
 
 	firestore "cloud.google.com/go/firestore"
 
@@ -78,3 +79,171 @@ func TestDatabaseUpdateHandlesFailure(t *testing.T) {
 	}
 	t.Log(err)
 }
+
+func TestDatabaseArchiveAndDelete(t *testing.T) {
+	ctx := context.Background()
+	db := testNewDatabase(t, ctx)
+
+	id, err := db.CreateServer(ctx, "test", "test",
+		server.ServerTypeMinecraft, minecraft.ServerInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.ArchiveServer(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.AddServerEvent(ctx, id, map[string]interface{}{"type": "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.DeleteServer(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := db.(*database).store
+	docs, err := store.Collection("servers").Doc(id).
+		Collection("events").Documents(ctx).GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 0 {
+		t.Errorf("Expected events to be deleted, found %d", len(docs))
+	}
+}
+
+func TestDatabaseArchiveHandlesFailure(t *testing.T) {
+	ctx := context.Background()
+	db := testNewDatabase(t, ctx)
+
+	err := db.ArchiveServer(ctx, "unknown")
+	if err == nil {
+		t.Error("Expected an error")
+	}
+	t.Log(err)
+}
+
+func TestDatabaseWatchAndUpdateCommands(t *testing.T) {
+	ctx := context.Background()
+	db := testNewDatabase(t, ctx)
+
+	id, err := db.CreateServer(ctx, "test", "test",
+		server.ServerTypeMinecraft, minecraft.ServerInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	owners, err := db.GetServerOwners(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(owners) != 1 || owners[0] != "test" {
+		t.Errorf("Unexpected owners: %v\n", owners)
+	}
+
+	store := db.(*database).store
+	_, _, err = store.Collection("servers").Doc(id).Collection("commands").Add(
+		ctx, Command{
+			Command:     "say hi",
+			RequestedBy: "test",
+			Status:      CommandPending,
+			CreatedAt:   time.Now(),
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	watchCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+	var cmds []Command
+	err = db.WatchCommands(watchCtx, id, func(cmd Command) {
+		cmds = append(cmds, cmd)
+		cancel()
+	})
+	if len(cmds) != 1 || cmds[0].Command != "say hi" {
+		t.Fatalf("Unexpected commands: %v %v\n", cmds, err)
+	}
+
+	cmds[0].Status = CommandSucceeded
+	cmds[0].FinishedAt = time.Now()
+	err = db.UpdateCommand(ctx, id, cmds[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDatabaseAddServerEvent(t *testing.T) {
+	ctx := context.Background()
+	db := testNewDatabase(t, ctx)
+
+	id, err := db.CreateServer(ctx, "test", "test",
+		server.ServerTypeMinecraft, minecraft.ServerInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.AddServerEvent(ctx, id, minecraft.Event{
+		Time:   time.Now(),
+		Type:   minecraft.EventPlayerJoin,
+		Player: "test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDatabaseRecordSession(t *testing.T) {
+	ctx := context.Background()
+	db := testNewDatabase(t, ctx)
+
+	id, err := db.CreateServer(ctx, "test", "test",
+		server.ServerTypeMinecraft, minecraft.ServerInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	err = db.RecordSession(ctx, id, Session{
+		PlayerName:      "test",
+		JoinedAt:        now.Add(-time.Minute),
+		LeftAt:          now,
+		DurationSeconds: 60,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDatabaseMetrics(t *testing.T) {
+	ctx := context.Background()
+	db := testNewDatabase(t, ctx)
+
+	id, err := db.CreateServer(ctx, "test", "test",
+		server.ServerTypeMinecraft, minecraft.ServerInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sample := MetricSample{Time: time.Now(), Online: true, OnlinePlayers: 1}
+	err = db.AddMetricSample(ctx, id, sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rollup := NewMetricRollup(RollupHourly, sample.Time)
+	rollup.Add(sample)
+	for i := 0; i < 2; i++ {
+		err = db.MergeMetricRollup(ctx, id, rollup)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFirestoreConformance(t *testing.T) {
+	testConformance(t, func(t *testing.T) Database {
+		return testNewDatabase(t, context.Background())
+	})
+}
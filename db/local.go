@@ -0,0 +1,320 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/Coderlane/minecraft-sidecart/server"
+)
+
+var (
+	// localSampleRetention is how long the local backend keeps raw metric
+	// samples. Rollups are kept forever.
+	localSampleRetention = time.Hour * 24 * 7
+	// localMaxEvents is how many of the most recent events the local backend
+	// keeps for each server.
+	localMaxEvents = 1000
+	// localOpenTimeout is how long to wait for another process to release the
+	// database file.
+	localOpenTimeout = time.Second
+)
+
+// The local database has a bucket for each server in serversBucket. The
+// server's bucket holds its document under docKey and a nested bucket for
+// each of its subcollections.
+var (
+	serversBucket  = []byte("servers")
+	docKey         = []byte("doc")
+	eventsBucket   = []byte("events")
+	sessionsBucket = []byte("sessions")
+	metricsBucket  = []byte("metrics")
+	rollupsBucket  = []byte("rollups")
+)
+
+// localDatabase stores servers in a bbolt file on disk. It is meant for
+// self-hosted setups that only need a record of their own servers. Every
+// write is a transaction, so a crash never leaves the file half written.
+type localDatabase struct {
+	bolt *bolt.DB
+}
+
+// NewLocalDatabase opens the database stored in the bbolt file at path,
+// creating it if needed. The file is locked until the database is closed.
+func NewLocalDatabase(dbPath string) (Database, error) {
+	if err := os.MkdirAll(path.Dir(dbPath), 0700); err != nil {
+		return nil, err
+	}
+	store, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: localOpenTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open local database %s: %v", dbPath, err)
+	}
+	err = store.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(serversBucket)
+		return err
+	})
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	return &localDatabase{bolt: store}, nil
+}
+
+func openLocal(ctx context.Context, cfg Config) (Database, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("local backend requires a path")
+	}
+	return NewLocalDatabase(cfg.Path)
+}
+
+// Close releases the database file.
+func (db *localDatabase) Close() error {
+	return db.bolt.Close()
+}
+
+// update calls fn with the server's bucket in a write transaction, which is
+// committed if fn succeeds.
+func (db *localDatabase) update(ctx context.Context,
+	serverID string, fn func(*bolt.Bucket) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return db.bolt.Update(func(tx *bolt.Tx) error {
+		srv := tx.Bucket(serversBucket).Bucket([]byte(serverID))
+		if srv == nil {
+			return fmt.Errorf("unknown server: %s", serverID)
+		}
+		return fn(srv)
+	})
+}
+
+// updateDoc calls fn with the server's document and stores the result.
+func (db *localDatabase) updateDoc(ctx context.Context,
+	serverID string, fn func(*serverDoc)) error {
+	return db.update(ctx, serverID, func(srv *bolt.Bucket) error {
+		var doc serverDoc
+		if err := json.Unmarshal(srv.Get(docKey), &doc); err != nil {
+			return err
+		}
+		fn(&doc)
+		return putJSON(srv, docKey, doc)
+	})
+}
+
+func (db *localDatabase) CreateServer(ctx context.Context,
+	userID string, name string,
+	serverType server.Type, serverInfo interface{}) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	id, err := newServerID()
+	if err != nil {
+		return "", err
+	}
+	err = db.bolt.Update(func(tx *bolt.Tx) error {
+		srv, err := tx.Bucket(serversBucket).CreateBucket([]byte(id))
+		if err != nil {
+			return err
+		}
+		return putJSON(srv, docKey, serverDoc{
+			Name:   name,
+			Type:   serverType,
+			Owners: []string{userID},
+			Info:   serverInfo,
+		})
+	})
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func (db *localDatabase) UpdateServerInfo(ctx context.Context,
+	serverID string, serverInfo interface{}) error {
+	return db.updateDoc(ctx, serverID, func(doc *serverDoc) {
+		doc.Info = serverInfo
+	})
+}
+
+func (db *localDatabase) DeleteServer(ctx context.Context, serverID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return db.bolt.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(serversBucket).DeleteBucket([]byte(serverID))
+		if err == bolt.ErrBucketNotFound {
+			return nil
+		}
+		return err
+	})
+}
+
+func (db *localDatabase) ArchiveServer(ctx context.Context, serverID string) error {
+	return db.updateDoc(ctx, serverID, func(doc *serverDoc) {
+		doc.Archived = true
+	})
+}
+
+func (db *localDatabase) GetServerOwners(ctx context.Context,
+	serverID string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var doc serverDoc
+	err := db.bolt.View(func(tx *bolt.Tx) error {
+		srv := tx.Bucket(serversBucket).Bucket([]byte(serverID))
+		if srv == nil {
+			return fmt.Errorf("unknown server: %s", serverID)
+		}
+		return json.Unmarshal(srv.Get(docKey), &doc)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return doc.Owners, nil
+}
+
+// WatchCommands is not supported, nothing else can queue commands in a local
+// database.
+func (db *localDatabase) WatchCommands(ctx context.Context,
+	serverID string, handler func(Command)) error {
+	return ErrUnsupported
+}
+
+// UpdateCommand is not supported, a local database never has commands to
+// update.
+func (db *localDatabase) UpdateCommand(ctx context.Context,
+	serverID string, cmd Command) error {
+	return ErrUnsupported
+}
+
+// AddServerEvent records the event, keeping only the most recent
+// localMaxEvents events.
+func (db *localDatabase) AddServerEvent(ctx context.Context,
+	serverID string, event interface{}) error {
+	return db.update(ctx, serverID, func(srv *bolt.Bucket) error {
+		events, err := srv.CreateBucketIfNotExists(eventsBucket)
+		if err != nil {
+			return err
+		}
+		seq, err := events.NextSequence()
+		if err != nil {
+			return err
+		}
+		if err := putJSON(events, uint64Key(seq), event); err != nil {
+			return err
+		}
+		if seq <= uint64(localMaxEvents) {
+			return nil
+		}
+		return deleteBefore(events, uint64Key(seq-uint64(localMaxEvents)+1))
+	})
+}
+
+func (db *localDatabase) RecordSession(ctx context.Context,
+	serverID string, session Session) error {
+	return db.update(ctx, serverID, func(srv *bolt.Bucket) error {
+		sessions, err := srv.CreateBucketIfNotExists(sessionsBucket)
+		if err != nil {
+			return err
+		}
+		seq, err := sessions.NextSequence()
+		if err != nil {
+			return err
+		}
+		return putJSON(sessions, uint64Key(seq), session)
+	})
+}
+
+// AddMetricSample records the sample and drops samples older than
+// localSampleRetention. Samples are keyed by time, so the oldest come first.
+func (db *localDatabase) AddMetricSample(ctx context.Context,
+	serverID string, sample MetricSample) error {
+	return db.update(ctx, serverID, func(srv *bolt.Bucket) error {
+		metrics, err := srv.CreateBucketIfNotExists(metricsBucket)
+		if err != nil {
+			return err
+		}
+		seq, err := metrics.NextSequence()
+		if err != nil {
+			return err
+		}
+		key := append(timeKey(sample.Time), uint64Key(seq)...)
+		if err := putJSON(metrics, key, sample); err != nil {
+			return err
+		}
+		cutoff := sample.Time.Add(-localSampleRetention)
+		return deleteBefore(metrics, timeKey(cutoff))
+	})
+}
+
+func (db *localDatabase) MergeMetricRollup(ctx context.Context,
+	serverID string, rollup MetricRollup) error {
+	if rollup.Period != RollupHourly && rollup.Period != RollupDaily {
+		return fmt.Errorf("unknown rollup period: %s", rollup.Period)
+	}
+	key := []byte(string(rollup.Period) + "/" + rollup.Period.DocID(rollup.Start))
+	return db.update(ctx, serverID, func(srv *bolt.Bucket) error {
+		rollups, err := srv.CreateBucketIfNotExists(rollupsBucket)
+		if err != nil {
+			return err
+		}
+		merged := rollup
+		if data := rollups.Get(key); data != nil {
+			if err := json.Unmarshal(data, &merged); err != nil {
+				return err
+			}
+			merged.Merge(rollup)
+		}
+		return putJSON(rollups, key, merged)
+	})
+}
+
+func putJSON(bucket *bolt.Bucket, key []byte, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(key, data)
+}
+
+// deleteBefore deletes every key in the bucket which sorts before limit.
+func deleteBefore(bucket *bolt.Bucket, limit []byte) error {
+	cursor := bucket.Cursor()
+	for key, _ := cursor.First(); key != nil && bytes.Compare(key, limit) < 0; key, _ = cursor.First() {
+		if err := cursor.Delete(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func uint64Key(value uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, value)
+	return key
+}
+
+// timeKey orders times before the epoch first too, by offsetting them by the
+// sign bit.
+func timeKey(t time.Time) []byte {
+	return uint64Key(uint64(t.UnixNano()) ^ (1 << 63))
+}
+
+// newServerID generates a random ID shaped like a firestore document ID.
+func newServerID() (string, error) {
+	buf := make([]byte, 10)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
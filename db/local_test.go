@@ -0,0 +1,178 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func testNewLocalDatabase(t *testing.T) Database {
+	t.Helper()
+	db, err := Open(context.Background(), Config{
+		Backend: "local",
+		Path:    path.Join(t.TempDir(), "local.db"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.(*localDatabase).Close() })
+	return db
+}
+
+// testLocalValues decodes every value in one of the server's buckets, in key
+// order, in to values.
+func testLocalValues(t *testing.T, db Database,
+	serverID string, bucket []byte, values interface{}) {
+	t.Helper()
+	var raw []json.RawMessage
+	err := db.(*localDatabase).bolt.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(serversBucket).Bucket([]byte(serverID)).
+			Bucket(bucket).ForEach(func(key, value []byte) error {
+			raw = append(raw, value)
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, values); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLocalConformance(t *testing.T) {
+	testConformance(t, testNewLocalDatabase)
+}
+
+func TestLocalPersists(t *testing.T) {
+	dbPath := path.Join(t.TempDir(), "local.db")
+	db, err := NewLocalDatabase(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := testCreateServer(t, db)
+	if err := db.(*localDatabase).Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = NewLocalDatabase(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.(*localDatabase).Close()
+	owners, err := db.GetServerOwners(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(owners) != 1 || owners[0] != "test" {
+		t.Errorf("Unexpected owners: %v\n", owners)
+	}
+}
+
+func TestLocalBadFileFails(t *testing.T) {
+	dbPath := path.Join(t.TempDir(), "local.db")
+	if err := ioutil.WriteFile(dbPath, []byte("{["), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewLocalDatabase(dbPath); err == nil {
+		t.Error("Expected an error")
+	}
+}
+
+func TestLocalCommandsUnsupported(t *testing.T) {
+	db := testNewLocalDatabase(t)
+	id := testCreateServer(t, db)
+	err := db.UpdateCommand(context.Background(), id, Command{ID: "cmd"})
+	if !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Expected ErrUnsupported, got: %v\n", err)
+	}
+}
+
+func TestLocalMergesRollups(t *testing.T) {
+	ctx := context.Background()
+	db := testNewLocalDatabase(t)
+	id := testCreateServer(t, db)
+
+	now := time.Now()
+	rollup := NewMetricRollup(RollupHourly, now)
+	rollup.Add(MetricSample{Time: now, Online: true, OnlinePlayers: 2})
+	for i := 0; i < 2; i++ {
+		if err := db.MergeMetricRollup(ctx, id, rollup); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var stored []MetricRollup
+	testLocalValues(t, db, id, rollupsBucket, &stored)
+	if len(stored) != 1 || stored[0].Samples != 2 || stored[0].PlayerSum != 4 {
+		t.Errorf("Unexpected rollups: %+v\n", stored)
+	}
+}
+
+func TestLocalDropsOldSamples(t *testing.T) {
+	ctx := context.Background()
+	db := testNewLocalDatabase(t)
+	id := testCreateServer(t, db)
+
+	now := time.Now()
+	samples := []MetricSample{
+		{Time: now.Add(-localSampleRetention - time.Minute)},
+		{Time: now.Add(-time.Minute)},
+		{Time: now},
+	}
+	for _, sample := range samples {
+		if err := db.AddMetricSample(ctx, id, sample); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var stored []MetricSample
+	testLocalValues(t, db, id, metricsBucket, &stored)
+	if len(stored) != 2 || !stored[0].Time.Equal(samples[1].Time) {
+		t.Errorf("Unexpected samples: %+v\n", stored)
+	}
+}
+
+func TestLocalKeepsRecentEvents(t *testing.T) {
+	defer func(max int) { localMaxEvents = max }(localMaxEvents)
+	localMaxEvents = 2
+
+	ctx := context.Background()
+	db := testNewLocalDatabase(t)
+	id := testCreateServer(t, db)
+	for i := 0; i < 4; i++ {
+		if err := db.AddServerEvent(ctx, id, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var stored []int
+	testLocalValues(t, db, id, eventsBucket, &stored)
+	if len(stored) != 2 || stored[0] != 2 || stored[1] != 3 {
+		t.Errorf("Unexpected events: %v\n", stored)
+	}
+}
+
+func TestLocalLocksFile(t *testing.T) {
+	defer func(timeout time.Duration) {
+		localOpenTimeout = timeout
+	}(localOpenTimeout)
+	localOpenTimeout = 10 * time.Millisecond
+
+	dbPath := path.Join(t.TempDir(), "local.db")
+	db, err := NewLocalDatabase(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.(*localDatabase).Close()
+	if _, err := NewLocalDatabase(dbPath); err == nil {
+		t.Error("Expected an error")
+	}
+}
@@ -0,0 +1,51 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	firestore "cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// AddMetricSample adds a sample to the server's metrics subcollection.
+func (db *database) AddMetricSample(ctx context.Context,
+	serverID string, sample MetricSample) error {
+	_, _, err := db.store.Collection("servers").Doc(serverID).
+		Collection("metrics").Add(ctx, sample)
+	return err
+}
+
+// MergeMetricRollup merges a rollup in to the stored rollup for the same
+// period, creating it if needed.
+func (db *database) MergeMetricRollup(ctx context.Context,
+	serverID string, rollup MetricRollup) error {
+	var collection string
+	switch rollup.Period {
+	case RollupHourly:
+		collection = "metrics_hourly"
+	case RollupDaily:
+		collection = "metrics_daily"
+	default:
+		return fmt.Errorf("unknown rollup period: %s", rollup.Period)
+	}
+	ref := db.store.Collection("servers").Doc(serverID).
+		Collection(collection).Doc(rollup.Period.DocID(rollup.Start))
+	return db.store.RunTransaction(ctx,
+		func(ctx context.Context, tx *firestore.Transaction) error {
+			merged := rollup
+			snap, err := tx.Get(ref)
+			switch {
+			case status.Code(err) == codes.NotFound:
+			case err != nil:
+				return err
+			default:
+				if err := snap.DataTo(&merged); err != nil {
+					return err
+				}
+				merged.Merge(rollup)
+			}
+			return tx.Set(ref, merged)
+		})
+}
@@ -0,0 +1,95 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	firestore "cloud.google.com/go/firestore"
+)
+
+// DefaultBackend is used when the config does not name a backend.
+const DefaultBackend = "firestore"
+
+// ErrUnsupported is returned by backends which can not perform an operation,
+// like watching for commands from a write only webhook.
+var ErrUnsupported = errors.New("operation is not supported by the database backend")
+
+// Config selects and configures a database backend. Fields which do not
+// apply to the selected backend are ignored.
+type Config struct {
+	// Backend is the name of a registered backend.
+	Backend string `json:",omitempty"`
+	// Path is the file the local backend stores data in.
+	Path string `json:",omitempty"`
+	// URL is the endpoint the webhook backend posts to.
+	URL string `json:",omitempty"`
+	// Headers are added to every webhook request, for example to
+	// authenticate with the endpoint.
+	Headers map[string]string `json:",omitempty"`
+
+	// Firestore creates the client used by the firestore backend.
+	Firestore func(context.Context) (*firestore.Client, error) `json:"-"`
+}
+
+// Backend opens a database using the config.
+type Backend func(context.Context, Config) (Database, error)
+
+var (
+	backendsMtx sync.Mutex
+	backends    = make(map[string]Backend)
+)
+
+func init() {
+	Register("firestore", openFirestore)
+	Register("local", openLocal)
+	Register("webhook", openWebhook)
+}
+
+// Register makes a backend available to Open under name. Registering the
+// same name twice replaces the earlier backend.
+func Register(name string, backend Backend) {
+	backendsMtx.Lock()
+	defer backendsMtx.Unlock()
+	backends[name] = backend
+}
+
+// Backends lists the names of the registered backends.
+func Backends() []string {
+	backendsMtx.Lock()
+	defer backendsMtx.Unlock()
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Open opens a database with the backend named in the config.
+func Open(ctx context.Context, cfg Config) (Database, error) {
+	name := cfg.Backend
+	if name == "" {
+		name = DefaultBackend
+	}
+	backendsMtx.Lock()
+	backend, ok := backends[name]
+	backendsMtx.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown database backend: %s", name)
+	}
+	return backend(ctx, cfg)
+}
+
+func openFirestore(ctx context.Context, cfg Config) (Database, error) {
+	if cfg.Firestore == nil {
+		return nil, fmt.Errorf("firestore backend requires a firestore client")
+	}
+	store, err := cfg.Firestore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return NewDatabase(ctx, store)
+}
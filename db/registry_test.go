@@ -0,0 +1,17 @@
+package db
+
+import (
+	"context"
+	"testing"
+)
+
+func TestOpenUnknownBackendFails(t *testing.T) {
+	_, err := Open(context.Background(), Config{Backend: "unknown"})
+	if err == nil {
+		t.Error("Expected an error")
+	}
+	_, err = Open(context.Background(), Config{})
+	if err == nil {
+		t.Error("Expected firestore to require a client")
+	}
+}
@@ -1,12 +1,181 @@
 package db
 
 import (
+	"time"
+
 	"github.com/Coderlane/minecraft-sidecart/server"
 )
 
 type serverDoc struct {
-	Name   string      `firestore:"name"`
-	Type   server.Type `firestore:"type"`
-	Owners []string    `firestore:"owners"`
-	Info   interface{} `firestore:"info"`
+	Name     string      `json:"name" firestore:"name"`
+	Type     server.Type `json:"type" firestore:"type"`
+	Owners   []string    `json:"owners" firestore:"owners"`
+	Info     interface{} `json:"info" firestore:"info"`
+	Archived bool        `json:"archived" firestore:"archived"`
+}
+
+// CommandStatus is the state of a queued command.
+type CommandStatus string
+
+const (
+	// CommandPending commands are waiting to be run by the daemon.
+	CommandPending CommandStatus = "pending"
+	// CommandRunning commands have been picked up by the daemon.
+	CommandRunning CommandStatus = "running"
+	// CommandSucceeded commands ran successfully.
+	CommandSucceeded CommandStatus = "succeeded"
+	// CommandFailed commands could not be run on the server.
+	CommandFailed CommandStatus = "failed"
+	// CommandRejected commands were requested by a user who does not own
+	// the server.
+	CommandRejected CommandStatus = "rejected"
+	// CommandCancelled commands were cancelled by an owner before the daemon
+	// ran them.
+	CommandCancelled CommandStatus = "cancelled"
+)
+
+// Command is a command queued for a server in the `commands` subcollection.
+type Command struct {
+	ID          string        `json:"id" firestore:"-"`
+	Command     string        `json:"command" firestore:"command"`
+	RequestedBy string        `json:"requested_by" firestore:"requested_by"`
+	Status      CommandStatus `json:"status" firestore:"status"`
+	Output      string        `json:"output" firestore:"output"`
+	Error       string        `json:"error" firestore:"error"`
+	CreatedAt   time.Time     `json:"created_at" firestore:"created_at"`
+	StartedAt   time.Time     `json:"started_at" firestore:"started_at"`
+	FinishedAt  time.Time     `json:"finished_at" firestore:"finished_at"`
+}
+
+// Session is a single visit to a server by a player in the `sessions`
+// subcollection.
+type Session struct {
+	PlayerUUID string    `json:"player_uuid" firestore:"player_uuid"`
+	PlayerName string    `json:"player_name" firestore:"player_name"`
+	JoinedAt   time.Time `json:"joined_at" firestore:"joined_at"`
+	LeftAt     time.Time `json:"left_at" firestore:"left_at"`
+	// DurationSeconds is the length of the session in seconds.
+	DurationSeconds int64 `json:"duration_seconds" firestore:"duration_seconds"`
+}
+
+// MetricSample is a point-in-time measurement of a server in the `metrics`
+// subcollection.
+type MetricSample struct {
+	Time          time.Time `json:"time" firestore:"time"`
+	Online        bool      `json:"online" firestore:"online"`
+	OnlinePlayers int       `json:"online_players" firestore:"online_players"`
+	// LatencyMS is how long the server took to respond to a status ping.
+	LatencyMS float64 `json:"latency_ms" firestore:"latency_ms"`
+	// TPS is nil when the server can't report its ticks per second.
+	TPS *float64 `json:"tps" firestore:"tps"`
+}
+
+// RollupPeriod is the length of time covered by a MetricRollup.
+type RollupPeriod string
+
+const (
+	// RollupHourly rollups are stored in the `metrics_hourly` subcollection.
+	RollupHourly RollupPeriod = "hourly"
+	// RollupDaily rollups are stored in the `metrics_daily` subcollection.
+	RollupDaily RollupPeriod = "daily"
+)
+
+// Truncate returns the start of the period containing t, in UTC.
+func (period RollupPeriod) Truncate(t time.Time) time.Time {
+	t = t.UTC()
+	if period == RollupDaily {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return t.Truncate(time.Hour)
+}
+
+// DocID returns the ID of the rollup document for the period starting at
+// start.
+func (period RollupPeriod) DocID(start time.Time) string {
+	if period == RollupDaily {
+		return start.UTC().Format("20060102")
+	}
+	return start.UTC().Format("2006010215")
+}
+
+// MetricRollup summarizes the metric samples taken over a period. Sums are
+// stored so partial rollups can be merged, the averages are derived from
+// them.
+type MetricRollup struct {
+	Period RollupPeriod `json:"period" firestore:"period"`
+	Start  time.Time    `json:"start" firestore:"start"`
+
+	Samples       int64   `json:"samples" firestore:"samples"`
+	OnlineSamples int64   `json:"online_samples" firestore:"online_samples"`
+	PlayerSum     int64   `json:"player_sum" firestore:"player_sum"`
+	MaxPlayers    int     `json:"max_players" firestore:"max_players"`
+	LatencySumMS  float64 `json:"latency_sum_ms" firestore:"latency_sum_ms"`
+	TPSSamples    int64   `json:"tps_samples" firestore:"tps_samples"`
+	TPSSum        float64 `json:"tps_sum" firestore:"tps_sum"`
+
+	// Uptime is the fraction of samples where the server was online.
+	Uptime       float64 `json:"uptime" firestore:"uptime"`
+	AvgPlayers   float64 `json:"avg_players" firestore:"avg_players"`
+	AvgLatencyMS float64 `json:"avg_latency_ms" firestore:"avg_latency_ms"`
+	AvgTPS       float64 `json:"avg_tps" firestore:"avg_tps"`
+}
+
+// NewMetricRollup creates an empty rollup for the period containing t.
+func NewMetricRollup(period RollupPeriod, t time.Time) MetricRollup {
+	return MetricRollup{
+		Period: period,
+		Start:  period.Truncate(t),
+	}
+}
+
+// Contains checks if t is within the rollup's period.
+func (rollup *MetricRollup) Contains(t time.Time) bool {
+	return rollup.Period.Truncate(t).Equal(rollup.Start)
+}
+
+// Add includes a sample in the rollup.
+func (rollup *MetricRollup) Add(sample MetricSample) {
+	rollup.Samples++
+	if sample.Online {
+		rollup.OnlineSamples++
+		rollup.LatencySumMS += sample.LatencyMS
+	}
+	rollup.PlayerSum += int64(sample.OnlinePlayers)
+	if sample.OnlinePlayers > rollup.MaxPlayers {
+		rollup.MaxPlayers = sample.OnlinePlayers
+	}
+	if sample.TPS != nil {
+		rollup.TPSSamples++
+		rollup.TPSSum += *sample.TPS
+	}
+	rollup.updateAverages()
+}
+
+// Merge combines another rollup for the same period in to this one.
+func (rollup *MetricRollup) Merge(other MetricRollup) {
+	rollup.Samples += other.Samples
+	rollup.OnlineSamples += other.OnlineSamples
+	rollup.PlayerSum += other.PlayerSum
+	if other.MaxPlayers > rollup.MaxPlayers {
+		rollup.MaxPlayers = other.MaxPlayers
+	}
+	rollup.LatencySumMS += other.LatencySumMS
+	rollup.TPSSamples += other.TPSSamples
+	rollup.TPSSum += other.TPSSum
+	rollup.updateAverages()
+}
+
+func (rollup *MetricRollup) updateAverages() {
+	rollup.Uptime, rollup.AvgPlayers = 0, 0
+	rollup.AvgLatencyMS, rollup.AvgTPS = 0, 0
+	if rollup.Samples > 0 {
+		rollup.Uptime = float64(rollup.OnlineSamples) / float64(rollup.Samples)
+		rollup.AvgPlayers = float64(rollup.PlayerSum) / float64(rollup.Samples)
+	}
+	if rollup.OnlineSamples > 0 {
+		rollup.AvgLatencyMS = rollup.LatencySumMS / float64(rollup.OnlineSamples)
+	}
+	if rollup.TPSSamples > 0 {
+		rollup.AvgTPS = rollup.TPSSum / float64(rollup.TPSSamples)
+	}
 }
@@ -0,0 +1,49 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMetricRollupAddAndMerge(t *testing.T) {
+	start := time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC)
+	tps := 20.0
+
+	first := NewMetricRollup(RollupHourly, start)
+	first.Add(MetricSample{Time: start, Online: true,
+		OnlinePlayers: 4, LatencyMS: 10, TPS: &tps})
+	first.Add(MetricSample{Time: start})
+
+	second := NewMetricRollup(RollupHourly, start)
+	second.Add(MetricSample{Time: start, Online: true,
+		OnlinePlayers: 2, LatencyMS: 20})
+	first.Merge(second)
+
+	if first.Samples != 3 || first.MaxPlayers != 4 {
+		t.Errorf("Unexpected rollup: %+v\n", first)
+	}
+	if first.AvgPlayers != 2 || first.AvgLatencyMS != 15 || first.AvgTPS != 20 {
+		t.Errorf("Unexpected averages: %+v\n", first)
+	}
+	if first.Uptime < 0.66 || first.Uptime > 0.67 {
+		t.Errorf("Unexpected uptime: %f\n", first.Uptime)
+	}
+}
+
+func TestRollupPeriodTruncate(t *testing.T) {
+	now := time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC)
+	hourly := RollupHourly.Truncate(now)
+	if !hourly.Equal(time.Date(2021, 2, 3, 4, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected hourly start: %v\n", hourly)
+	}
+	if RollupHourly.DocID(hourly) != "2021020304" {
+		t.Errorf("Unexpected hourly id: %s\n", RollupHourly.DocID(hourly))
+	}
+	daily := RollupDaily.Truncate(now)
+	if !daily.Equal(time.Date(2021, 2, 3, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected daily start: %v\n", daily)
+	}
+	if RollupDaily.DocID(daily) != "20210203" {
+		t.Errorf("Unexpected daily id: %s\n", RollupDaily.DocID(daily))
+	}
+}
@@ -0,0 +1,201 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/Coderlane/minecraft-sidecart/server"
+)
+
+// webhookTimeout is used for webhook requests when the context has no
+// deadline.
+var webhookTimeout = time.Second * 10
+
+// Webhook request types, sent in WebhookRequest.Type.
+const (
+	WebhookCreateServer      = "create_server"
+	WebhookUpdateServerInfo  = "update_server_info"
+	WebhookDeleteServer      = "delete_server"
+	WebhookArchiveServer     = "archive_server"
+	WebhookUpdateCommand     = "update_command"
+	WebhookAddServerEvent    = "add_server_event"
+	WebhookRecordSession     = "record_session"
+	WebhookAddMetricSample   = "add_metric_sample"
+	WebhookMergeMetricRollup = "merge_metric_rollup"
+)
+
+// WebhookRequest is the JSON body the webhook backend posts for every write.
+type WebhookRequest struct {
+	Type     string      `json:"type"`
+	ServerID string      `json:"server_id"`
+	Time     time.Time   `json:"time"`
+	Data     interface{} `json:"data,omitempty"`
+}
+
+// WebhookCreateServerData is the data sent with a create_server request.
+type WebhookCreateServerData struct {
+	Name   string      `json:"name"`
+	Type   server.Type `json:"type"`
+	Owners []string    `json:"owners"`
+	Info   interface{} `json:"info"`
+}
+
+// WebhookCreateServerResponse may be returned by the endpoint in response to
+// a create_server request to choose the ID of the new server.
+type WebhookCreateServerResponse struct {
+	ID string `json:"id"`
+}
+
+// webhookDatabase posts every write to an HTTP endpoint. It can not read
+// anything back, so owners and commands are not supported.
+type webhookDatabase struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+// NewWebhookDatabase creates a database which posts JSON to url. Any headers
+// are added to each request.
+func NewWebhookDatabase(url string, headers map[string]string) Database {
+	return &webhookDatabase{
+		url:     url,
+		headers: headers,
+		client:  &http.Client{},
+	}
+}
+
+func openWebhook(ctx context.Context, cfg Config) (Database, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("webhook backend requires a url")
+	}
+	return NewWebhookDatabase(cfg.URL, cfg.Headers), nil
+}
+
+// post sends a request to the endpoint and decodes the response in to resp,
+// if it is set and the endpoint returned a body.
+func (db *webhookDatabase) post(ctx context.Context,
+	reqType, serverID string, data interface{}, resp interface{}) error {
+	body, err := json.Marshal(WebhookRequest{
+		Type:     reqType,
+		ServerID: serverID,
+		Time:     time.Now(),
+		Data:     data,
+	})
+	if err != nil {
+		return err
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, webhookTimeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx,
+		http.MethodPost, db.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range db.headers {
+		req.Header.Set(key, value)
+	}
+	httpResp, err := db.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode < 200 || httpResp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(httpResp.Body, 512))
+		return fmt.Errorf("webhook %s failed: %s: %s",
+			reqType, httpResp.Status, bytes.TrimSpace(msg))
+	}
+	if resp == nil {
+		return nil
+	}
+	err = json.NewDecoder(httpResp.Body).Decode(resp)
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+func (db *webhookDatabase) CreateServer(ctx context.Context,
+	userID string, name string,
+	serverType server.Type, serverInfo interface{}) (string, error) {
+	id, err := newServerID()
+	if err != nil {
+		return "", err
+	}
+	var resp WebhookCreateServerResponse
+	err = db.post(ctx, WebhookCreateServer, id, WebhookCreateServerData{
+		Name:   name,
+		Type:   serverType,
+		Owners: []string{userID},
+		Info:   serverInfo,
+	}, &resp)
+	if err != nil {
+		return "", err
+	}
+	if resp.ID != "" {
+		id = resp.ID
+	}
+	return id, nil
+}
+
+func (db *webhookDatabase) UpdateServerInfo(ctx context.Context,
+	serverID string, serverInfo interface{}) error {
+	return db.post(ctx, WebhookUpdateServerInfo, serverID, serverInfo, nil)
+}
+
+func (db *webhookDatabase) DeleteServer(ctx context.Context, serverID string) error {
+	return db.post(ctx, WebhookDeleteServer, serverID, nil, nil)
+}
+
+func (db *webhookDatabase) ArchiveServer(ctx context.Context, serverID string) error {
+	return db.post(ctx, WebhookArchiveServer, serverID, nil, nil)
+}
+
+func (db *webhookDatabase) GetServerOwners(ctx context.Context,
+	serverID string) ([]string, error) {
+	return nil, ErrUnsupported
+}
+
+func (db *webhookDatabase) WatchCommands(ctx context.Context,
+	serverID string, handler func(Command)) error {
+	return ErrUnsupported
+}
+
+func (db *webhookDatabase) UpdateCommand(ctx context.Context,
+	serverID string, cmd Command) error {
+	return db.post(ctx, WebhookUpdateCommand, serverID, cmd, nil)
+}
+
+func (db *webhookDatabase) AddServerEvent(ctx context.Context,
+	serverID string, event interface{}) error {
+	return db.post(ctx, WebhookAddServerEvent, serverID, event, nil)
+}
+
+func (db *webhookDatabase) RecordSession(ctx context.Context,
+	serverID string, session Session) error {
+	return db.post(ctx, WebhookRecordSession, serverID, session, nil)
+}
+
+func (db *webhookDatabase) AddMetricSample(ctx context.Context,
+	serverID string, sample MetricSample) error {
+	return db.post(ctx, WebhookAddMetricSample, serverID, sample, nil)
+}
+
+// MergeMetricRollup posts the partial rollup. The endpoint is responsible for
+// merging it with any rollup it already has for the period.
+func (db *webhookDatabase) MergeMetricRollup(ctx context.Context,
+	serverID string, rollup MetricRollup) error {
+	if rollup.Period != RollupHourly && rollup.Period != RollupDaily {
+		return fmt.Errorf("unknown rollup period: %s", rollup.Period)
+	}
+	return db.post(ctx, WebhookMergeMetricRollup, serverID, rollup, nil)
+}
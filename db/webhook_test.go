@@ -0,0 +1,108 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+const testWebhookToken = "Bearer hunter2"
+
+// fakeWebhook accepts webhook requests for the servers it created.
+type fakeWebhook struct {
+	mtx      sync.Mutex
+	servers  map[string]bool
+	requests []WebhookRequest
+}
+
+func (fw *fakeWebhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != testWebhookToken {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fw.mtx.Lock()
+	defer fw.mtx.Unlock()
+	fw.requests = append(fw.requests, req)
+	switch {
+	case req.Type == WebhookCreateServer:
+		fw.servers[req.ServerID] = true
+	case !fw.servers[req.ServerID]:
+		http.Error(w, "unknown server", http.StatusNotFound)
+	case req.Type == WebhookDeleteServer:
+		delete(fw.servers, req.ServerID)
+	}
+}
+
+func testNewWebhook(t *testing.T) (*fakeWebhook, Database) {
+	t.Helper()
+	fw := &fakeWebhook{servers: make(map[string]bool)}
+	srv := httptest.NewServer(fw)
+	t.Cleanup(srv.Close)
+	db, err := Open(context.Background(), Config{
+		Backend: "webhook",
+		URL:     srv.URL,
+		Headers: map[string]string{"Authorization": testWebhookToken},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fw, db
+}
+
+func TestWebhookConformance(t *testing.T) {
+	testConformance(t, func(t *testing.T) Database {
+		_, db := testNewWebhook(t)
+		return db
+	})
+}
+
+func TestWebhookSendsRequests(t *testing.T) {
+	fw, db := testNewWebhook(t)
+	id := testCreateServer(t, db)
+	err := db.RecordSession(context.Background(), id, Session{PlayerName: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fw.requests) != 2 {
+		t.Fatalf("Unexpected requests: %+v\n", fw.requests)
+	}
+	req := fw.requests[1]
+	data, _ := req.Data.(map[string]interface{})
+	if req.Type != WebhookRecordSession || req.ServerID != id ||
+		data["player_name"] != "test" {
+		t.Errorf("Unexpected request: %+v\n", req)
+	}
+}
+
+func TestWebhookUsesReturnedID(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(WebhookCreateServerResponse{ID: "chosen"})
+		}))
+	defer srv.Close()
+	db := NewWebhookDatabase(srv.URL, nil)
+	if id := testCreateServer(t, db); id != "chosen" {
+		t.Errorf("Expected: chosen Got: %s\n", id)
+	}
+}
+
+func TestWebhookUnauthorizedFails(t *testing.T) {
+	fw := &fakeWebhook{servers: make(map[string]bool)}
+	srv := httptest.NewServer(fw)
+	defer srv.Close()
+	db := NewWebhookDatabase(srv.URL, nil)
+	err := db.DeleteServer(context.Background(), "test")
+	if err == nil {
+		t.Error("Expected an error")
+	}
+	t.Log(err)
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/zalando/go-keyring"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+
+	"github.com/Coderlane/minecraft-sidecart/firebase"
+)
+
+// userCacheKeyName is the name of the key in the systemd credentials
+// directory, for example set with `LoadCredential=user-cache-key:/path`.
+const userCacheKeyName = "user-cache-key"
+
+// minUserCacheKeyLen is the minimum length of a key file.
+const minUserCacheKeyLen = 16
+
+const (
+	// userCacheSaltSize is the size of the random salt stored at the start
+	// of the file.
+	userCacheSaltSize  = 16
+	userCacheNonceSize = 24
+)
+
+// scrypt parameters used to derive the encryption key from the key file, the
+// recommended interactive parameters from the scrypt package.
+const (
+	userCacheScryptN = 1 << 15
+	userCacheScryptR = 8
+	userCacheScryptP = 1
+)
+
+// FileUserCache implements the UserCache interface by caching users in an
+// encrypted file. It is meant for systems without a keyring, such as minimal
+// servers without a Secret Service.
+//
+// The file is sealed with NaCl's secretbox. The key is derived from the key
+// file's contents with scrypt and a random salt kept at the start of the
+// file, so a key file holding a passphrase is not easily guessed. The key
+// must be kept apart from the file, see FindUserCacheKey.
+type FileUserCache struct {
+	mtx    sync.Mutex
+	path   string
+	secret []byte
+	// salt and key cache the last derived key, scrypt is deliberately slow.
+	salt []byte
+	key  *[32]byte
+}
+
+// NewFileUserCache creates a new FileUserCache stored at path and encrypted
+// with the contents of keyFile.
+func NewFileUserCache(path, keyFile string) (*FileUserCache, error) {
+	secret, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	secret = []byte(strings.TrimSpace(string(secret)))
+	if len(secret) < minUserCacheKeyLen {
+		return nil, fmt.Errorf("user cache key %s is shorter than %d bytes",
+			keyFile, minUserCacheKeyLen)
+	}
+	return &FileUserCache{
+		path:   path,
+		secret: secret,
+	}, nil
+}
+
+// ErrNoUserCacheKey is returned when the file user cache has no key. A key is
+// never generated, storing it next to the file would not protect the file.
+var ErrNoUserCacheKey = errors.New("the file user cache needs a key, " +
+	"pass --user-cache-key-file or set the " + userCacheKeyName +
+	" systemd credential")
+
+// DefaultUserCacheDir returns the directory holding the file user cache,
+// under $XDG_CONFIG_HOME.
+func DefaultUserCacheDir() string {
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if configDir == "" {
+		configDir = path.Join(os.Getenv("HOME"), ".config")
+	}
+	return path.Join(configDir, "minecraft-sidecart")
+}
+
+// FindUserCacheKey returns the key file for the file user cache from the
+// systemd credentials directory, or ErrNoUserCacheKey if there is none.
+func FindUserCacheKey() (string, error) {
+	credsDir := os.Getenv("CREDENTIALS_DIRECTORY")
+	if credsDir == "" {
+		return "", ErrNoUserCacheKey
+	}
+	keyFile := path.Join(credsDir, userCacheKeyName)
+	if _, err := os.Stat(keyFile); err != nil {
+		return "", ErrNoUserCacheKey
+	}
+	return keyFile, nil
+}
+
+// keyringAvailable reports whether the system keyring can be used.
+func keyringAvailable(projectID string) bool {
+	_, err := keyring.Get(projectID, userIndexKey)
+	return err == nil || err == keyring.ErrNotFound
+}
+
+// Get will fetch a user from the cache.
+// If no user is found, it returns (nil, nil)
+func (fuc *FileUserCache) Get(userID string) (*firebase.User, error) {
+	fuc.mtx.Lock()
+	defer fuc.mtx.Unlock()
+	users, err := fuc.load()
+	if err != nil {
+		return nil, err
+	}
+	return users[userID], nil
+}
+
+// Set adds a user to the user cache.
+func (fuc *FileUserCache) Set(userID string, user *firebase.User) error {
+	fuc.mtx.Lock()
+	defer fuc.mtx.Unlock()
+	users, err := fuc.load()
+	if err != nil {
+		return err
+	}
+	users[userID] = user
+	return fuc.save(users)
+}
+
+// Delete removes a user from the user cache.
+func (fuc *FileUserCache) Delete(userID string) {
+	fuc.mtx.Lock()
+	defer fuc.mtx.Unlock()
+	users, err := fuc.load()
+	if err != nil {
+		return
+	}
+	delete(users, userID)
+	fuc.save(users)
+}
+
+// List returns the names of every cached user.
+func (fuc *FileUserCache) List() ([]string, error) {
+	fuc.mtx.Lock()
+	defer fuc.mtx.Unlock()
+	users, err := fuc.load()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(users))
+	for name := range users {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// deriveKey returns the key for salt, reusing the last derived key if the
+// salt has not changed.
+func (fuc *FileUserCache) deriveKey(salt []byte) (*[32]byte, error) {
+	if fuc.key != nil && bytes.Equal(salt, fuc.salt) {
+		return fuc.key, nil
+	}
+	derived, err := scrypt.Key(fuc.secret, salt,
+		userCacheScryptN, userCacheScryptR, userCacheScryptP, 32)
+	if err != nil {
+		return nil, err
+	}
+	var key [32]byte
+	copy(key[:], derived)
+	fuc.salt = append([]byte{}, salt...)
+	fuc.key = &key
+	return fuc.key, nil
+}
+
+// load decrypts the cached users. A missing file is an empty cache. The file
+// holds the salt, then the nonce, then the sealed users.
+func (fuc *FileUserCache) load() (map[string]*firebase.User, error) {
+	users := make(map[string]*firebase.User)
+	data, err := ioutil.ReadFile(fuc.path)
+	if os.IsNotExist(err) {
+		return users, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < userCacheSaltSize+userCacheNonceSize+secretbox.Overhead {
+		return nil, fmt.Errorf("user cache %s is corrupt", fuc.path)
+	}
+	salt := data[:userCacheSaltSize]
+	var nonce [userCacheNonceSize]byte
+	copy(nonce[:], data[userCacheSaltSize:])
+	sealed := data[userCacheSaltSize+userCacheNonceSize:]
+	key, err := fuc.deriveKey(salt)
+	if err != nil {
+		return nil, err
+	}
+	plain, ok := secretbox.Open(nil, sealed, &nonce, key)
+	if !ok {
+		return nil, fmt.Errorf(
+			"failed to decrypt user cache %s, is the key correct?", fuc.path)
+	}
+	if err := json.Unmarshal(plain, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// save encrypts and atomically replaces the cached users. The salt of the
+// existing file is kept so the key does not need to be derived again.
+func (fuc *FileUserCache) save(users map[string]*firebase.User) error {
+	plain, err := json.Marshal(users)
+	if err != nil {
+		return err
+	}
+	salt := fuc.salt
+	if salt == nil {
+		salt = make([]byte, userCacheSaltSize)
+		if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+			return err
+		}
+	}
+	key, err := fuc.deriveKey(salt)
+	if err != nil {
+		return err
+	}
+	var nonce [userCacheNonceSize]byte
+	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		return err
+	}
+	data := append(append([]byte{}, salt...), nonce[:]...)
+	data = secretbox.Seal(data, plain, &nonce, key)
+	if err := os.MkdirAll(path.Dir(fuc.path), 0700); err != nil {
+		return err
+	}
+	tmpPath := fuc.path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, fuc.path)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+	"github.com/zalando/go-keyring"
+
+	"github.com/Coderlane/minecraft-sidecart/firebase"
+)
+
+func testFileUserCache(t *testing.T, dir string) *FileUserCache {
+	t.Helper()
+	keyFile := path.Join(t.TempDir(), userCacheKeyName)
+	err := ioutil.WriteFile(keyFile, []byte("a key kept elsewhere"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fuc, err := NewFileUserCache(path.Join(dir, "users.enc"), keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fuc
+}
+
+func TestFileUserCacheGetSet(t *testing.T) {
+	dir := t.TempDir()
+	fuc := testFileUserCache(t, dir)
+	user, err := fuc.Get(testUserID)
+	if user != nil || err != nil {
+		t.Errorf("Expected no user: %v %v", user, err)
+	}
+
+	input := &firebase.User{UserID: "test", RefreshToken: "secret_token"}
+	if err := fuc.Set(testUserID, input); err != nil {
+		t.Fatal(err)
+	}
+	if err := fuc.Set("team", input); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new cache with the same key reads the same users.
+	fuc = testFileUserCache(t, dir)
+	output, err := fuc.Get(testUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(input, output) {
+		t.Errorf("Expected %+v got %+v", input, output)
+	}
+	names, err := fuc.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{"team", testUserID}) {
+		t.Errorf("Unexpected users: %v", names)
+	}
+
+	data, err := ioutil.ReadFile(path.Join(dir, "users.enc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("secret_token")) {
+		t.Errorf("Expected the user cache to be encrypted")
+	}
+	info, err := os.Stat(path.Join(dir, "users.enc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected a private user cache: %v", info.Mode())
+	}
+
+	fuc.Delete(testUserID)
+	if user, _ := fuc.Get(testUserID); user != nil {
+		t.Errorf("Expected the user to be deleted: %v", user)
+	}
+}
+
+func TestFileUserCacheWrongKeyFails(t *testing.T) {
+	dir := t.TempDir()
+	fuc := testFileUserCache(t, dir)
+	if err := fuc.Set(testUserID, &firebase.User{UserID: "test"}); err != nil {
+		t.Fatal(err)
+	}
+
+	keyFile := path.Join(t.TempDir(), "key")
+	if err := ioutil.WriteFile(keyFile, []byte("another key of some length"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewFileUserCache(path.Join(dir, "users.enc"), keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Get(testUserID); err == nil {
+		t.Errorf("Expected decrypting with the wrong key to fail")
+	}
+}
+
+func TestFileUserCacheShortKeyFails(t *testing.T) {
+	keyFile := path.Join(t.TempDir(), "key")
+	if err := ioutil.WriteFile(keyFile, []byte("short"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileUserCache(path.Join(t.TempDir(), "users.enc"), keyFile); err == nil {
+		t.Errorf("Expected a short key to fail")
+	}
+}
+
+func TestFindUserCacheKeyUsesCredentials(t *testing.T) {
+	credsDir := t.TempDir()
+	keyFile := path.Join(credsDir, userCacheKeyName)
+	if err := ioutil.WriteFile(keyFile, []byte("a systemd credential"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CREDENTIALS_DIRECTORY", credsDir)
+	found, err := FindUserCacheKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != keyFile {
+		t.Errorf("Expected %s got %s", keyFile, found)
+	}
+}
+
+func TestFindUserCacheKeyRequiresKey(t *testing.T) {
+	t.Setenv("CREDENTIALS_DIRECTORY", "")
+	if _, err := FindUserCacheKey(); err != ErrNoUserCacheKey {
+		t.Errorf("Expected ErrNoUserCacheKey, got: %v", err)
+	}
+	t.Setenv("CREDENTIALS_DIRECTORY", t.TempDir())
+	if _, err := FindUserCacheKey(); err != ErrNoUserCacheKey {
+		t.Errorf("Expected ErrNoUserCacheKey, got: %v", err)
+	}
+}
+
+func testUserCacheContext(kind, keyFile string) (*cli.Context, *bytes.Buffer) {
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	set.String("user-cache", kind, "")
+	set.String("user-cache-key-file", keyFile, "")
+	var errOut bytes.Buffer
+	app := cli.NewApp()
+	app.ErrWriter = &errOut
+	return cli.NewContext(app, set, nil), &errOut
+}
+
+func TestNewUserCacheFallsBackWithoutKey(t *testing.T) {
+	if keyringAvailable(testProjectID) {
+		t.Skip("Test requires no keyring.")
+	}
+	t.Setenv("CREDENTIALS_DIRECTORY", "")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	c, errOut := testUserCacheContext("auto", "")
+	uc, err := newUserCache(c, testProjectID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := uc.(*firebase.MemoryUserCache); !ok {
+		t.Errorf("Expected a memory user cache, got: %T", uc)
+	}
+	if !strings.Contains(errOut.String(), "Warning") {
+		t.Errorf("Expected a warning, got: %q", errOut.String())
+	}
+
+	c, _ = testUserCacheContext("file", "")
+	if _, err := newUserCache(c, testProjectID); err != ErrNoUserCacheKey {
+		t.Errorf("Expected ErrNoUserCacheKey, got: %v", err)
+	}
+}
+
+func TestKeyringAvailable(t *testing.T) {
+	keyring.MockInit()
+	if !keyringAvailable(testProjectID) {
+		t.Errorf("Expected the mock keyring to be available")
+	}
+}
@@ -22,6 +22,9 @@ type App struct {
 	MeasurementID     string
 	ClientID          string
 	ClientSecret      string
+	// RevokeURL is an optional endpoint that revokes the refresh tokens of
+	// the user whose ID token is sent as a bearer token. See `Auth.Revoke`.
+	RevokeURL string
 }
 
 // DefaultApp is the default, built in, firebase application
@@ -35,6 +38,7 @@ func (app *App) NewAuth(opts ...AuthOption) *Auth {
 		app:         app,
 		currentUser: nil,
 		userCache:   &MemoryUserCache{},
+		profile:     DefaultUser,
 	}
 	for _, opt := range opts {
 		opt.Apply(auth)
@@ -44,7 +48,7 @@ func (app *App) NewAuth(opts ...AuthOption) *Auth {
 	if auth.userCache == nil {
 		return auth
 	}
-	user, _ := auth.userCache.Get("default")
+	user, _ := auth.userCache.Get(auth.profile)
 	auth.currentUser = user
 	return auth
 }
@@ -4,10 +4,15 @@ import (
 	"bufio"
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
+	"regexp"
+	"sort"
+	"strings"
 	"sync"
 
 	"golang.org/x/oauth2"
@@ -22,10 +27,62 @@ type AuthProvider int
 const (
 	// GoogleAuthProvider provides support for authenticating with Google
 	GoogleAuthProvider AuthProvider = iota
+	// GitHubAuthProvider provides support for authenticating with GitHub
+	GitHubAuthProvider
+	// MicrosoftAuthProvider provides support for authenticating with
+	// Microsoft
+	MicrosoftAuthProvider
 )
 
 var authProviderConfigs = map[AuthProvider][]byte{}
 
+var authProviderNames = map[AuthProvider]string{
+	GoogleAuthProvider:    "google",
+	GitHubAuthProvider:    "github",
+	MicrosoftAuthProvider: "microsoft",
+}
+
+// authProviderDeviceURLs are the device authorization endpoints of each
+// provider.
+var authProviderDeviceURLs = map[AuthProvider]string{
+	GoogleAuthProvider:    GoogleDeviceAuthURL,
+	GitHubAuthProvider:    "https://github.com/login/device/code",
+	MicrosoftAuthProvider: "https://login.microsoftonline.com/common/oauth2/v2.0/devicecode",
+}
+
+// ParseAuthProvider finds the provider with name, like `google`.
+func ParseAuthProvider(name string) (AuthProvider, error) {
+	for provider, providerName := range authProviderNames {
+		if providerName == name {
+			return provider, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown auth provider: %s", name)
+}
+
+func (provider AuthProvider) String() string {
+	if name, ok := authProviderNames[provider]; ok {
+		return name
+	}
+	return fmt.Sprintf("AuthProvider(%d)", int(provider))
+}
+
+// ID returns the firebase provider ID, like `google.com`.
+func (provider AuthProvider) ID() string {
+	return provider.String() + ".com"
+}
+
+// Firebase provider IDs of the sign in methods that are not an `AuthProvider`.
+const (
+	passwordProviderID = "password"
+	customProviderID   = "custom"
+)
+
+// DeviceAuthURL returns the provider's device authorization endpoint.
+func (provider AuthProvider) DeviceAuthURL() string {
+	return authProviderDeviceURLs[provider]
+}
+
 // UserCache provides an interface for caching authenticated users and their
 // `RefreshToken`. You should avoid backing this with insecure storage like a
 // plaintext file.
@@ -39,9 +96,16 @@ type UserCache interface {
 	Delete(string)
 }
 
+// UserCacheLister is implemented by `UserCache`s which can list the names of
+// the users they hold.
+type UserCacheLister interface {
+	// List returns the names of every cached user, sorted.
+	List() ([]string, error)
+}
+
 const (
 	// DefaultUser represents the default user to be loaded and stored in the
-	// `UserCache`.
+	// `UserCache`. It is also the name of the default profile.
 	DefaultUser = "default"
 )
 
@@ -68,16 +132,35 @@ func (muc *MemoryUserCache) Delete(userID string) {
 	delete(*muc, userID)
 }
 
+// List returns the names of every cached user.
+func (muc MemoryUserCache) List() ([]string, error) {
+	names := make([]string, 0, len(muc))
+	for name := range muc {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
 // Auth handles authenticating users
 type Auth struct {
 	app          *App
 	emulatorHost string
 	idpConfig    *internal.IdpConfig
 	userCache    UserCache
+	provider     AuthProvider
+	// profile is the name the current user is cached under.
+	profile string
 
 	mtx         sync.RWMutex
 	currentUser *User
 	token       *oauth2.Token
+	// refreshing is the refresh in progress, if any.
+	refreshing *refreshCall
+	// reauthErr is set when the refresh token was rejected, the user must
+	// sign in again.
+	reauthErr error
+	onRefresh func(error)
 }
 
 // User contains details of a user from Firebase
@@ -88,6 +171,66 @@ type User struct {
 	DisplayName   string `json:"displayName"`
 	PhotoURL      string `json:"photoUrl"`
 	RefreshToken  string `json:"refreshToken"`
+	// ProviderID is the identity provider the user signed in with, for
+	// example "google.com" or "password". Users cached before it was
+	// recorded have no provider.
+	ProviderID string `json:"providerId,omitempty"`
+}
+
+// Profile returns the name of the profile the current user is cached under.
+func (auth *Auth) Profile() string {
+	return auth.profile
+}
+
+// ForProfile creates a new authentication client for the named profile. It
+// shares the app, user cache and options of auth.
+func (auth *Auth) ForProfile(name string) *Auth {
+	return auth.app.NewAuth(
+		WithUserCache(auth.userCache),
+		WithEmulatorHost(auth.emulatorHost),
+		WithAuthProvider(auth.Provider()),
+		WithProfile(name))
+}
+
+// maxProfileNameLen bounds the length of a profile name.
+const maxProfileNameLen = 64
+
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ValidateProfile returns an error unless name may be used as a profile.
+// Names hold only letters, numbers, '-' and '_', so they can not collide with
+// the keys a user cache keeps for itself, such as its index of users.
+func ValidateProfile(name string) error {
+	if len(name) > maxProfileNameLen || !profileNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid profile name %q, "+
+			"use up to %d letters, numbers, '-' and '_'", name, maxProfileNameLen)
+	}
+	return nil
+}
+
+// Profiles lists the profiles with a cached user. It fails if the user cache
+// can not be listed.
+func (auth *Auth) Profiles() ([]string, error) {
+	lister, ok := auth.userCache.(UserCacheLister)
+	if !ok {
+		return nil, fmt.Errorf("user cache does not support listing profiles")
+	}
+	return lister.List()
+}
+
+// Provider returns the identity provider that new sign ins use.
+func (auth *Auth) Provider() AuthProvider {
+	auth.mtx.RLock()
+	defer auth.mtx.RUnlock()
+	return auth.provider
+}
+
+// SetProvider changes the identity provider that new sign ins use. The
+// `oauth2.Config` passed to each sign in flow must be for the same provider.
+func (auth *Auth) SetProvider(provider AuthProvider) {
+	auth.mtx.Lock()
+	auth.provider = provider
+	auth.mtx.Unlock()
 }
 
 // CurrentUser returns the current authenticated user or nil if no user is
@@ -108,42 +251,107 @@ func (auth *Auth) SignInWithConsole(
 }
 
 // SignInWithConsoleWithIO performs the same operation as SignInWithConsole,
-// but allows for specifying an input `reader` and output `writer.
+// but allows for specifying an input `reader` and output `writer. The user
+// pastes the whole URL they were redirected to, its `state` must match the
+// one that was sent.
 func (auth *Auth) SignInWithConsoleWithIO(
 	ctx context.Context, cfg *oauth2.Config,
 	reader io.Reader, writer io.Writer) (*User, *oauth2.Token, error) {
-	// Force OOB auth for console auth
+	token, err := auth.consoleToken(ctx, cfg, reader, writer)
+	if err != nil {
+		return nil, nil, err
+	}
+	return auth.SignInWithToken(ctx, token)
+}
+
+// consoleRedirectURL is the redirect used by the console flow.
+const consoleRedirectURL = "http://127.0.0.1/"
+
+// consoleToken runs the console flow and returns the OAuth2 token from the
+// provider.
+func (auth *Auth) consoleToken(ctx context.Context, cfg *oauth2.Config,
+	reader io.Reader, writer io.Writer) (*oauth2.Token, error) {
+	// The out of band redirect is deprecated, redirect to a loopback address
+	// which nothing listens on. The user copies the URL from their browser.
 	tmpCfg := *cfg
-	tmpCfg.RedirectURL = "urn:ietf:wg:oauth:2.0:oob"
+	tmpCfg.RedirectURL = consoleRedirectURL
 	state, err := createRandomState()
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	url := tmpCfg.AuthCodeURL(state, oauth2.AccessTypeOffline)
-	fmt.Fprintf(writer, "Visit this url to authenticate: %v\n", url)
-	fmt.Fprintf(writer, "Input code: ")
+	verifier, challenge, err := createCodeVerifier()
+	if err != nil {
+		return nil, err
+	}
+	authURL := tmpCfg.AuthCodeURL(state, oauth2.AccessTypeOffline,
+		oauth2.SetAuthURLParam("code_challenge", challenge),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"))
+	fmt.Fprintf(writer, "Visit this url to authenticate: %v\n", authURL)
+	fmt.Fprintf(writer, "Input the url you were redirected to: ")
 	tokenReader := bufio.NewReader(reader)
-	var code string
-	_, err = fmt.Fscanf(tokenReader, "%s", &code)
+	var input string
+	_, err = fmt.Fscanf(tokenReader, "%s", &input)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	token, err := tmpCfg.Exchange(ctx, code)
+	code, err := parseConsoleInput(input, state)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	return auth.SignInWithToken(ctx, token)
+	return tmpCfg.Exchange(ctx, code,
+		oauth2.SetAuthURLParam("code_verifier", verifier))
+}
+
+// parseConsoleInput extracts the code from the redirect URL the user pasted.
+// A bare code is rejected since it carries no state to check.
+func parseConsoleInput(input, state string) (string, error) {
+	if !strings.Contains(input, "?") {
+		return "", fmt.Errorf("expected the url you were redirected to, " +
+			"including its code and state")
+	}
+	parsed, err := url.Parse(input)
+	if err != nil {
+		return "", err
+	}
+	return parseAuthRedirect(parsed.Query(), state)
 }
 
 // SignInWithToken takes an auth token generated by firebase and exchanges it
 // for a refresh token and a user.
 func (auth *Auth) SignInWithToken(
 	ctx context.Context, token *oauth2.Token) (*User, *oauth2.Token, error) {
-	user, token, err := auth.idpConfig.Exchange(ctx, token)
+	user, token, err := auth.idpConfig.Exchange(ctx, auth.Provider().ID(), token)
+	if err != nil {
+		return nil, nil, err
+	}
+	return auth.setUser(auth.Provider().ID(), user, token)
+}
+
+// SignInWithEmailPassword authenticates with an email and password account.
+// The provider must be enabled in the firebase project.
+func (auth *Auth) SignInWithEmailPassword(ctx context.Context,
+	email, password string) (*User, *oauth2.Token, error) {
+	user, token, err := auth.idpConfig.SignInWithPassword(ctx, email, password)
 	if err != nil {
 		return nil, nil, err
 	}
+	return auth.setUser(passwordProviderID, user, token)
+}
 
+// SignInWithCustomToken authenticates with a custom token minted by the
+// Firebase Admin SDK, for example for a service account.
+func (auth *Auth) SignInWithCustomToken(ctx context.Context,
+	customToken string) (*User, *oauth2.Token, error) {
+	user, token, err := auth.idpConfig.SignInWithCustomToken(ctx, customToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	return auth.setUser(customProviderID, user, token)
+}
+
+// setUser makes the signed in user the current user and caches them.
+func (auth *Auth) setUser(providerID string, user *internal.IdpUser,
+	token *oauth2.Token) (*User, *oauth2.Token, error) {
 	auth.mtx.Lock()
 	auth.currentUser = &User{
 		UserID:        user.LocalID,
@@ -152,69 +360,52 @@ func (auth *Auth) SignInWithToken(
 		DisplayName:   user.DisplayName,
 		PhotoURL:      user.PhotoURL,
 		RefreshToken:  token.RefreshToken,
+		ProviderID:    providerID,
 	}
-	err = auth.userCache.Set(DefaultUser, auth.currentUser)
+	auth.token = token
+	auth.reauthErr = nil
+	err := auth.userCache.Set(auth.profile, auth.currentUser)
 	auth.mtx.Unlock()
 	return auth.currentUser, token, err
 }
 
-func (auth *Auth) signInWithUser(ctx context.Context,
-	user *User) (token *oauth2.Token, err error) {
-	token, err = auth.idpConfig.Refresh(ctx,
+// SignInWithUser authenticates with a firebase user with a refresh token. If
+// the refresh token is rejected the error wraps ErrReauthRequired.
+func (auth *Auth) SignInWithUser(ctx context.Context,
+	user *User) (*oauth2.Token, error) {
+	token, err := auth.idpConfig.Refresh(ctx,
 		&oauth2.Token{RefreshToken: user.RefreshToken})
+	if internal.IsPermanent(err) {
+		return nil, fmt.Errorf("%w: %v", ErrReauthRequired, err)
+	}
 	if err != nil {
 		return nil, err
 	}
-	auth.currentUser = user
-	auth.currentUser.RefreshToken = token.RefreshToken
-	auth.token = token
-	err = auth.userCache.Set(DefaultUser, auth.currentUser)
-	return token, err
-}
-
-// SignInWithUser authenticates with a firebase user with a refresh token.
-func (auth *Auth) SignInWithUser(ctx context.Context,
-	user *User) (token *oauth2.Token, err error) {
+	signedIn := *user
+	signedIn.RefreshToken = token.RefreshToken
 	auth.mtx.Lock()
-	token, err = auth.signInWithUser(ctx, user)
-	auth.mtx.Unlock()
-	return token, err
+	defer auth.mtx.Unlock()
+	auth.currentUser = &signedIn
+	auth.token = token
+	auth.reauthErr = nil
+	return token, auth.userCache.Set(auth.profile, auth.currentUser)
 }
 
-// SignOut deletes the current user from the cache and then resets the current
-// user and token.
+// SignOut deletes the profile's user from the cache and then resets the
+// current user and token.
 func (auth *Auth) SignOut() {
 	auth.mtx.Lock()
-	if auth.currentUser != nil {
-		auth.userCache.Delete(auth.currentUser.UserID)
-	}
+	auth.userCache.Delete(auth.profile)
 	auth.currentUser = nil
 	auth.token = nil
+	auth.reauthErr = nil
 	auth.mtx.Unlock()
 }
 
 // Token implements the TokenSource interface by providing authenticated
-// tokens for the current user.
-func (auth *Auth) Token() (token *oauth2.Token, err error) {
-	auth.mtx.RLock()
-	if auth.token.Valid() {
-		token = auth.token
-	} else if auth.currentUser == nil {
-		err = fmt.Errorf("no user is currently authenticated")
-	}
-	auth.mtx.RUnlock()
-	if token != nil || err != nil {
-		return token, err
-	}
-	auth.mtx.Lock()
-	defer auth.mtx.Unlock()
-	if auth.token.Valid() {
-		token = auth.token
-		return token, nil
-	}
-	// TODO: Get the context from elsewhere
-	ctx := context.Background()
-	return auth.signInWithUser(ctx, auth.currentUser)
+// tokens for the current user. See `TokenContext`.
+func (auth *Auth) Token() (*oauth2.Token, error) {
+	return auth.TokenContext(context.Background())
 }
 
 func createRandomState() (string, error) {
@@ -227,6 +418,19 @@ func createRandomState() (string, error) {
 	return encoded, nil
 }
 
+// createCodeVerifier creates a PKCE code verifier along with its S256 code
+// challenge.
+func createCodeVerifier() (verifier, challenge string, err error) {
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return "", "", err
+	}
+	verifier = base64.RawURLEncoding.EncodeToString(b)
+	sum := sha256.Sum256([]byte(verifier))
+	challenge = base64.RawURLEncoding.EncodeToString(sum[:])
+	return verifier, challenge, nil
+}
+
 // NewOAuthConfig creates a new `oauth.Config` for the provided `AuthProvider`
 // based on the built in auth provider configs.
 func NewOAuthConfig(provider AuthProvider) *oauth2.Config {
@@ -241,6 +445,10 @@ func NewOAuthConfig(provider AuthProvider) *oauth2.Config {
 			"https://www.googleapis.com/auth/userinfo.profile",
 			"openid",
 		}
+	case GitHubAuthProvider:
+		cfg.Scopes = []string{"read:user", "user:email"}
+	case MicrosoftAuthProvider:
+		cfg.Scopes = []string{"openid", "email", "profile", "offline_access"}
 	}
 	return cfg
 }
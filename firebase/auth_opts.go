@@ -33,3 +33,31 @@ func (weh withEmulatorHost) Apply(auth *Auth) {
 func WithEmulatorHost(emulatorHost string) AuthOption {
 	return withEmulatorHost{emulatorHost}
 }
+
+type withAuthProvider struct {
+	provider AuthProvider
+}
+
+func (wap withAuthProvider) Apply(auth *Auth) {
+	auth.provider = wap.provider
+}
+
+// WithAuthProvider sets the identity provider that sign ins use. Google is
+// used by default.
+func WithAuthProvider(provider AuthProvider) AuthOption {
+	return withAuthProvider{provider}
+}
+
+type withProfile struct {
+	profile string
+}
+
+func (wp withProfile) Apply(auth *Auth) {
+	auth.profile = wp.profile
+}
+
+// WithProfile sets the name the user is cached under in the `UserCache`, so
+// several users may be signed in at once. `DefaultUser` is used by default.
+func WithProfile(profile string) AuthOption {
+	return withProfile{profile}
+}
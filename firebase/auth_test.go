@@ -3,6 +3,7 @@ package firebase
 import (
 	"bytes"
 	"context"
+	"io"
 	"os"
 	"reflect"
 	"testing"
@@ -13,13 +14,11 @@ import (
 	"github.com/Coderlane/minecraft-sidecart/internal"
 )
 
-func testAuthBuffer() *bytes.Buffer {
-	var buf bytes.Buffer
-	_, err := buf.WriteString(internal.TestOAuthCode + "\n")
-	if err != nil {
-		panic(err)
-	}
-	return &buf
+// testConsoleIO acts as a user pasting back the URL they were redirected to
+// after visiting the authentication URL written to the writer.
+func testConsoleIO() (io.Reader, io.Writer) {
+	var out bytes.Buffer
+	return &testRedirectReader{out: &out}, &out
 }
 
 func testAppWithAuth(t *testing.T, opts ...AuthOption) (*App, *Auth) {
@@ -43,8 +42,9 @@ func TestSignInWithConsoleAuthenticates(t *testing.T) {
 	muc := MemoryUserCache{}
 	_, auth := testAppWithAuth(t, WithUserCache(&muc))
 
+	reader, writer := testConsoleIO()
 	user, tok, err := auth.SignInWithConsoleWithIO(ctx,
-		tas.Config(t), testAuthBuffer(), os.Stdout)
+		tas.Config(t), reader, writer)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -111,8 +111,9 @@ func TestSignInWithUserAuthenticates(t *testing.T) {
 	ctx := context.Background()
 	_, auth := testAppWithAuth(t)
 
+	reader, writer := testConsoleIO()
 	user, _, err := auth.SignInWithConsoleWithIO(ctx,
-		tas.Config(t), testAuthBuffer(), os.Stdout)
+		tas.Config(t), reader, writer)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -138,14 +139,15 @@ func TestSignOutSignsOut(t *testing.T) {
 	muc := MemoryUserCache{}
 	_, auth := testAppWithAuth(t, WithUserCache(&muc))
 
-	user, _, err := auth.SignInWithConsoleWithIO(ctx,
-		tas.Config(t), testAuthBuffer(), os.Stdout)
+	reader, writer := testConsoleIO()
+	_, _, err := auth.SignInWithConsoleWithIO(ctx,
+		tas.Config(t), reader, writer)
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	auth.SignOut()
-	if found, _ := muc.Get(user.UserID); found != nil {
+	if found, _ := muc.Get(DefaultUser); found != nil {
 		t.Errorf("Expected to not find user in cache.")
 	}
 	if auth.CurrentUser() != nil {
@@ -160,8 +162,9 @@ func TestTokenCacheRefreshes(t *testing.T) {
 	ctx := context.Background()
 	_, auth := testAppWithAuth(t)
 
+	reader, writer := testConsoleIO()
 	user, _, err := auth.SignInWithConsoleWithIO(ctx,
-		tas.Config(t), testAuthBuffer(), os.Stdout)
+		tas.Config(t), reader, writer)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -201,8 +204,9 @@ func TestTokenCacheRefreshWithInvalidTokenFails(t *testing.T) {
 	ctx := context.Background()
 	_, auth := testAppWithAuth(t)
 
+	reader, writer := testConsoleIO()
 	user, _, err := auth.SignInWithConsoleWithIO(ctx,
-		tas.Config(t), testAuthBuffer(), os.Stdout)
+		tas.Config(t), reader, writer)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,114 @@
+package firebase
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/Coderlane/minecraft-sidecart/internal"
+)
+
+var testAuthURLRegexp = regexp.MustCompile(`authenticate: (\S+)`)
+
+// testRedirectReader acts as a user pasting the URL their browser was
+// redirected to. The redirect is built from the authentication URL written
+// to out, with the state replaced if forgedState is set.
+type testRedirectReader struct {
+	out         *bytes.Buffer
+	forgedState string
+	input       *strings.Reader
+}
+
+func (trr *testRedirectReader) Read(p []byte) (int, error) {
+	if trr.input == nil {
+		match := testAuthURLRegexp.FindStringSubmatch(trr.out.String())
+		if match == nil {
+			return 0, fmt.Errorf("no authentication url in: %s", trr.out.String())
+		}
+		authURL, err := url.Parse(match[1])
+		if err != nil {
+			return 0, err
+		}
+		state := authURL.Query().Get("state")
+		if trr.forgedState != "" {
+			state = trr.forgedState
+		}
+		redirect := authURL.Query().Get("redirect_uri") + "?" + url.Values{
+			"code":  {internal.TestOAuthCode},
+			"state": {state},
+		}.Encode()
+		trr.input = strings.NewReader(redirect + "\n")
+	}
+	return trr.input.Read(p)
+}
+
+func TestConsoleTokenAcceptsRedirectURL(t *testing.T) {
+	tas := internal.NewFakeAuthServer()
+	defer tas.Close()
+
+	var out bytes.Buffer
+	auth := (&App{APIKey: "test_api_key"}).NewAuth()
+	tok, err := auth.consoleToken(context.Background(),
+		tas.Config(t), &testRedirectReader{out: &out}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.AccessToken != internal.TestOAuthToken {
+		t.Errorf("Expected: %s Got: %s\n", internal.TestOAuthToken, tok.AccessToken)
+	}
+	if !strings.Contains(out.String(), "code_challenge_method=S256") {
+		t.Errorf("Expected a PKCE challenge: %s\n", out.String())
+	}
+}
+
+func TestConsoleTokenRejectsBareCode(t *testing.T) {
+	tas := internal.NewFakeAuthServer()
+	defer tas.Close()
+
+	var out bytes.Buffer
+	auth := (&App{APIKey: "test_api_key"}).NewAuth()
+	_, err := auth.consoleToken(context.Background(), tas.Config(t),
+		strings.NewReader(internal.TestOAuthCode+"\n"), &out)
+	if err == nil {
+		t.Errorf("Expected to reject a code without a state")
+	}
+}
+
+func TestConsoleTokenRejectsMismatchedState(t *testing.T) {
+	tas := internal.NewFakeAuthServer()
+	defer tas.Close()
+
+	var out bytes.Buffer
+	auth := (&App{APIKey: "test_api_key"}).NewAuth()
+	_, err := auth.consoleToken(context.Background(), tas.Config(t),
+		&testRedirectReader{out: &out, forgedState: "forged"}, &out)
+	if err == nil {
+		t.Errorf("Expected to reject the state")
+	}
+	t.Log(err)
+}
+
+func TestParseConsoleInput(t *testing.T) {
+	tests := []struct {
+		input string
+		code  string
+		fails bool
+	}{
+		{"code", "", true},
+		{"http://127.0.0.1/?code=code&state=state", "code", false},
+		{"http://127.0.0.1/?code=code&state=other", "", true},
+		{"http://127.0.0.1/?code=code", "", true},
+		{"http://127.0.0.1/?error=access_denied&state=state", "", true},
+		{"http://127.0.0.1/?state=state", "", true},
+	}
+	for _, test := range tests {
+		code, err := parseConsoleInput(test.input, "state")
+		if (err != nil) != test.fails || code != test.code {
+			t.Errorf("Unexpected result for %q: %q %v\n", test.input, code, err)
+		}
+	}
+}
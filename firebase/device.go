@@ -0,0 +1,183 @@
+package firebase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// GoogleDeviceAuthURL is Google's device authorization endpoint. Note that
+// Google only allows the device flow for "TVs and Limited Input devices"
+// OAuth clients.
+const GoogleDeviceAuthURL = "https://oauth2.googleapis.com/device/code"
+
+const deviceGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// devicePollUnit is the unit of the polling interval sent by the device
+// authorization endpoint.
+var devicePollUnit = time.Second
+
+// deviceAuthResponse is the response from the device authorization endpoint
+// as described in RFC 8628 section 3.2.
+type deviceAuthResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	// VerificationURL is sent by Google in place of VerificationURI.
+	VerificationURL string `json:"verification_url"`
+	ExpiresIn       int64  `json:"expires_in"`
+	Interval        int64  `json:"interval"`
+}
+
+type deviceTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	IDToken      string `json:"id_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	Error        string `json:"error"`
+	ErrorDesc    string `json:"error_description"`
+}
+
+// SignInWithDevice authenticates the current user with the OAuth 2.0 device
+// authorization grant. A code and URL are printed to stdout, the user can
+// enter the code at the URL from any device with a browser.
+func (auth *Auth) SignInWithDevice(ctx context.Context,
+	cfg *oauth2.Config, deviceAuthURL string) (*User, *oauth2.Token, error) {
+	return auth.SignInWithDeviceWithIO(ctx, cfg, deviceAuthURL, os.Stdout)
+}
+
+// SignInWithDeviceWithIO performs the same operation as SignInWithDevice,
+// but allows for specifying an output `writer`.
+func (auth *Auth) SignInWithDeviceWithIO(ctx context.Context,
+	cfg *oauth2.Config, deviceAuthURL string,
+	writer io.Writer) (*User, *oauth2.Token, error) {
+	token, err := auth.deviceToken(ctx, cfg, deviceAuthURL, writer)
+	if err != nil {
+		return nil, nil, err
+	}
+	return auth.SignInWithToken(ctx, token)
+}
+
+// deviceToken runs the device flow and returns the OAuth2 token from the
+// provider.
+func (auth *Auth) deviceToken(ctx context.Context, cfg *oauth2.Config,
+	deviceAuthURL string, writer io.Writer) (*oauth2.Token, error) {
+	var deviceAuth deviceAuthResponse
+	err := postDeviceForm(ctx, deviceAuthURL, url.Values{
+		"client_id": {cfg.ClientID},
+		"scope":     {strings.Join(cfg.Scopes, " ")},
+	}, &deviceAuth)
+	if err != nil {
+		return nil, err
+	}
+	if deviceAuth.DeviceCode == "" {
+		return nil, fmt.Errorf("device authorization response is missing a code")
+	}
+	verificationURI := deviceAuth.VerificationURI
+	if verificationURI == "" {
+		verificationURI = deviceAuth.VerificationURL
+	}
+	fmt.Fprintf(writer, "Visit %s and enter the code: %s\n",
+		verificationURI, deviceAuth.UserCode)
+	if deviceAuth.VerificationURIComplete != "" {
+		fmt.Fprintf(writer, "Or visit: %s\n", deviceAuth.VerificationURIComplete)
+	}
+
+	interval := deviceAuth.Interval
+	if interval <= 0 {
+		interval = 5
+	}
+	if deviceAuth.ExpiresIn > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx,
+			time.Duration(deviceAuth.ExpiresIn)*devicePollUnit)
+		defer cancel()
+	}
+	values := url.Values{
+		"grant_type":    {deviceGrantType},
+		"device_code":   {deviceAuth.DeviceCode},
+		"client_id":     {cfg.ClientID},
+		"client_secret": {cfg.ClientSecret},
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("device authorization expired: %w", ctx.Err())
+		case <-time.After(time.Duration(interval) * devicePollUnit):
+		}
+		var resp deviceTokenResponse
+		err := postDeviceForm(ctx, cfg.Endpoint.TokenURL, values, &resp)
+		switch resp.Error {
+		case "":
+		case "authorization_pending":
+			continue
+		case "slow_down":
+			// RFC 8628 section 3.5, increase the interval by 5 seconds.
+			interval += 5
+			continue
+		default:
+			return nil, fmt.Errorf("device authorization failed: %s %s",
+				resp.Error, resp.ErrorDesc)
+		}
+		if err != nil {
+			return nil, err
+		}
+		token := &oauth2.Token{
+			AccessToken:  resp.AccessToken,
+			TokenType:    resp.TokenType,
+			RefreshToken: resp.RefreshToken,
+		}
+		if resp.ExpiresIn > 0 {
+			token.Expiry = time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second)
+		}
+		if resp.IDToken != "" {
+			token = token.WithExtra(map[string]interface{}{
+				"id_token": resp.IDToken,
+			})
+		}
+		return token, nil
+	}
+}
+
+// postDeviceForm posts the form values and decodes the JSON response in to
+// resp. Error responses are still decoded so the OAuth error can be checked.
+func postDeviceForm(ctx context.Context,
+	endpoint string, values url.Values, resp interface{}) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		endpoint, strings.NewReader(values.Encode()))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+
+	client := &http.Client{}
+	httpResp, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+	data, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, resp); err != nil {
+		return fmt.Errorf("failed to parse response from %s: %s: %v",
+			endpoint, httpResp.Status, err)
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return fmt.Errorf("request to %s failed: %s", endpoint, httpResp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package firebase
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Coderlane/minecraft-sidecart/internal"
+)
+
+func testFastDevicePolling(t *testing.T) {
+	restore := devicePollUnit
+	devicePollUnit = time.Millisecond * 10
+	t.Cleanup(func() { devicePollUnit = restore })
+}
+
+func TestDeviceTokenPollsUntilAuthorized(t *testing.T) {
+	testFastDevicePolling(t)
+	tas := internal.NewFakeAuthServer()
+	defer tas.Close()
+	tas.DevicePending = 2
+	tas.DeviceSlowDown = 1
+
+	var buf bytes.Buffer
+	auth := (&App{APIKey: "test_api_key"}).NewAuth()
+	tok, err := auth.deviceToken(context.Background(),
+		tas.Config(t), tas.DeviceAuthURL(), &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.AccessToken != internal.TestOAuthToken || tok.Extra("id_token") == nil {
+		t.Errorf("Unexpected token: %+v\n", tok)
+	}
+	if polls := tas.DevicePolls(); polls != 4 {
+		t.Errorf("Expected: 4 polls Got: %d\n", polls)
+	}
+	if !strings.Contains(buf.String(), internal.TestUserCode) {
+		t.Errorf("Expected the user code to be displayed: %s\n", buf.String())
+	}
+}
+
+func TestDeviceTokenDeniedFails(t *testing.T) {
+	testFastDevicePolling(t)
+	tas := internal.NewFakeAuthServer()
+	defer tas.Close()
+	tas.DeviceDenied = true
+
+	auth := (&App{APIKey: "test_api_key"}).NewAuth()
+	_, err := auth.deviceToken(context.Background(),
+		tas.Config(t), tas.DeviceAuthURL(), ioutil.Discard)
+	if err == nil || !strings.Contains(err.Error(), "access_denied") {
+		t.Errorf("Expected access to be denied: %v\n", err)
+	}
+}
+
+func TestDeviceTokenHandlesCanceledContext(t *testing.T) {
+	testFastDevicePolling(t)
+	tas := internal.NewFakeAuthServer()
+	defer tas.Close()
+	tas.DevicePending = 1000
+
+	auth := (&App{APIKey: "test_api_key"}).NewAuth()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	_, err := auth.deviceToken(ctx,
+		tas.Config(t), tas.DeviceAuthURL(), ioutil.Discard)
+	if err == nil {
+		t.Errorf("Expected to time out")
+	}
+	t.Log(err)
+}
+
+func TestDeviceTokenBadClientFails(t *testing.T) {
+	tas := internal.NewFakeAuthServer()
+	defer tas.Close()
+
+	cfg := tas.Config(t)
+	cfg.ClientID = "invalid"
+	auth := (&App{APIKey: "test_api_key"}).NewAuth()
+	_, err := auth.deviceToken(context.Background(),
+		cfg, tas.DeviceAuthURL(), ioutil.Discard)
+	if err == nil {
+		t.Errorf("Expected to fail")
+	}
+	t.Log(err)
+}
+
+func TestSignInWithDeviceAuthenticates(t *testing.T) {
+	testFastDevicePolling(t)
+	tas := internal.NewFakeAuthServer()
+	defer tas.Close()
+
+	muc := MemoryUserCache{}
+	_, auth := testAppWithAuth(t, WithUserCache(&muc))
+	user, _, err := auth.SignInWithDeviceWithIO(context.Background(),
+		tas.Config(t), tas.DeviceAuthURL(), ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached, _ := muc.Get(DefaultUser); cached != user {
+		t.Errorf("Expected the user to be cached")
+	}
+}
@@ -13,8 +13,16 @@ var firebaseServicesConfig []byte
 //go:embed .env/google_client_secret.json
 var googleAuthProviderConfig []byte
 
+//go:embed .env/github_client_secret.json
+var githubAuthProviderConfig []byte
+
+//go:embed .env/microsoft_client_secret.json
+var microsoftAuthProviderConfig []byte
+
 func init() {
 	authProviderConfigs[GoogleAuthProvider] = googleAuthProviderConfig
+	authProviderConfigs[GitHubAuthProvider] = githubAuthProviderConfig
+	authProviderConfigs[MicrosoftAuthProvider] = microsoftAuthProviderConfig
 
 	if len(firebaseServicesConfig) > 0 {
 		if err := json.Unmarshal(firebaseServicesConfig, &DefaultApp); err != nil {
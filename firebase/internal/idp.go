@@ -3,22 +3,26 @@ package internal
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"golang.org/x/oauth2"
 )
 
 const (
-	defaultAuthHost  = "identitytoolkit.googleapis.com"
-	defaultAuthPath  = "v1/accounts:signInWithIdp"
-	defaultTokenHost = "securetoken.googleapis.com"
-	defaultTokenPath = "v1/token"
+	defaultAuthHost        = "identitytoolkit.googleapis.com"
+	defaultAuthPath        = "v1/accounts:signInWithIdp"
+	defaultPasswordPath    = "v1/accounts:signInWithPassword"
+	defaultCustomTokenPath = "v1/accounts:signInWithCustomToken"
+	defaultTokenHost       = "securetoken.googleapis.com"
+	defaultTokenPath       = "v1/token"
 )
 
 // IdpConfig represents the configuration for the google identity provider
@@ -28,6 +32,10 @@ type IdpConfig struct {
 	authURL string
 	// tokenURL is the URL that allows refreshing IDP ID Tokens
 	tokenURL string
+	// passwordURL is the URL that signs in with an email and password
+	passwordURL string
+	// customTokenURL is the URL that signs in with a custom token
+	customTokenURL string
 }
 
 type IdpUser struct {
@@ -101,14 +109,19 @@ func NewIdpConfig(apiKey, emulatorHost string) *IdpConfig {
 	return &IdpConfig{
 		authURL:  buildAPIUrl(emulatorHost, defaultAuthHost, defaultAuthPath, apiKey),
 		tokenURL: buildAPIUrl(emulatorHost, defaultTokenHost, defaultTokenPath, apiKey),
+		passwordURL: buildAPIUrl(emulatorHost,
+			defaultAuthHost, defaultPasswordPath, apiKey),
+		customTokenURL: buildAPIUrl(emulatorHost,
+			defaultAuthHost, defaultCustomTokenPath, apiKey),
 	}
 }
 
-// Exchange exchanges an OAuth2 Access Token for an IDP ID Token
-func (cfg IdpConfig) Exchange(
-	ctx context.Context, accessToken *oauth2.Token) (*IdpUser, *oauth2.Token, error) {
+// Exchange exchanges an OAuth2 Access Token from the identity provider with
+// `providerID`, like `google.com`, for an IDP ID Token
+func (cfg IdpConfig) Exchange(ctx context.Context,
+	providerID string, accessToken *oauth2.Token) (*IdpUser, *oauth2.Token, error) {
 	postValues := url.Values{}
-	postValues.Add("providerId", "google.com")
+	postValues.Add("providerId", providerID)
 	idToken := accessToken.Extra("id_token")
 	if idToken != nil {
 		postValues.Add("id_token", idToken.(string))
@@ -218,3 +231,132 @@ func (cfg IdpConfig) Refresh(
 	}
 	return token, nil
 }
+
+type passwordRequest struct {
+	Email             string `json:"email"`
+	Password          string `json:"password"`
+	ReturnSecureToken bool   `json:"returnSecureToken"`
+}
+
+type customTokenRequest struct {
+	Token             string `json:"token"`
+	ReturnSecureToken bool   `json:"returnSecureToken"`
+}
+
+type signInResponse struct {
+	IdpUser
+	IDToken      string `json:"idToken"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    string `json:"expiresIn"`
+}
+
+// idTokenClaims are the claims of a firebase ID token used to describe the
+// user.
+type idTokenClaims struct {
+	UserID        string `json:"user_id"`
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	Picture       string `json:"picture"`
+}
+
+// SignInWithPassword signs in to an email and password account.
+func (cfg IdpConfig) SignInWithPassword(ctx context.Context,
+	email, password string) (*IdpUser, *oauth2.Token, error) {
+	return cfg.signIn(ctx, cfg.passwordURL, passwordRequest{
+		Email:             email,
+		Password:          password,
+		ReturnSecureToken: true,
+	})
+}
+
+// SignInWithCustomToken signs in with a custom token minted by the Firebase
+// Admin SDK. The response does not describe the user, so they are read from
+// the claims of the ID token.
+func (cfg IdpConfig) SignInWithCustomToken(ctx context.Context,
+	customToken string) (*IdpUser, *oauth2.Token, error) {
+	user, token, err := cfg.signIn(ctx, cfg.customTokenURL, customTokenRequest{
+		Token:             customToken,
+		ReturnSecureToken: true,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	claims, err := parseIDTokenClaims(token.AccessToken)
+	if err != nil {
+		return nil, nil, newIdpError(err)
+	}
+	user.LocalID = claims.UserID
+	if user.LocalID == "" {
+		user.LocalID = claims.Subject
+	}
+	user.Email = claims.Email
+	user.EmailVerified = claims.EmailVerified
+	user.DisplayName = claims.Name
+	user.PhotoURL = claims.Picture
+	return user, token, nil
+}
+
+func (cfg IdpConfig) signIn(ctx context.Context,
+	url string, body interface{}) (*IdpUser, *oauth2.Token, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(body); err != nil {
+		return nil, nil, err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, &buf)
+	if err != nil {
+		return nil, nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{}
+	resp, err := client.Do(request)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, newIdpError(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, newIdpErrorFromResponse(
+			fmt.Errorf("failed to sign in"), resp.StatusCode, string(data))
+	}
+
+	var signInResp signInResponse
+	if err := json.Unmarshal(data, &signInResp); err != nil {
+		return nil, nil, newIdpError(err)
+	}
+	expiry, err := fixupExpiry(signInResp.ExpiresIn)
+	if err != nil {
+		return nil, nil, newIdpError(err)
+	}
+	token := &oauth2.Token{
+		AccessToken:  signInResp.IDToken,
+		RefreshToken: signInResp.RefreshToken,
+		Expiry:       *expiry,
+	}
+	return &signInResp.IdpUser, token, nil
+}
+
+// parseIDTokenClaims reads the claims from an ID token without verifying it.
+// The token must come from a trusted source.
+func parseIDTokenClaims(idToken string) (*idTokenClaims, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("malformed id token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(
+		strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, err
+	}
+	var claims idTokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
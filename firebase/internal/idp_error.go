@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"errors"
 	"net/http"
 	"net/url"
 )
@@ -9,6 +10,9 @@ type idpError struct {
 	error
 	code int
 	Raw  string
+	// response is set when the identity provider responded with code, rather
+	// than the response failing to be read or parsed.
+	response bool
 }
 
 func newIdpError(err error) error {
@@ -23,9 +27,10 @@ func newIdpError(err error) error {
 func newIdpErrorFromResponse(err error, code int, data string) error {
 	return &url.Error{
 		Err: idpError{
-			error: err,
-			Raw:   data,
-			code:  code,
+			error:    err,
+			Raw:      data,
+			code:     code,
+			response: true,
 		},
 	}
 }
@@ -48,3 +53,19 @@ func (err idpError) Timeout() bool {
 		return false
 	}
 }
+
+// IsPermanent reports whether err is a response from the identity provider
+// that will not succeed if retried, for example a revoked refresh token.
+// Failing to read or parse a response is not permanent.
+func IsPermanent(err error) bool {
+	var idpErr idpError
+	if !errors.As(err, &idpErr) || !idpErr.response {
+		return false
+	}
+	switch idpErr.code {
+	case http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden:
+		return true
+	default:
+		return false
+	}
+}
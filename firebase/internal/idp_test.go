@@ -2,10 +2,14 @@ package internal
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -53,7 +57,7 @@ func testAccessToken(t *testing.T) *oauth2.Token {
 func TestEmulatorExchangeToken(t *testing.T) {
 	cfg := testIdpConfig(t)
 	ctx := context.Background()
-	_, refreshToken, err := cfg.Exchange(ctx, testAccessToken(t))
+	_, refreshToken, err := cfg.Exchange(ctx, "google.com", testAccessToken(t))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -70,7 +74,7 @@ func TestEmulatorExchangeToken(t *testing.T) {
 func TestEmulatorExchangeInvalidToken(t *testing.T) {
 	cfg := testIdpConfig(t)
 	ctx := context.Background()
-	_, _, err := cfg.Exchange(ctx, &oauth2.Token{})
+	_, _, err := cfg.Exchange(ctx, "google.com", &oauth2.Token{})
 	if err == nil {
 		t.Fatal("Expected an error")
 	}
@@ -85,7 +89,7 @@ func TestEmulatorExchangeInvalidToken(t *testing.T) {
 func TestEmulatorExchangeInvalidHost(t *testing.T) {
 	cfg := NewIdpConfig("test_api_key", "invalid")
 	ctx := context.Background()
-	_, _, err := cfg.Exchange(ctx, testAccessToken(t))
+	_, _, err := cfg.Exchange(ctx, "google.com", testAccessToken(t))
 	if err == nil {
 		t.Fatal("Expected an error")
 	}
@@ -97,7 +101,7 @@ func TestEmulatorExchangeInvalidHost(t *testing.T) {
 func TestEmulatorRefreshToken(t *testing.T) {
 	cfg := testIdpConfig(t)
 	ctx := context.Background()
-	_, refreshToken, err := cfg.Exchange(ctx, testAccessToken(t))
+	_, refreshToken, err := cfg.Exchange(ctx, "google.com", testAccessToken(t))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -136,7 +140,7 @@ func TestEmulatorRefreshInvalidToken(t *testing.T) {
 func TestEmulatorRefreshInvalidHost(t *testing.T) {
 	cfg := testIdpConfig(t)
 	ctx := context.Background()
-	_, refreshToken, err := cfg.Exchange(ctx, testAccessToken(t))
+	_, refreshToken, err := cfg.Exchange(ctx, "google.com", testAccessToken(t))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -163,3 +167,136 @@ func TestIdpErrorDefaultsToPermanentError(t *testing.T) {
 		t.Error("Expected a non-timeout error")
 	}
 }
+
+// testFakeIdentityToolkit serves handler in place of the identity toolkit and
+// returns an IdpConfig using it.
+func testFakeIdentityToolkit(t *testing.T, handler http.HandlerFunc) *IdpConfig {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return NewIdpConfig("test_api_key", strings.TrimPrefix(srv.URL, "http://"))
+}
+
+func testIDTokenWithClaims(claims map[string]interface{}) string {
+	payload, _ := json.Marshal(claims)
+	return "e30." + base64.RawURLEncoding.EncodeToString(payload) + ".sig"
+}
+
+func TestSignInWithPassword(t *testing.T) {
+	cfg := testFakeIdentityToolkit(t, func(w http.ResponseWriter, r *http.Request) {
+		var req passwordRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if !strings.HasSuffix(r.URL.Path, "accounts:signInWithPassword") ||
+			req.Email != "test@example.com" || req.Password != "hunter2" {
+			http.Error(w, `{"error": {"message": "INVALID_PASSWORD"}}`,
+				http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"localId":      "test",
+			"email":        req.Email,
+			"idToken":      "test_id_token",
+			"refreshToken": "test_refresh_token",
+			"expiresIn":    "3600",
+		})
+	})
+
+	ctx := context.Background()
+	user, token, err := cfg.SignInWithPassword(ctx, "test@example.com", "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.LocalID != "test" || token.RefreshToken != "test_refresh_token" {
+		t.Errorf("Unexpected sign in: %+v %+v\n", user, token)
+	}
+
+	_, _, err = cfg.SignInWithPassword(ctx, "test@example.com", "invalid")
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	if err.(*url.Error).Temporary() {
+		t.Error("Expected a permanent error")
+	}
+}
+
+func TestSignInWithCustomTokenReadsClaims(t *testing.T) {
+	idToken := testIDTokenWithClaims(map[string]interface{}{
+		"user_id":        "test",
+		"email":          "test@example.com",
+		"email_verified": true,
+	})
+	cfg := testFakeIdentityToolkit(t, func(w http.ResponseWriter, r *http.Request) {
+		var req customTokenRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if !strings.HasSuffix(r.URL.Path, "accounts:signInWithCustomToken") ||
+			req.Token != "test_custom_token" {
+			http.Error(w, `{"error": {"message": "INVALID_CUSTOM_TOKEN"}}`,
+				http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"idToken":      idToken,
+			"refreshToken": "test_refresh_token",
+			"expiresIn":    "3600",
+		})
+	})
+
+	user, token, err := cfg.SignInWithCustomToken(
+		context.Background(), "test_custom_token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.LocalID != "test" || user.Email != "test@example.com" ||
+		!user.EmailVerified || token.AccessToken != idToken {
+		t.Errorf("Unexpected sign in: %+v %+v\n", user, token)
+	}
+
+	_, _, err = cfg.SignInWithCustomToken(context.Background(), "invalid")
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+}
+
+func TestRefreshBadResponseIsNotPermanent(t *testing.T) {
+	cfg := testFakeIdentityToolkit(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{truncated"))
+	})
+	_, err := cfg.Refresh(context.Background(),
+		&oauth2.Token{RefreshToken: "test_refresh_token"})
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	if IsPermanent(err) {
+		t.Errorf("Expected a parse failure to be retried: %v", err)
+	}
+
+	cfg = testFakeIdentityToolkit(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error": {"message": "TOKEN_EXPIRED"}}`,
+			http.StatusBadRequest)
+	})
+	_, err = cfg.Refresh(context.Background(),
+		&oauth2.Token{RefreshToken: "test_refresh_token"})
+	if !IsPermanent(err) {
+		t.Errorf("Expected a rejected refresh token to be permanent: %v", err)
+	}
+}
+
+func TestIsPermanent(t *testing.T) {
+	tests := []struct {
+		err       error
+		permanent bool
+	}{
+		{newIdpErrorFromResponse(fmt.Errorf("test"), http.StatusBadRequest, ""), true},
+		{newIdpErrorFromResponse(fmt.Errorf("test"), http.StatusUnauthorized, ""), true},
+		{newIdpErrorFromResponse(fmt.Errorf("test"), http.StatusForbidden, ""), true},
+		{newIdpErrorFromResponse(fmt.Errorf("test"), http.StatusServiceUnavailable, ""), false},
+		{newIdpErrorFromResponse(fmt.Errorf("test"), http.StatusNotImplemented, ""), false},
+		{newIdpError(fmt.Errorf("unexpected EOF")), false},
+		{fmt.Errorf("connection refused"), false},
+	}
+	for _, test := range tests {
+		if IsPermanent(test.err) != test.permanent {
+			t.Errorf("Expected IsPermanent(%v) to be %t", test.err, test.permanent)
+		}
+	}
+}
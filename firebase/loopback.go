@@ -0,0 +1,161 @@
+package firebase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+
+	"golang.org/x/oauth2"
+)
+
+const loopbackSuccessPage = `<html><body>
+Authenticated! You may close this window and return to minecraft-sidecart.
+</body></html>`
+
+// SignInWithLoopback authenticates the current user by redirecting their
+// browser back to a temporary HTTP server on 127.0.0.1. The authentication
+// URL is printed to stdout and opened in the user's browser, if possible.
+func (auth *Auth) SignInWithLoopback(
+	ctx context.Context, cfg *oauth2.Config) (*User, *oauth2.Token, error) {
+	return auth.SignInWithLoopbackWithIO(ctx, cfg, os.Stdout, OpenBrowser)
+}
+
+// SignInWithLoopbackWithIO performs the same operation as SignInWithLoopback,
+// but allows for specifying an output `writer` and a function to open the
+// authentication URL with. If `open` is nil or fails, the user must visit the
+// printed URL themselves.
+func (auth *Auth) SignInWithLoopbackWithIO(
+	ctx context.Context, cfg *oauth2.Config, writer io.Writer,
+	open func(string) error) (*User, *oauth2.Token, error) {
+	token, err := auth.loopbackToken(ctx, cfg, writer, open)
+	if err != nil {
+		return nil, nil, err
+	}
+	return auth.SignInWithToken(ctx, token)
+}
+
+// errInvalidState is returned for a redirect which was not made for this sign
+// in, it may have been forged.
+var errInvalidState = errors.New("invalid oauth state")
+
+type loopbackResult struct {
+	code string
+	err  error
+}
+
+// loopbackToken runs the loopback flow and returns the OAuth2 token from the
+// provider.
+func (auth *Auth) loopbackToken(ctx context.Context, cfg *oauth2.Config,
+	writer io.Writer, open func(string) error) (*oauth2.Token, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	defer listener.Close()
+	state, err := createRandomState()
+	if err != nil {
+		return nil, err
+	}
+	verifier, challenge, err := createCodeVerifier()
+	if err != nil {
+		return nil, err
+	}
+
+	tmpCfg := *cfg
+	tmpCfg.RedirectURL = fmt.Sprintf("http://%s/", listener.Addr())
+
+	results := make(chan loopbackResult, 1)
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Ignore anything other than the redirect, like a favicon.
+			if r.URL.Path != "/" {
+				http.NotFound(w, r)
+				return
+			}
+			var result loopbackResult
+			result.code, result.err = parseAuthRedirect(r.URL.Query(), state)
+			// Only a redirect for this sign in ends it, so another request
+			// can not abort it.
+			if errors.Is(result.err, errInvalidState) {
+				http.Error(w, result.err.Error(), http.StatusBadRequest)
+				return
+			}
+			if result.err != nil {
+				http.Error(w, result.err.Error(), http.StatusBadRequest)
+			} else {
+				w.Header().Set("Content-Type", "text/html")
+				io.WriteString(w, loopbackSuccessPage)
+			}
+			select {
+			case results <- result:
+			default:
+			}
+		}),
+	}
+	go server.Serve(listener)
+	defer server.Close()
+
+	authURL := tmpCfg.AuthCodeURL(state, oauth2.AccessTypeOffline,
+		oauth2.SetAuthURLParam("code_challenge", challenge),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"))
+	fmt.Fprintf(writer, "Visit this url to authenticate: %v\n", authURL)
+	if open != nil {
+		if err := open(authURL); err != nil {
+			fmt.Fprintf(writer, "Failed to open a browser: %v\n", err)
+		}
+	}
+
+	var result loopbackResult
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result = <-results:
+	}
+	if result.err != nil {
+		return nil, result.err
+	}
+	return tmpCfg.Exchange(ctx, result.code,
+		oauth2.SetAuthURLParam("code_verifier", verifier))
+}
+
+// parseAuthRedirect extracts the authorization code from the query of the
+// provider's redirect, verifying that the state matches.
+func parseAuthRedirect(query url.Values, state string) (string, error) {
+	if query.Get("state") != state {
+		return "", errInvalidState
+	}
+	if errCode := query.Get("error"); errCode != "" {
+		return "", fmt.Errorf("authentication failed: %s %s",
+			errCode, query.Get("error_description"))
+	}
+	code := query.Get("code")
+	if code == "" {
+		return "", fmt.Errorf("missing authorization code")
+	}
+	return code, nil
+}
+
+// OpenBrowser opens url in the user's default browser.
+func OpenBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
@@ -0,0 +1,130 @@
+package firebase
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Coderlane/minecraft-sidecart/internal"
+)
+
+// testFollowURL acts as the user's browser, following the authentication URL
+// through the redirect back to the loopback server.
+func testFollowURL(authURL string) error {
+	resp, err := http.Get(authURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = ioutil.ReadAll(resp.Body)
+	return err
+}
+
+func TestLoopbackTokenExchangesCode(t *testing.T) {
+	tas := internal.NewFakeAuthServer()
+	defer tas.Close()
+
+	auth := (&App{APIKey: "test_api_key"}).NewAuth()
+	tok, err := auth.loopbackToken(context.Background(),
+		tas.Config(t), ioutil.Discard, testFollowURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.AccessToken != internal.TestOAuthToken {
+		t.Errorf("Expected: %s Got: %s\n", internal.TestOAuthToken, tok.AccessToken)
+	}
+}
+
+// testFollowForged sends a redirect with a forged state to the loopback server
+// of authURL and returns the response's status code.
+func testFollowForged(authURL string) (int, error) {
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		return 0, err
+	}
+	redirect := parsed.Query().Get("redirect_uri")
+	resp, err := http.Get(redirect + "?" + url.Values{
+		"code":  {internal.TestOAuthCode},
+		"state": {"forged"},
+	}.Encode())
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func TestLoopbackTokenRejectsMismatchedState(t *testing.T) {
+	tas := internal.NewFakeAuthServer()
+	defer tas.Close()
+
+	auth := (&App{APIKey: "test_api_key"}).NewAuth()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*200)
+	defer cancel()
+	var status int
+	_, err := auth.loopbackToken(ctx, tas.Config(t),
+		ioutil.Discard, func(authURL string) (err error) {
+			status, err = testFollowForged(authURL)
+			return err
+		})
+	if status != http.StatusBadRequest {
+		t.Errorf("Expected the forged redirect to be rejected, got: %d", status)
+	}
+	// The forged redirect does not end the sign in.
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected: %v Got: %v\n", context.DeadlineExceeded, err)
+	}
+}
+
+func TestLoopbackTokenIgnoresMismatchedState(t *testing.T) {
+	tas := internal.NewFakeAuthServer()
+	defer tas.Close()
+
+	auth := (&App{APIKey: "test_api_key"}).NewAuth()
+	tok, err := auth.loopbackToken(context.Background(), tas.Config(t),
+		ioutil.Discard, func(authURL string) error {
+			if _, err := testFollowForged(authURL); err != nil {
+				return err
+			}
+			return testFollowURL(authURL)
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.AccessToken != internal.TestOAuthToken {
+		t.Errorf("Expected: %s Got: %s\n", internal.TestOAuthToken, tok.AccessToken)
+	}
+}
+
+func TestLoopbackTokenHandlesCanceledContext(t *testing.T) {
+	tas := internal.NewFakeAuthServer()
+	defer tas.Close()
+
+	auth := (&App{APIKey: "test_api_key"}).NewAuth()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	_, err := auth.loopbackToken(ctx, tas.Config(t), ioutil.Discard, nil)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected: %v Got: %v\n", context.DeadlineExceeded, err)
+	}
+}
+
+func TestSignInWithLoopbackAuthenticates(t *testing.T) {
+	tas := internal.NewFakeAuthServer()
+	defer tas.Close()
+
+	muc := MemoryUserCache{}
+	_, auth := testAppWithAuth(t, WithUserCache(&muc))
+
+	user, _, err := auth.SignInWithLoopbackWithIO(context.Background(),
+		tas.Config(t), ioutil.Discard, testFollowURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached, _ := muc.Get(DefaultUser); cached != user {
+		t.Errorf("Expected the user to be cached")
+	}
+}
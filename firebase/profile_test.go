@@ -0,0 +1,73 @@
+package firebase
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProfilesAreCachedSeparately(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			var req struct {
+				Email string `json:"email"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			json.NewEncoder(w).Encode(map[string]string{
+				"localId":      req.Email,
+				"email":        req.Email,
+				"idToken":      "test_id_token",
+				"refreshToken": "test_refresh_token",
+				"expiresIn":    "3600",
+			})
+		}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	muc := MemoryUserCache{}
+	app := &App{APIKey: "test_api_key"}
+	auth := app.NewAuth(WithUserCache(&muc),
+		WithEmulatorHost(strings.TrimPrefix(srv.URL, "http://")))
+	if _, _, err := auth.SignInWithEmailPassword(ctx, "me", "test"); err != nil {
+		t.Fatal(err)
+	}
+	team := auth.ForProfile("team")
+	if team.Profile() != "team" || team.CurrentUser() != nil {
+		t.Errorf("Expected an empty team profile")
+	}
+	if _, _, err := team.SignInWithEmailPassword(ctx, "team", "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	profiles, err := auth.Profiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(profiles, []string{DefaultUser, "team"}) {
+		t.Errorf("Unexpected profiles: %v\n", profiles)
+	}
+	if user := auth.ForProfile("team").CurrentUser(); user == nil ||
+		user.UserID != "team" {
+		t.Errorf("Expected to load the team user: %+v\n", user)
+	}
+	if auth.CurrentUser().UserID != "me" {
+		t.Errorf("Expected the default user to be unchanged")
+	}
+}
+
+type testUnlistableCache struct {
+	MemoryUserCache
+}
+
+func (tuc testUnlistableCache) List() {}
+
+func TestProfilesRequiresLister(t *testing.T) {
+	auth := (&App{}).NewAuth(WithUserCache(&testUnlistableCache{MemoryUserCache{}}))
+	if _, err := auth.Profiles(); err == nil {
+		t.Errorf("Expected an error")
+	}
+}
@@ -0,0 +1,124 @@
+package firebase
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestParseAuthProvider(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider AuthProvider
+		id       string
+	}{
+		{"google", GoogleAuthProvider, "google.com"},
+		{"github", GitHubAuthProvider, "github.com"},
+		{"microsoft", MicrosoftAuthProvider, "microsoft.com"},
+	}
+	for _, test := range tests {
+		provider, err := ParseAuthProvider(test.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if provider != test.provider || provider.ID() != test.id {
+			t.Errorf("Unexpected provider for %s: %v %s\n",
+				test.name, provider, provider.ID())
+		}
+		if provider.DeviceAuthURL() == "" {
+			t.Errorf("Expected a device auth url for %s\n", test.name)
+		}
+	}
+	if _, err := ParseAuthProvider("unknown"); err == nil {
+		t.Errorf("Expected an error")
+	}
+}
+
+func TestEmbeddedAuthProviderConfigsParse(t *testing.T) {
+	providers := map[AuthProvider]string{
+		GitHubAuthProvider:    "https://github.com/",
+		MicrosoftAuthProvider: "https://login.microsoftonline.com/",
+	}
+	for provider, prefix := range providers {
+		cfg := NewOAuthConfig(provider)
+		if !strings.HasPrefix(cfg.Endpoint.AuthURL, prefix) ||
+			!strings.HasPrefix(cfg.Endpoint.TokenURL, prefix) {
+			t.Errorf("Unexpected endpoint for %v: %+v\n", provider, cfg.Endpoint)
+		}
+		if len(cfg.Scopes) == 0 {
+			t.Errorf("Expected scopes for %v\n", provider)
+		}
+	}
+}
+
+func TestSignInWithTokenUsesProviderID(t *testing.T) {
+	var postBody url.Values
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			var req struct {
+				PostBody string `json:"postBody"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			postBody, _ = url.ParseQuery(req.PostBody)
+			json.NewEncoder(w).Encode(map[string]string{
+				"localId":      "test",
+				"idToken":      "test_id_token",
+				"refreshToken": "test_refresh_token",
+				"expiresIn":    "3600",
+			})
+		}))
+	defer srv.Close()
+
+	app := &App{APIKey: "test_api_key"}
+	auth := app.NewAuth(WithEmulatorHost(strings.TrimPrefix(srv.URL, "http://")),
+		WithAuthProvider(GitHubAuthProvider))
+	user, _, err := auth.SignInWithToken(context.Background(),
+		&oauth2.Token{AccessToken: "test_access_token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if postBody.Get("providerId") != "github.com" ||
+		postBody.Get("access_token") != "test_access_token" {
+		t.Errorf("Unexpected post body: %v\n", postBody)
+	}
+	if user.UserID != "test" {
+		t.Errorf("Unexpected user: %+v\n", user)
+	}
+}
+
+func TestSignInWithEmailPasswordCachesUser(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(map[string]string{
+				"localId":      "test",
+				"email":        "test@example.com",
+				"idToken":      "test_id_token",
+				"refreshToken": "test_refresh_token",
+				"expiresIn":    "3600",
+			})
+		}))
+	defer srv.Close()
+
+	muc := MemoryUserCache{}
+	app := &App{APIKey: "test_api_key"}
+	auth := app.NewAuth(WithUserCache(&muc),
+		WithEmulatorHost(strings.TrimPrefix(srv.URL, "http://")))
+	user, _, err := auth.SignInWithEmailPassword(context.Background(),
+		"test@example.com", "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached, _ := muc.Get(DefaultUser); cached != user ||
+		user.RefreshToken != "test_refresh_token" {
+		t.Errorf("Expected the user to be cached: %+v\n", user)
+	}
+	if auth.CurrentUser() != user {
+		t.Errorf("Expected to be the current user")
+	}
+}
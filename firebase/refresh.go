@@ -0,0 +1,213 @@
+package firebase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/Coderlane/minecraft-sidecart/firebase/internal"
+)
+
+// ErrReauthRequired is returned once the identity provider rejects the
+// refresh token, for example because it was revoked. The user must sign in
+// again.
+var ErrReauthRequired = errors.New("the user must sign in again")
+
+var (
+	// refreshTimeout bounds a refresh, including its retries.
+	refreshTimeout = time.Minute
+	// refreshAttempts is the number of times a refresh is tried.
+	refreshAttempts = 5
+	// refreshBackoff is the delay before the first retry, it doubles up to
+	// refreshMaxBackoff.
+	refreshBackoff    = 500 * time.Millisecond
+	refreshMaxBackoff = 10 * time.Second
+	// refreshMargin is how long before expiry `KeepFresh` refreshes tokens.
+	refreshMargin = 5 * time.Minute
+	// refreshCheckInterval is the longest `KeepFresh` waits between checks.
+	refreshCheckInterval = time.Minute
+)
+
+// refreshCall is a refresh shared by every caller that needs a token while
+// it runs.
+type refreshCall struct {
+	done  chan struct{}
+	token *oauth2.Token
+	err   error
+}
+
+// TokenContext returns a valid token for the current user, refreshing it if
+// needed. Concurrent callers share a single refresh, which is retried with
+// backoff if the identity provider is unavailable. ctx only bounds how long
+// the caller waits. Once the refresh token is rejected ErrReauthRequired is
+// returned until the user signs in again.
+func (auth *Auth) TokenContext(ctx context.Context) (*oauth2.Token, error) {
+	auth.mtx.RLock()
+	token := auth.token
+	auth.mtx.RUnlock()
+	if token.Valid() {
+		return token, nil
+	}
+	call, err := auth.startRefresh()
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-call.done:
+		return call.token, call.err
+	}
+}
+
+// ReauthRequired returns an error wrapping ErrReauthRequired if the refresh
+// token was rejected.
+func (auth *Auth) ReauthRequired() error {
+	auth.mtx.RLock()
+	defer auth.mtx.RUnlock()
+	return auth.reauthErr
+}
+
+// OnRefresh sets fn to be called after every refresh with its result. Once the
+// refresh token is rejected the error wraps ErrReauthRequired.
+func (auth *Auth) OnRefresh(fn func(error)) {
+	auth.mtx.Lock()
+	auth.onRefresh = fn
+	auth.mtx.Unlock()
+}
+
+// KeepFresh refreshes the current user's token shortly before it expires
+// until ctx is canceled, so callers rarely wait on a refresh.
+func (auth *Auth) KeepFresh(ctx context.Context) {
+	for {
+		auth.mtx.RLock()
+		wait := refreshCheckInterval
+		due := false
+		if auth.currentUser != nil && auth.reauthErr == nil {
+			if auth.token == nil {
+				due = true
+			} else if untilDue := time.Until(auth.token.Expiry) - refreshMargin; untilDue <= 0 {
+				due = true
+			} else if untilDue < wait {
+				wait = untilDue
+			}
+		}
+		auth.mtx.RUnlock()
+
+		if due {
+			if call, err := auth.forceRefresh(); err == nil {
+				select {
+				case <-ctx.Done():
+					return
+				case <-call.done:
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// startRefresh joins the refresh in progress or starts a new one, unless the
+// token was refreshed in the meantime.
+func (auth *Auth) startRefresh() (*refreshCall, error) {
+	auth.mtx.Lock()
+	defer auth.mtx.Unlock()
+	if auth.token.Valid() && auth.refreshing == nil {
+		call := &refreshCall{done: make(chan struct{}), token: auth.token}
+		close(call.done)
+		return call, nil
+	}
+	return auth.refreshLocked()
+}
+
+// forceRefresh refreshes even if the current token is still valid.
+func (auth *Auth) forceRefresh() (*refreshCall, error) {
+	auth.mtx.Lock()
+	defer auth.mtx.Unlock()
+	return auth.refreshLocked()
+}
+
+// refreshLocked starts or joins a refresh. mtx must be held.
+func (auth *Auth) refreshLocked() (*refreshCall, error) {
+	if auth.currentUser == nil {
+		return nil, fmt.Errorf("no user is currently authenticated")
+	}
+	if auth.reauthErr != nil {
+		return nil, auth.reauthErr
+	}
+	if auth.refreshing != nil {
+		return auth.refreshing, nil
+	}
+	call := &refreshCall{done: make(chan struct{})}
+	auth.refreshing = call
+	go auth.runRefresh(call, auth.currentUser)
+	return call, nil
+}
+
+// runRefresh refreshes the user's token without holding mtx, so callers with
+// a valid token are not blocked by a slow identity provider.
+func (auth *Auth) runRefresh(call *refreshCall, user *User) {
+	ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+	defer cancel()
+	token, err := auth.refreshWithRetry(ctx, user.RefreshToken)
+
+	auth.mtx.Lock()
+	switch {
+	case auth.currentUser != user:
+		// Signed out, or in as someone else, during the refresh.
+		token = nil
+		err = fmt.Errorf("user changed while refreshing the token")
+	case err == nil:
+		auth.token = token
+		if token.RefreshToken != "" && token.RefreshToken != user.RefreshToken {
+			refreshed := *user
+			refreshed.RefreshToken = token.RefreshToken
+			auth.currentUser = &refreshed
+			err = auth.userCache.Set(auth.profile, auth.currentUser)
+		}
+	case internal.IsPermanent(err):
+		auth.reauthErr = fmt.Errorf("%w: %v", ErrReauthRequired, err)
+		err = auth.reauthErr
+	}
+	auth.refreshing = nil
+	onRefresh := auth.onRefresh
+	auth.mtx.Unlock()
+
+	call.token, call.err = token, err
+	close(call.done)
+	if onRefresh != nil {
+		onRefresh(err)
+	}
+}
+
+// refreshWithRetry refreshes the token, retrying failures other than a
+// rejected refresh token with jittered exponential backoff.
+func (auth *Auth) refreshWithRetry(ctx context.Context,
+	refreshToken string) (*oauth2.Token, error) {
+	backoff := refreshBackoff
+	for attempt := 1; ; attempt++ {
+		token, err := auth.idpConfig.Refresh(ctx,
+			&oauth2.Token{RefreshToken: refreshToken})
+		if err == nil || internal.IsPermanent(err) || attempt >= refreshAttempts {
+			return token, err
+		}
+		// Wait between half and all of the backoff.
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(wait):
+		}
+		if backoff *= 2; backoff > refreshMaxBackoff {
+			backoff = refreshMaxBackoff
+		}
+	}
+}
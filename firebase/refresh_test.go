@@ -0,0 +1,162 @@
+package firebase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testRefreshAuth creates a signed in auth whose token endpoint is handler.
+func testRefreshAuth(t *testing.T, handler http.HandlerFunc) *Auth {
+	t.Helper()
+	restoreBackoff := refreshBackoff
+	refreshBackoff = time.Millisecond
+	t.Cleanup(func() { refreshBackoff = restoreBackoff })
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	app := &App{APIKey: "test_api_key"}
+	muc := MemoryUserCache{
+		DefaultUser: &User{UserID: "test", RefreshToken: "test_refresh_token"},
+	}
+	return app.NewAuth(WithUserCache(&muc),
+		WithEmulatorHost(strings.TrimPrefix(srv.URL, "http://")))
+}
+
+func writeTestRefresh(w http.ResponseWriter, expiresIn string) {
+	json.NewEncoder(w).Encode(map[string]string{
+		"id_token":      "test_id_token",
+		"refresh_token": "test_refresh_token",
+		"expires_in":    expiresIn,
+	})
+}
+
+func TestTokenRefreshIsSingleFlight(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	auth := testRefreshAuth(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		writeTestRefresh(w, "3600")
+	})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := auth.Token()
+			errs <- err
+		}()
+	}
+
+	// The refresh does not block other users of auth.
+	time.Sleep(10 * time.Millisecond)
+	if auth.CurrentUser() == nil {
+		t.Errorf("Expected a current user while refreshing")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := auth.TokenContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected a canceled wait, got: %v", err)
+	}
+
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if calls := atomic.LoadInt32(&calls); calls != 1 {
+		t.Errorf("Expected a single refresh, got: %d", calls)
+	}
+}
+
+func TestTokenRefreshRetriesTemporaryErrors(t *testing.T) {
+	var calls int32
+	auth := testRefreshAuth(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		writeTestRefresh(w, "3600")
+	})
+	token, err := auth.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "test_id_token" || atomic.LoadInt32(&calls) != 3 {
+		t.Errorf("Expected to succeed on the third try: %d %+v", calls, token)
+	}
+}
+
+func TestTokenRefreshRejectedRequiresReauth(t *testing.T) {
+	var calls int32
+	auth := testRefreshAuth(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		http.Error(w, `{"error": {"message": "TOKEN_EXPIRED"}}`,
+			http.StatusBadRequest)
+	})
+	if _, err := auth.Token(); !errors.Is(err, ErrReauthRequired) {
+		t.Fatalf("Expected ErrReauthRequired, got: %v", err)
+	}
+	if _, err := auth.Token(); !errors.Is(err, ErrReauthRequired) {
+		t.Fatalf("Expected ErrReauthRequired, got: %v", err)
+	}
+	if calls := atomic.LoadInt32(&calls); calls != 1 {
+		t.Errorf("Expected a rejected token to not be retried, got: %d", calls)
+	}
+	if status := auth.Status(); !status.ReauthRequired {
+		t.Errorf("Expected the status to require signing in: %+v", status)
+	}
+	auth.SignOut()
+	if err := auth.ReauthRequired(); err != nil {
+		t.Errorf("Expected signing out to clear the error: %v", err)
+	}
+}
+
+func TestKeepFreshRefreshesBeforeExpiry(t *testing.T) {
+	var calls int32
+	auth := testRefreshAuth(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) > 1 {
+			http.Error(w, `{"error": {"message": "TOKEN_EXPIRED"}}`,
+				http.StatusBadRequest)
+			return
+		}
+		// Expires within refreshMargin, so it is refreshed right away.
+		writeTestRefresh(w, "60")
+	})
+	restore := refreshCheckInterval
+	refreshCheckInterval = time.Millisecond
+	defer func() { refreshCheckInterval = restore }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	refreshes := make(chan error, 2)
+	auth.OnRefresh(func(err error) { refreshes <- err })
+	go auth.KeepFresh(ctx)
+
+	for _, reauth := range []bool{false, true} {
+		select {
+		case err := <-refreshes:
+			if errors.Is(err, ErrReauthRequired) != reauth {
+				t.Errorf("Unexpected refresh result: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected the token to be refreshed twice")
+		}
+	}
+	if calls := atomic.LoadInt32(&calls); calls != 2 {
+		t.Errorf("Expected two refreshes, got: %d", calls)
+	}
+}
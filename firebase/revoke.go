@@ -0,0 +1,48 @@
+package firebase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// ErrRevokeUnsupported is returned by `Auth.Revoke` when the app has no
+// `RevokeURL`.
+var ErrRevokeUnsupported = errors.New("revoking refresh tokens is not " +
+	"supported by this app, firebase only revokes them with the Admin SDK")
+
+// Revoke revokes the current user's refresh tokens so that copies of them stop
+// working. Firebase clients can not revoke refresh tokens themselves, so this
+// calls the app's `RevokeURL` with the user's ID token. The endpoint, for
+// example a Cloud Function, is expected to verify the ID token and call the
+// Admin SDK's `revokeRefreshTokens` for the user.
+func (auth *Auth) Revoke(ctx context.Context) error {
+	if auth.app.RevokeURL == "" {
+		return ErrRevokeUnsupported
+	}
+	token, err := auth.TokenContext(ctx)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		auth.app.RevokeURL, nil)
+	if err != nil {
+		return err
+	}
+	token.SetAuthHeader(request)
+
+	client := &http.Client{}
+	resp, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("failed to revoke refresh tokens: %s: %s",
+			resp.Status, body)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package firebase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testPasswordAuth signs in to the team profile of a fake identity toolkit
+// with an email and password.
+func testPasswordAuth(t *testing.T, app *App, muc *MemoryUserCache) *Auth {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, "/token") {
+				json.NewEncoder(w).Encode(map[string]string{
+					"id_token":      "test_id_token",
+					"refresh_token": "test_refresh_token",
+					"expires_in":    "3600",
+				})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{
+				"localId":      "test",
+				"idToken":      "test_id_token",
+				"refreshToken": "test_refresh_token",
+				"expiresIn":    "3600",
+			})
+		}))
+	t.Cleanup(srv.Close)
+	auth := app.NewAuth(WithUserCache(muc), WithProfile("team"),
+		WithEmulatorHost(strings.TrimPrefix(srv.URL, "http://")))
+	if _, _, err := auth.SignInWithEmailPassword(
+		context.Background(), "test@example.com", "test"); err != nil {
+		t.Fatal(err)
+	}
+	return auth
+}
+
+func TestSignOutDeletesProfile(t *testing.T) {
+	muc := MemoryUserCache{}
+	auth := testPasswordAuth(t, &App{APIKey: "test_api_key"}, &muc)
+	if found, _ := muc.Get("team"); found == nil {
+		t.Fatal("Expected the user to be cached under the profile")
+	}
+	auth.SignOut()
+	if found, _ := muc.Get("team"); found != nil {
+		t.Errorf("Expected the profile to be deleted from the cache")
+	}
+	if auth.CurrentUser() != nil {
+		t.Errorf("Expected to not have a current user.")
+	}
+}
+
+func TestRevokeSendsIDToken(t *testing.T) {
+	var authorization string
+	revokeSrv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			authorization = r.Header.Get("Authorization")
+		}))
+	defer revokeSrv.Close()
+
+	app := &App{APIKey: "test_api_key", RevokeURL: revokeSrv.URL}
+	auth := testPasswordAuth(t, app, &MemoryUserCache{})
+	if err := auth.Revoke(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if authorization != "Bearer test_id_token" {
+		t.Errorf("Unexpected authorization: %s", authorization)
+	}
+}
+
+func TestRevokeWithoutURLFails(t *testing.T) {
+	auth := testPasswordAuth(t, &App{APIKey: "test_api_key"}, &MemoryUserCache{})
+	if err := auth.Revoke(context.Background()); !errors.Is(err, ErrRevokeUnsupported) {
+		t.Errorf("Expected ErrRevokeUnsupported, got: %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package firebase
+
+import (
+	"context"
+	"time"
+)
+
+// AuthStatus describes the user cached for a profile.
+type AuthStatus struct {
+	Profile string `json:"profile"`
+	// User is nil if the profile is signed out.
+	User *User `json:"user"`
+	// Expiry is when the current ID token expires, it is zero if there is no
+	// token.
+	Expiry time.Time `json:"expiry"`
+	// Error is set if the user's refresh token could not be used.
+	Error string `json:"error"`
+	// ReauthRequired is set once the refresh token has been rejected, the
+	// user must sign in again.
+	ReauthRequired bool `json:"reauth_required"`
+}
+
+// Status returns the current user and token without contacting the identity
+// provider.
+func (auth *Auth) Status() AuthStatus {
+	auth.mtx.RLock()
+	defer auth.mtx.RUnlock()
+	status := AuthStatus{
+		Profile: auth.profile,
+		User:    auth.currentUser,
+	}
+	if auth.token != nil {
+		status.Expiry = auth.token.Expiry
+	}
+	if auth.reauthErr != nil {
+		status.Error = auth.reauthErr.Error()
+		status.ReauthRequired = true
+	}
+	return status
+}
+
+// CheckStatus reloads the user from the `UserCache` and refreshes its token to
+// check that the refresh token still works.
+func (auth *Auth) CheckStatus(ctx context.Context) AuthStatus {
+	user, err := auth.userCache.Get(auth.profile)
+	if err != nil {
+		return AuthStatus{Profile: auth.profile, Error: err.Error()}
+	}
+	if user == nil {
+		auth.mtx.Lock()
+		auth.currentUser = nil
+		auth.token = nil
+		auth.mtx.Unlock()
+		return auth.Status()
+	}
+	if _, err := auth.SignInWithUser(ctx, user); err != nil {
+		status := auth.Status()
+		status.User = user
+		status.Error = err.Error()
+		return status
+	}
+	return auth.Status()
+}
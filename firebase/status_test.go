@@ -0,0 +1,74 @@
+package firebase
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckStatusRefreshesToken(t *testing.T) {
+	refreshFails := false
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, "/token") {
+				if refreshFails {
+					http.Error(w, `{"error": {"message": "TOKEN_EXPIRED"}}`,
+						http.StatusBadRequest)
+					return
+				}
+				json.NewEncoder(w).Encode(map[string]string{
+					"id_token":      "test_id_token",
+					"refresh_token": "test_refresh_token",
+					"expires_in":    "3600",
+				})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{
+				"localId":      "test",
+				"email":        "test@example.com",
+				"idToken":      "test_id_token",
+				"refreshToken": "test_refresh_token",
+				"expiresIn":    "3600",
+			})
+		}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	app := &App{APIKey: "test_api_key"}
+	auth := app.NewAuth(WithUserCache(&MemoryUserCache{}),
+		WithEmulatorHost(strings.TrimPrefix(srv.URL, "http://")))
+	if _, _, err := auth.SignInWithEmailPassword(ctx, "test@example.com", "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	status := auth.CheckStatus(ctx)
+	if status.Error != "" {
+		t.Fatal(status.Error)
+	}
+	if status.Profile != DefaultUser || status.User == nil ||
+		status.User.ProviderID != "password" {
+		t.Errorf("Unexpected status: %+v\n", status)
+	}
+	if time.Until(status.Expiry) < 30*time.Minute {
+		t.Errorf("Expected a fresh token: %v\n", status.Expiry)
+	}
+
+	refreshFails = true
+	status = auth.CheckStatus(ctx)
+	if status.Error == "" || status.User == nil {
+		t.Errorf("Expected a refresh error: %+v\n", status)
+	}
+}
+
+func TestCheckStatusSignedOut(t *testing.T) {
+	app := &App{APIKey: "test_api_key"}
+	auth := app.NewAuth(WithUserCache(&MemoryUserCache{}), WithProfile("team"))
+	status := auth.CheckStatus(context.Background())
+	if status.Profile != "team" || status.User != nil || status.Error != "" {
+		t.Errorf("Expected a signed out status: %+v\n", status)
+	}
+}
@@ -9,8 +9,11 @@ require (
 	github.com/golang/mock v1.6.0
 	github.com/urfave/cli/v2 v2.8.1
 	github.com/zalando/go-keyring v0.2.1
+	go.etcd.io/bbolt v1.3.6
+	golang.org/x/crypto v0.0.0-20220525230936-793ad666bf5e
 	golang.org/x/oauth2 v0.0.0-20220524215830-622c5d57e401
 	google.golang.org/api v0.82.0
+	google.golang.org/grpc v1.47.0
 )
 
 require (
@@ -34,6 +37,5 @@ require (
 	golang.org/x/xerrors v0.0.0-20220517211312-f3a8303e98df // indirect
 	google.golang.org/appengine v1.6.7 // indirect
 	google.golang.org/genproto v0.0.0-20220602131408-e326c6e8e9c8 // indirect
-	google.golang.org/grpc v1.47.0 // indirect
 	google.golang.org/protobuf v1.28.0 // indirect
 )
@@ -1,12 +1,15 @@
 package internal
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"sync"
 	"testing"
 	"time"
 
@@ -20,10 +23,30 @@ const (
 	TestOAuthCode    = "test_auth_code"
 
 	TestOAuthToken = "test_auth_token"
+
+	TestDeviceCode = "test_device_code"
+	TestUserCode   = "TEST-CODE"
+
+	deviceGrantType = "urn:ietf:params:oauth:grant-type:device_code"
 )
 
 type FakeAuthServer struct {
 	server *httptest.Server
+
+	mtx sync.Mutex
+	// challenge is the PKCE code challenge from the last authorization
+	// request, if any.
+	challenge string
+
+	// DevicePending is how many times device token requests are answered
+	// with authorization_pending before succeeding.
+	DevicePending int
+	// DeviceSlowDown is how many times device token requests are answered
+	// with slow_down, after any authorization_pending responses.
+	DeviceSlowDown int
+	// DeviceDenied causes device token requests to fail with access_denied.
+	DeviceDenied bool
+	devicePolls  int
 }
 
 func validateValues(key, value string,
@@ -46,11 +69,63 @@ func validateValues(key, value string,
 func NewFakeAuthServer() *FakeAuthServer {
 	tas := &FakeAuthServer{}
 	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/auth", tas.handleOAuthAuth)
 	mux.HandleFunc("/oauth/token", tas.handleOAuthToken)
+	mux.HandleFunc("/oauth/device/code", tas.handleDeviceCode)
 	tas.server = httptest.NewServer(mux)
 	return tas
 }
 
+// handleOAuthAuth approves every authorization request by redirecting back
+// to the client with TestOAuthCode.
+func (tas *FakeAuthServer) handleOAuthAuth(
+	w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	if !validateValues("client_id", TestClientID, values, w) {
+		return
+	}
+	if !validateValues("response_type", "code", values, w) {
+		return
+	}
+	redirect, err := url.Parse(values.Get("redirect_uri"))
+	if err != nil || redirect.Scheme == "" {
+		http.Error(w, "Invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	challenge := values.Get("code_challenge")
+	if challenge != "" &&
+		!validateValues("code_challenge_method", "S256", values, w) {
+		return
+	}
+	tas.mtx.Lock()
+	tas.challenge = challenge
+	tas.mtx.Unlock()
+
+	redirectValues := redirect.Query()
+	redirectValues.Set("code", TestOAuthCode)
+	redirectValues.Set("state", values.Get("state"))
+	redirect.RawQuery = redirectValues.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// validateVerifier checks the PKCE code verifier against the challenge from
+// the authorization request.
+func (tas *FakeAuthServer) validateVerifier(
+	values url.Values, w http.ResponseWriter) bool {
+	tas.mtx.Lock()
+	challenge := tas.challenge
+	tas.mtx.Unlock()
+	if challenge == "" {
+		return true
+	}
+	sum := sha256.Sum256([]byte(values.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != challenge {
+		http.Error(w, "Invalid code_verifier", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
 func (tas *FakeAuthServer) handleOAuthToken(
 	w http.ResponseWriter, r *http.Request) {
 	data, _ := ioutil.ReadAll(r.Body)
@@ -61,9 +136,16 @@ func (tas *FakeAuthServer) handleOAuthToken(
 	if !validateValues("client_secret", TestClientSecret, values, w) {
 		return
 	}
+	if values.Get("grant_type") == deviceGrantType {
+		tas.handleDeviceToken(w, values)
+		return
+	}
 	if !validateValues("code", TestOAuthCode, values, w) {
 		return
 	}
+	if !tas.validateVerifier(values, w) {
+		return
+	}
 	tokenValues := url.Values{}
 	tokenValues.Add("access_token", TestOAuthToken)
 	tokenValues.Add("id_token", TestIdToken(nil))
@@ -72,6 +154,75 @@ func (tas *FakeAuthServer) handleOAuthToken(
 	w.Write([]byte(tokenValues.Encode()))
 }
 
+// handleDeviceCode starts a device authorization request.
+func (tas *FakeAuthServer) handleDeviceCode(
+	w http.ResponseWriter, r *http.Request) {
+	data, _ := ioutil.ReadAll(r.Body)
+	values, _ := url.ParseQuery(string(data))
+	if !validateValues("client_id", TestClientID, values, w) {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"device_code":      TestDeviceCode,
+		"user_code":        TestUserCode,
+		"verification_uri": tas.server.URL + "/device",
+		"expires_in":       600,
+		"interval":         1,
+	})
+}
+
+// handleDeviceToken answers a device token request, first with any pending
+// or slow down responses that were requested.
+func (tas *FakeAuthServer) handleDeviceToken(
+	w http.ResponseWriter, values url.Values) {
+	if !validateValues("device_code", TestDeviceCode, values, w) {
+		return
+	}
+	tas.mtx.Lock()
+	defer tas.mtx.Unlock()
+	tas.devicePolls++
+	var oauthErr string
+	switch {
+	case tas.DeviceDenied:
+		oauthErr = "access_denied"
+	case tas.DevicePending > 0:
+		tas.DevicePending--
+		oauthErr = "authorization_pending"
+	case tas.DeviceSlowDown > 0:
+		tas.DeviceSlowDown--
+		oauthErr = "slow_down"
+	}
+	if oauthErr != "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": oauthErr})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token":  TestOAuthToken,
+		"id_token":      TestIdToken(nil),
+		"refresh_token": "test_refresh_token",
+		"token_type":    "Bearer",
+		"expires_in":    3600,
+	})
+}
+
+// DevicePolls returns how many device token requests have been made.
+func (tas *FakeAuthServer) DevicePolls() int {
+	tas.mtx.Lock()
+	defer tas.mtx.Unlock()
+	return tas.devicePolls
+}
+
+// DeviceAuthURL returns the URL of the device authorization endpoint.
+func (tas *FakeAuthServer) DeviceAuthURL() string {
+	return tas.server.URL + "/oauth/device/code"
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
 func (tas *FakeAuthServer) Config(t *testing.T) *oauth2.Config {
 	return &oauth2.Config{
 		ClientID:     TestClientID,
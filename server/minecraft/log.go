@@ -0,0 +1,262 @@
+package minecraft
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// logPollInterval is how often the log follower checks for new lines.
+var logPollInterval = time.Second
+
+// EventType identifies the kind of event parsed from the server log.
+type EventType string
+
+const (
+	// EventPlayerJoin is sent when a player joins the server.
+	EventPlayerJoin EventType = "player_join"
+	// EventPlayerLeave is sent when a player leaves the server.
+	EventPlayerLeave EventType = "player_leave"
+	// EventChat is sent when a player sends a chat message.
+	EventChat EventType = "chat"
+	// EventDeath is sent when a player dies.
+	EventDeath EventType = "death"
+	// EventAdvancement is sent when a player makes an advancement.
+	EventAdvancement EventType = "advancement"
+	// EventServerStart is sent when the server finishes starting.
+	EventServerStart EventType = "server_start"
+	// EventServerStop is sent when the server begins stopping.
+	EventServerStop EventType = "server_stop"
+	// EventWarning is sent when the server logs a warning.
+	EventWarning EventType = "warning"
+)
+
+// Event is a notable line from the server log.
+type Event struct {
+	Time    time.Time `json:"time" firestore:"time"`
+	Type    EventType `json:"type" firestore:"type"`
+	Player  string    `json:"player,omitempty" firestore:"player,omitempty"`
+	Message string    `json:"message" firestore:"message"`
+}
+
+var (
+	// [12:34:56] [Server thread/INFO]: message
+	logLineRegexp = regexp.MustCompile(
+		`^\[(\d{2}:\d{2}:\d{2})\] \[([^/\]]+)/([A-Z]+)\]: (.*)$`)
+
+	joinRegexp        = regexp.MustCompile(`^(\w+) joined the game$`)
+	leaveRegexp       = regexp.MustCompile(`^(\w+) left the game$`)
+	chatRegexp        = regexp.MustCompile(`^(?:\[Not Secure\] )?<(\w+)> (.*)$`)
+	advancementRegexp = regexp.MustCompile(
+		`^(\w+) has (?:made the advancement|completed the challenge|reached the goal) \[(.+)\]$`)
+	startRegexp = regexp.MustCompile(`^Done \([\d.,]+s\)!`)
+	stopRegexp  = regexp.MustCompile(`^Stopping (?:the )?server$`)
+	deathRegexp = regexp.MustCompile(`^(\w+) (?:was |were |died|drowned|` +
+		`fell |blew up|burned|hit the ground|tried to swim|suffocated|` +
+		`starved|withered|froze|experienced|went up|went off|walked into|` +
+		`discovered|didn't want)`)
+)
+
+// ParseLogLine parses a line from the server log in to an event. If the line
+// is not a notable event, false is returned.
+func ParseLogLine(line string, now time.Time) (Event, bool) {
+	match := logLineRegexp.FindStringSubmatch(strings.TrimRight(line, "\r\n"))
+	if match == nil {
+		return Event{}, false
+	}
+	event := Event{
+		Time:    parseLogTime(match[1], now),
+		Message: match[4],
+	}
+	thread, level, msg := match[2], match[3], match[4]
+	if level == "WARN" {
+		event.Type = EventWarning
+		return event, true
+	}
+	if level != "INFO" || thread != "Server thread" {
+		return Event{}, false
+	}
+	if m := joinRegexp.FindStringSubmatch(msg); m != nil {
+		event.Type, event.Player = EventPlayerJoin, m[1]
+	} else if m := leaveRegexp.FindStringSubmatch(msg); m != nil {
+		event.Type, event.Player = EventPlayerLeave, m[1]
+	} else if m := chatRegexp.FindStringSubmatch(msg); m != nil {
+		event.Type, event.Player, event.Message = EventChat, m[1], m[2]
+	} else if m := advancementRegexp.FindStringSubmatch(msg); m != nil {
+		event.Type, event.Player, event.Message = EventAdvancement, m[1], m[2]
+	} else if startRegexp.MatchString(msg) {
+		event.Type = EventServerStart
+	} else if stopRegexp.MatchString(msg) {
+		event.Type = EventServerStop
+	} else if m := deathRegexp.FindStringSubmatch(msg); m != nil {
+		event.Type, event.Player = EventDeath, m[1]
+	} else {
+		return Event{}, false
+	}
+	return event, true
+}
+
+// parseLogTime combines the time of day from the log with the date of now.
+// Log lines only include the time, so a line from just before midnight is
+// assumed to be from the previous day.
+func parseLogTime(clock string, now time.Time) time.Time {
+	parsed, err := time.ParseInLocation("15:04:05", clock, now.Location())
+	if err != nil {
+		return now
+	}
+	logTime := time.Date(now.Year(), now.Month(), now.Day(),
+		parsed.Hour(), parsed.Minute(), parsed.Second(), 0, now.Location())
+	if logTime.After(now.Add(time.Minute)) {
+		logTime = logTime.AddDate(0, 0, -1)
+	}
+	return logTime
+}
+
+// LogFollower tails a log file, following it across log rotation.
+type LogFollower struct {
+	path string
+}
+
+// NewLogFollower creates a new follower for the log at path.
+func NewLogFollower(path string) *LogFollower {
+	return &LogFollower{
+		path: path,
+	}
+}
+
+// Follow sends each line appended to the log after Follow is called. When the
+// log is rotated, the new log is followed from its start. The channel is
+// closed when ctx is canceled.
+func (lf *LogFollower) Follow(ctx context.Context) <-chan string {
+	lines := make(chan string)
+	// Open the log before returning so nothing written after Follow is missed.
+	file, _ := lf.open(true)
+	go func() {
+		defer close(lines)
+		defer func() {
+			if file != nil {
+				file.Close()
+			}
+		}()
+		var reader *bufio.Reader
+		if file != nil {
+			reader = bufio.NewReader(file)
+		}
+		var partial string
+		send := func(line string) bool {
+			select {
+			case lines <- strings.TrimRight(line, "\r\n"):
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		// drain sends everything that has been written so far.
+		drain := func() bool {
+			for reader != nil {
+				line, err := reader.ReadString('\n')
+				partial += line
+				if err != nil {
+					return true
+				}
+				if !send(partial) {
+					return false
+				}
+				partial = ""
+			}
+			return true
+		}
+		ticker := time.NewTicker(logPollInterval)
+		defer ticker.Stop()
+		for {
+			if !drain() {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if !lf.rotated(file) {
+				continue
+			}
+			// Lines written between the last drain and the rotation are
+			// still in the old file.
+			if !drain() {
+				return
+			}
+			if partial != "" && !send(partial) {
+				return
+			}
+			if file != nil {
+				file.Close()
+			}
+			file, _ = lf.open(false)
+			reader, partial = nil, ""
+			if file != nil {
+				reader = bufio.NewReader(file)
+			}
+		}
+	}()
+	return lines
+}
+
+func (lf *LogFollower) open(seekEnd bool) (*os.File, error) {
+	file, err := os.Open(lf.path)
+	if err != nil {
+		return nil, err
+	}
+	if seekEnd {
+		if _, err := file.Seek(0, io.SeekEnd); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return file, nil
+}
+
+// rotated checks if the file at the log path has been replaced or truncated
+// since file was opened.
+func (lf *LogFollower) rotated(file *os.File) bool {
+	pathInfo, err := os.Stat(lf.path)
+	if err != nil {
+		return false
+	}
+	if file == nil {
+		return true
+	}
+	fileInfo, err := file.Stat()
+	if err != nil || !os.SameFile(pathInfo, fileInfo) {
+		return true
+	}
+	offset, err := file.Seek(0, io.SeekCurrent)
+	return err == nil && pathInfo.Size() < offset
+}
+
+// WatchEvents follows the server's `logs/latest.log` and sends each event
+// parsed from it. The channel is closed when ctx is canceled.
+func (srv *Server) WatchEvents(ctx context.Context) <-chan Event {
+	events := make(chan Event)
+	lines := NewLogFollower(path.Join(srv.serverDir, "logs", "latest.log")).
+		Follow(ctx)
+	go func() {
+		defer close(events)
+		for line := range lines {
+			event, ok := ParseLogLine(line, time.Now())
+			if !ok {
+				continue
+			}
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events
+}
@@ -0,0 +1,188 @@
+package minecraft
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestParseLogLine(t *testing.T) {
+	now := time.Date(2021, 2, 3, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		line   string
+		event  EventType
+		player string
+		msg    string
+	}{
+		{"[11:00:00] [Server thread/INFO]: Steve joined the game",
+			EventPlayerJoin, "Steve", "Steve joined the game"},
+		{"[11:00:00] [Server thread/INFO]: Steve left the game",
+			EventPlayerLeave, "Steve", "Steve left the game"},
+		{"[11:00:00] [Server thread/INFO]: <Steve> hello there",
+			EventChat, "Steve", "hello there"},
+		{"[11:00:00] [Server thread/INFO]: [Not Secure] <Steve> hi",
+			EventChat, "Steve", "hi"},
+		{"[11:00:00] [Server thread/INFO]: Steve was slain by Zombie",
+			EventDeath, "Steve", "Steve was slain by Zombie"},
+		{"[11:00:00] [Server thread/INFO]: Alex drowned",
+			EventDeath, "Alex", "Alex drowned"},
+		{"[11:00:00] [Server thread/INFO]: Steve has made the advancement [Stone Age]",
+			EventAdvancement, "Steve", "Stone Age"},
+		{"[11:00:00] [Server thread/INFO]: Done (5.123s)! For help, type \"help\"",
+			EventServerStart, "", "Done (5.123s)! For help, type \"help\""},
+		{"[11:00:00] [Server thread/INFO]: Stopping server",
+			EventServerStop, "", "Stopping server"},
+		{"[11:00:00] [Server thread/WARN]: Can't keep up!",
+			EventWarning, "", "Can't keep up!"},
+	}
+	for _, test := range tests {
+		event, ok := ParseLogLine(test.line, now)
+		if !ok {
+			t.Errorf("Expected to parse: %s\n", test.line)
+			continue
+		}
+		if event.Type != test.event || event.Player != test.player ||
+			event.Message != test.msg {
+			t.Errorf("Unexpected event for %q: %+v\n", test.line, event)
+		}
+		expected := time.Date(2021, 2, 3, 11, 0, 0, 0, time.UTC)
+		if !event.Time.Equal(expected) {
+			t.Errorf("Expected: %v Got: %v\n", expected, event.Time)
+		}
+	}
+}
+
+func TestParseLogLineIgnoresOtherLines(t *testing.T) {
+	now := time.Now()
+	lines := []string{
+		"",
+		"garbage",
+		"[11:00:00] [Server thread/INFO]: Preparing spawn area: 0%",
+		"[11:00:00] [User Authenticator #1/INFO]: UUID of player Steve is abc",
+	}
+	for _, line := range lines {
+		if event, ok := ParseLogLine(line, now); ok {
+			t.Errorf("Expected to ignore %q: %+v\n", line, event)
+		}
+	}
+}
+
+func TestParseLogLineHandlesMidnight(t *testing.T) {
+	now := time.Date(2021, 2, 3, 0, 0, 5, 0, time.UTC)
+	event, ok := ParseLogLine(
+		"[23:59:59] [Server thread/INFO]: Steve left the game", now)
+	if !ok {
+		t.Fatal("Expected to parse line")
+	}
+	expected := time.Date(2021, 2, 2, 23, 59, 59, 0, time.UTC)
+	if !event.Time.Equal(expected) {
+		t.Errorf("Expected: %v Got: %v\n", expected, event.Time)
+	}
+}
+
+func testAppendLog(t *testing.T, logPath, data string) {
+	t.Helper()
+	file, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err = file.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testNextLine(t *testing.T, lines <-chan string) string {
+	t.Helper()
+	select {
+	case line := <-lines:
+		return line
+	case <-time.After(time.Second * 5):
+		t.Fatal("Timed out waiting for a line")
+	}
+	return ""
+}
+
+func TestLogFollowerFollowsRotation(t *testing.T) {
+	restore := logPollInterval
+	logPollInterval = time.Millisecond * 10
+	defer func() { logPollInterval = restore }()
+
+	logPath := path.Join(t.TempDir(), "latest.log")
+	testAppendLog(t, logPath, "old line\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lines := NewLogFollower(logPath).Follow(ctx)
+
+	testAppendLog(t, logPath, "first ")
+	testAppendLog(t, logPath, "line\n")
+	if line := testNextLine(t, lines); line != "first line" {
+		t.Errorf("Expected: %q Got: %q\n", "first line", line)
+	}
+
+	// Written just before the rotation, likely after the log was last read.
+	testAppendLog(t, logPath, "last line\n")
+	err := os.Rename(logPath, logPath+".1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testAppendLog(t, logPath, "rotated line\n")
+	if line := testNextLine(t, lines); line != "last line" {
+		t.Errorf("Expected: %q Got: %q\n", "last line", line)
+	}
+	if line := testNextLine(t, lines); line != "rotated line" {
+		t.Errorf("Expected: %q Got: %q\n", "rotated line", line)
+	}
+
+	cancel()
+	for range lines {
+	}
+}
+
+func TestLogFollowerWaitsForLog(t *testing.T) {
+	restore := logPollInterval
+	logPollInterval = time.Millisecond * 10
+	defer func() { logPollInterval = restore }()
+
+	logPath := path.Join(t.TempDir(), "latest.log")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lines := NewLogFollower(logPath).Follow(ctx)
+
+	testAppendLog(t, logPath, "new line\n")
+	if line := testNextLine(t, lines); line != "new line" {
+		t.Errorf("Expected: %q Got: %q\n", "new line", line)
+	}
+}
+
+func TestServerWatchEvents(t *testing.T) {
+	restore := logPollInterval
+	logPollInterval = time.Millisecond * 10
+	defer func() { logPollInterval = restore }()
+
+	tc := newTestContext(t)
+	defer tc.Finish()
+	logDir := path.Join(tc.server.serverDir, "logs")
+	if err := os.MkdirAll(logDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := tc.server.WatchEvents(ctx)
+	testAppendLog(t, path.Join(logDir, "latest.log"),
+		"[11:00:00] [Server thread/INFO]: Preparing level \"world\"\n"+
+			"[11:00:00] [Server thread/INFO]: Steve joined the game\n")
+
+	select {
+	case event := <-events:
+		if event.Type != EventPlayerJoin || event.Player != "Steve" {
+			t.Errorf("Unexpected event: %+v\n", event)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("Timed out waiting for an event")
+	}
+}
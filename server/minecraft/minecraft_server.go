@@ -1,12 +1,21 @@
 package minecraft
 
 import (
-	"fmt"
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"time"
 
 	config "github.com/Coderlane/go-minecraft-config"
+	"github.com/Coderlane/go-minecraft-ping/client"
 	"github.com/Coderlane/go-minecraft-ping/mcclient"
 )
 
+// statusTimeout bounds a status ping, including connecting, so an
+// unreachable server can not stall the caller.
+var statusTimeout = time.Second * 5
+
 // ClientBuilder creates new minecraft clients from a config
 type ClientBuilder func(*config.Config) (mcclient.MinecraftClient, error)
 
@@ -14,6 +23,9 @@ type Server struct {
 	serverDir     string
 	cfg           *config.Config
 	clientBuilder ClientBuilder
+
+	rconMtx sync.Mutex
+	rcon    *RCONClient
 }
 
 // PlayerInfo represents a minecraft player
@@ -60,6 +72,7 @@ func (srv *Server) GetServerInfo() interface{} {
 	if err != nil {
 		return cfgToOfflineServerInfo(srv.cfg)
 	}
+	defer client.Close()
 	status, err := client.Status()
 	if err != nil {
 		return cfgToOfflineServerInfo(srv.cfg)
@@ -67,12 +80,42 @@ func (srv *Server) GetServerInfo() interface{} {
 	return statusToServerInfo(status)
 }
 
+// GetOfflineServerInfo returns the server info based only on the server
+// config, as if the server were offline.
+func (srv *Server) GetOfflineServerInfo() interface{} {
+	return cfgToOfflineServerInfo(srv.cfg)
+}
+
+// ExecCommand runs cmd on the server over RCON and returns the output. RCON
+// must be enabled in the server config.
+func (srv *Server) ExecCommand(ctx context.Context, cmd string) (string, error) {
+	rcon, err := srv.getRCONClient()
+	if err != nil {
+		return "", err
+	}
+	return rcon.Exec(ctx, cmd)
+}
+
+func (srv *Server) getRCONClient() (*RCONClient, error) {
+	srv.rconMtx.Lock()
+	defer srv.rconMtx.Unlock()
+	if srv.rcon != nil {
+		return srv.rcon, nil
+	}
+	if !srv.cfg.EnableRCON {
+		return nil, ErrRCONDisabled
+	}
+	srv.rcon = NewRCONClient(rconAddress(srv.cfg), srv.cfg.RCONPassword)
+	return srv.rcon, nil
+}
+
 func (srv *Server) getClient() (mcclient.MinecraftClient, error) {
 	client, err := srv.clientBuilder(srv.cfg)
 	if err != nil {
 		return nil, err
 	}
 	if err = client.Handshake(mcclient.ClientStateStatus); err != nil {
+		client.Close()
 		return nil, err
 	}
 	return client, nil
@@ -80,8 +123,47 @@ func (srv *Server) getClient() (mcclient.MinecraftClient, error) {
 
 func defaultClientBuilder(
 	cfg *config.Config) (mcclient.MinecraftClient, error) {
-	return mcclient.NewMinecraftClientFromAddress(
-		fmt.Sprintf("%s:%d", cfg.ServerIP, cfg.ServerPort))
+	address := net.JoinHostPort(cfg.ServerIP, strconv.Itoa(cfg.ServerPort))
+	conn, err := net.DialTimeout("tcp", address, statusTimeout)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(statusTimeout))
+	return mcclient.NewMinecraftClient(statusConn{conn})
+}
+
+// statusConn sends minecraft packets over a connection, it allows the
+// connection's deadline to be set unlike client.NewClient.
+type statusConn struct {
+	net.Conn
+}
+
+func (sc statusConn) Addr() string {
+	return sc.RemoteAddr().String()
+}
+
+func (sc statusConn) Send(pkt client.Packet) error {
+	return pkt.EncodeBinary(sc.Conn)
+}
+
+func (sc statusConn) Recv() (*client.Packet, error) {
+	var pkt client.Packet
+	if err := pkt.DecodeBinary(sc.Conn); err != nil {
+		return nil, err
+	}
+	return &pkt, nil
+}
+
+func rconAddress(cfg *config.Config) string {
+	host := cfg.ServerIP
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	port := cfg.RCONPort
+	if port == 0 {
+		port = rconDefaultPort
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
 }
 
 func cfgToOfflineServerInfo(cfg *config.Config) ServerInfo {
@@ -3,8 +3,10 @@ package minecraft
 import (
 	"fmt"
 	"io/ioutil"
+	"net"
 	"path"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 
@@ -40,6 +42,7 @@ func newTestContext(t *testing.T) *testContext {
 	server, err := newServerWithCustomClientBuider(tempDir,
 		func(*config.Config) (mcclient.MinecraftClient, error) {
 			client.EXPECT().Handshake(gomock.Any()).Return(nil)
+			client.EXPECT().Close().Return(nil)
 			return client, nil
 		})
 	if err != nil {
@@ -110,6 +113,47 @@ func TestGetMinecraftServerInfoHandlesOffline(t *testing.T) {
 	}
 }
 
+func TestGetMinecraftServerInfoTimesOut(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	// Accept connections, but never respond.
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(time.Second)
+		}
+	}()
+	restore := statusTimeout
+	statusTimeout = time.Millisecond * 50
+	defer func() { statusTimeout = restore }()
+
+	tempDir := t.TempDir()
+	cfg := fmt.Sprintf("server-ip=127.0.0.1\nserver-port=%d\n",
+		listener.Addr().(*net.TCPAddr).Port)
+	err = ioutil.WriteFile(path.Join(tempDir, "server.properties"),
+		[]byte(cfg), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := NewServer(tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	serverInfo := server.GetServerInfo().(ServerInfo)
+	if serverInfo.Online {
+		t.Errorf("Expected server to be offline.")
+	}
+	if elapsed := time.Since(start); elapsed > time.Millisecond*500 {
+		t.Errorf("Expected the status ping to time out, took: %v", elapsed)
+	}
+}
+
 func TestGetMinecraftServerInfoHandlesError(t *testing.T) {
 	tc := newTestContext(t)
 	defer tc.Finish()
@@ -121,3 +165,16 @@ func TestGetMinecraftServerInfoHandlesError(t *testing.T) {
 		t.Errorf("Expected server to be offline.")
 	}
 }
+
+func TestGetOfflineServerInfo(t *testing.T) {
+	tc := newTestContext(t)
+	defer tc.Finish()
+
+	serverInfo := tc.server.GetOfflineServerInfo().(ServerInfo)
+	if serverInfo.Online {
+		t.Errorf("Expected server to be offline.")
+	}
+	if serverInfo.MaxPlayers != 25 {
+		t.Errorf("Expected: 25 Got: %d\n", serverInfo.MaxPlayers)
+	}
+}
@@ -0,0 +1,272 @@
+package minecraft
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	rconTypeResponse     int32 = 0
+	rconTypeCommand      int32 = 2
+	rconTypeAuthResponse int32 = 2
+	rconTypeAuth         int32 = 3
+
+	// rconHeaderSize is the size of the ID and type fields plus the two
+	// trailing null bytes.
+	rconHeaderSize = 10
+	// rconMaxCommandSize is the largest body the server will accept.
+	rconMaxCommandSize = 1446
+	// rconMaxResponseSize is the largest body the server will send in a
+	// single packet. Larger responses are split across packets.
+	rconMaxResponseSize = 4096
+
+	rconDefaultPort = 25575
+)
+
+// rconTimeout is used for RCON requests when the context has no deadline.
+var rconTimeout = time.Second * 10
+
+// rconProbeTimeout bounds the check for a closed connection before a command
+// is sent.
+const rconProbeTimeout = time.Millisecond
+
+var (
+	// ErrRCONDisabled is returned when the server does not have RCON enabled.
+	ErrRCONDisabled = errors.New("rcon is not enabled on the server")
+	// ErrRCONAuth is returned when the server rejects the RCON password.
+	ErrRCONAuth = errors.New("rcon authentication failed")
+)
+
+type rconPacket struct {
+	ID   int32
+	Type int32
+	Body string
+}
+
+// RCONClient executes commands on a server using the Source RCON protocol.
+// The connection is established lazily and re-established if it is lost.
+type RCONClient struct {
+	address  string
+	password string
+
+	mtx    sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+	nextID int32
+}
+
+// NewRCONClient creates a new RCON client for the server at address.
+func NewRCONClient(address, password string) *RCONClient {
+	return &RCONClient{
+		address:  address,
+		password: password,
+	}
+}
+
+// Exec runs cmd on the server and returns its output. If the connection was
+// lost since the last command, Exec reconnects before sending it. A command
+// is never sent twice, once it reaches the server a failure is returned
+// since the command may already have run.
+func (rc *RCONClient) Exec(ctx context.Context, cmd string) (string, error) {
+	if len(cmd) > rconMaxCommandSize {
+		return "", fmt.Errorf("rcon command too long: %d bytes", len(cmd))
+	}
+	rc.mtx.Lock()
+	defer rc.mtx.Unlock()
+	reused := rc.conn != nil
+	output, written, err := rc.exec(ctx, cmd)
+	if err != nil && reused && !written &&
+		ctx.Err() == nil && !errors.Is(err, ErrRCONAuth) {
+		output, _, err = rc.exec(ctx, cmd)
+	}
+	return output, err
+}
+
+// Close closes the connection to the server, if any.
+func (rc *RCONClient) Close() error {
+	rc.mtx.Lock()
+	defer rc.mtx.Unlock()
+	return rc.closeConn()
+}
+
+func (rc *RCONClient) closeConn() error {
+	if rc.conn == nil {
+		return nil
+	}
+	err := rc.conn.Close()
+	rc.conn = nil
+	rc.reader = nil
+	return err
+}
+
+// exec runs cmd, reconnecting first if needed. written reports whether the
+// command packet was sent to the server.
+func (rc *RCONClient) exec(ctx context.Context,
+	cmd string) (output string, written bool, err error) {
+	if rc.conn != nil && !rc.connAlive() {
+		rc.closeConn()
+	}
+	if rc.conn == nil {
+		if err := rc.connect(ctx); err != nil {
+			return "", false, err
+		}
+	}
+	output, written, err = rc.command(ctx, cmd)
+	if err != nil {
+		rc.closeConn()
+		return "", written, err
+	}
+	return output, true, nil
+}
+
+// connAlive checks whether the server closed the idle connection. The server
+// sends nothing between requests, so any data or error other than a timeout
+// means the connection can not be used.
+func (rc *RCONClient) connAlive() bool {
+	// A deadline in the past fails without reading, so allow a brief wait.
+	rc.conn.SetReadDeadline(time.Now().Add(rconProbeTimeout))
+	_, err := rc.reader.Peek(1)
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func (rc *RCONClient) connect(ctx context.Context) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", rc.address)
+	if err != nil {
+		return err
+	}
+	rc.conn = conn
+	rc.reader = bufio.NewReader(conn)
+	if err = rc.authenticate(ctx); err != nil {
+		rc.closeConn()
+		return err
+	}
+	return nil
+}
+
+func (rc *RCONClient) authenticate(ctx context.Context) error {
+	defer rc.watchContext(ctx)()
+	id := rc.newID()
+	err := rc.writePacket(rconPacket{ID: id, Type: rconTypeAuth, Body: rc.password})
+	if err != nil {
+		return err
+	}
+	for {
+		packet, err := rc.readPacket()
+		if err != nil {
+			return err
+		}
+		// Some servers send an empty response before the auth response.
+		if packet.Type != rconTypeAuthResponse {
+			continue
+		}
+		if packet.ID != id {
+			return ErrRCONAuth
+		}
+		return nil
+	}
+}
+
+// command sends cmd and reads its response. written reports whether the
+// command packet was sent, after which the command must not be retried.
+func (rc *RCONClient) command(ctx context.Context,
+	cmd string) (string, bool, error) {
+	defer rc.watchContext(ctx)()
+	id := rc.newID()
+	err := rc.writePacket(rconPacket{ID: id, Type: rconTypeCommand, Body: cmd})
+	if err != nil {
+		return "", false, err
+	}
+	// The server answers requests in order, so a response to this follow up
+	// packet marks the end of a response split across several packets.
+	sentinel := rc.newID()
+	err = rc.writePacket(rconPacket{ID: sentinel, Type: rconTypeResponse})
+	if err != nil {
+		return "", true, err
+	}
+	var output strings.Builder
+	for {
+		packet, err := rc.readPacket()
+		if err != nil {
+			return "", true, err
+		}
+		switch packet.ID {
+		case id:
+			output.WriteString(packet.Body)
+		case sentinel:
+			return output.String(), true, nil
+		default:
+			return "", true,
+				fmt.Errorf("unexpected rcon response id: %d", packet.ID)
+		}
+	}
+}
+
+// watchContext applies the context deadline to the connection and aborts
+// outstanding I/O if the context is canceled. The returned function must be
+// called once the request completes.
+func (rc *RCONClient) watchContext(ctx context.Context) func() {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(rconTimeout)
+	}
+	conn := rc.conn
+	conn.SetDeadline(deadline)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+func (rc *RCONClient) newID() int32 {
+	// Negative IDs are reserved for authentication failures.
+	rc.nextID = (rc.nextID + 1) & 0x7fffffff
+	return rc.nextID
+}
+
+func (rc *RCONClient) writePacket(packet rconPacket) error {
+	buf := make([]byte, 4+rconHeaderSize+len(packet.Body))
+	binary.LittleEndian.PutUint32(buf[0:], uint32(rconHeaderSize+len(packet.Body)))
+	binary.LittleEndian.PutUint32(buf[4:], uint32(packet.ID))
+	binary.LittleEndian.PutUint32(buf[8:], uint32(packet.Type))
+	copy(buf[12:], packet.Body)
+	_, err := rc.conn.Write(buf)
+	return err
+}
+
+func (rc *RCONClient) readPacket() (rconPacket, error) {
+	return readRCONPacket(rc.reader)
+}
+
+func readRCONPacket(reader io.Reader) (rconPacket, error) {
+	var size int32
+	if err := binary.Read(reader, binary.LittleEndian, &size); err != nil {
+		return rconPacket{}, err
+	}
+	if size < rconHeaderSize || size > rconHeaderSize+rconMaxResponseSize {
+		return rconPacket{}, fmt.Errorf("invalid rcon packet size: %d", size)
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		return rconPacket{}, err
+	}
+	return rconPacket{
+		ID:   int32(binary.LittleEndian.Uint32(buf[0:])),
+		Type: int32(binary.LittleEndian.Uint32(buf[4:])),
+		Body: string(buf[8 : size-2]),
+	}, nil
+}
@@ -0,0 +1,320 @@
+package minecraft
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testRCONPassword = "hunter2"
+
+// fakeRCONServer emulates the RCON behavior of a vanilla minecraft server.
+type fakeRCONServer struct {
+	listener net.Listener
+
+	mtx       sync.Mutex
+	conns     []net.Conn
+	commands  []string
+	responses map[string]string
+	// closeOn lists commands the server drops the connection on after
+	// reading them, without responding.
+	closeOn map[string]bool
+}
+
+func newFakeRCONServer(t *testing.T) *fakeRCONServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	frs := &fakeRCONServer{
+		listener:  listener,
+		responses: make(map[string]string),
+		closeOn:   make(map[string]bool),
+	}
+	go frs.serve()
+	return frs
+}
+
+func (frs *fakeRCONServer) Address() string {
+	return frs.listener.Addr().String()
+}
+
+func (frs *fakeRCONServer) Port() int {
+	return frs.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (frs *fakeRCONServer) Commands() []string {
+	frs.mtx.Lock()
+	defer frs.mtx.Unlock()
+	return append([]string{}, frs.commands...)
+}
+
+// DropConnections closes every open connection to the server.
+func (frs *fakeRCONServer) DropConnections() {
+	frs.mtx.Lock()
+	defer frs.mtx.Unlock()
+	for _, conn := range frs.conns {
+		conn.Close()
+	}
+	frs.conns = nil
+}
+
+func (frs *fakeRCONServer) Close() {
+	frs.listener.Close()
+	frs.DropConnections()
+}
+
+func (frs *fakeRCONServer) serve() {
+	for {
+		conn, err := frs.listener.Accept()
+		if err != nil {
+			return
+		}
+		frs.mtx.Lock()
+		frs.conns = append(frs.conns, conn)
+		frs.mtx.Unlock()
+		go frs.handle(conn)
+	}
+}
+
+func (frs *fakeRCONServer) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	authenticated := false
+	for {
+		packet, err := readRCONPacket(reader)
+		if err != nil {
+			return
+		}
+		switch {
+		case packet.Type == rconTypeAuth:
+			id := packet.ID
+			if packet.Body == testRCONPassword {
+				authenticated = true
+			} else {
+				id = -1
+			}
+			writeTestRCONPacket(conn, rconPacket{ID: id, Type: rconTypeAuthResponse})
+		case !authenticated:
+			return
+		case packet.Type == rconTypeCommand:
+			frs.mtx.Lock()
+			frs.commands = append(frs.commands, packet.Body)
+			response := frs.responses[packet.Body]
+			closeConn := frs.closeOn[packet.Body]
+			frs.mtx.Unlock()
+			if closeConn {
+				return
+			}
+			// Split long responses across packets like the server does.
+			for {
+				body := response
+				if len(body) > rconMaxResponseSize {
+					body = body[:rconMaxResponseSize]
+				}
+				writeTestRCONPacket(conn,
+					rconPacket{ID: packet.ID, Type: rconTypeResponse, Body: body})
+				response = response[len(body):]
+				if len(response) == 0 {
+					break
+				}
+			}
+		default:
+			writeTestRCONPacket(conn, rconPacket{ID: packet.ID,
+				Type: rconTypeResponse,
+				Body: fmt.Sprintf("Unknown request %x", packet.Type)})
+		}
+	}
+}
+
+func writeTestRCONPacket(conn net.Conn, packet rconPacket) {
+	buf := make([]byte, 4+rconHeaderSize+len(packet.Body))
+	binary.LittleEndian.PutUint32(buf[0:], uint32(rconHeaderSize+len(packet.Body)))
+	binary.LittleEndian.PutUint32(buf[4:], uint32(packet.ID))
+	binary.LittleEndian.PutUint32(buf[8:], uint32(packet.Type))
+	copy(buf[12:], packet.Body)
+	conn.Write(buf)
+}
+
+func TestRCONExecCommand(t *testing.T) {
+	frs := newFakeRCONServer(t)
+	defer frs.Close()
+	frs.responses["list"] = "There are 0 of a max of 20 players online: "
+
+	rc := NewRCONClient(frs.Address(), testRCONPassword)
+	defer rc.Close()
+
+	output, err := rc.Exec(context.Background(), "list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != frs.responses["list"] {
+		t.Errorf("Expected: %q Got: %q\n", frs.responses["list"], output)
+	}
+}
+
+func TestRCONExecMultiPacketResponse(t *testing.T) {
+	frs := newFakeRCONServer(t)
+	defer frs.Close()
+	frs.responses["help"] = strings.Repeat("a", rconMaxResponseSize*2+10)
+
+	rc := NewRCONClient(frs.Address(), testRCONPassword)
+	defer rc.Close()
+
+	output, err := rc.Exec(context.Background(), "help")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != frs.responses["help"] {
+		t.Errorf("Expected %d bytes Got: %d\n",
+			len(frs.responses["help"]), len(output))
+	}
+}
+
+func TestRCONExecBadPasswordFails(t *testing.T) {
+	frs := newFakeRCONServer(t)
+	defer frs.Close()
+
+	rc := NewRCONClient(frs.Address(), "invalid")
+	defer rc.Close()
+
+	_, err := rc.Exec(context.Background(), "list")
+	if err != ErrRCONAuth {
+		t.Errorf("Expected: %v Got: %v\n", ErrRCONAuth, err)
+	}
+}
+
+func TestRCONExecReconnects(t *testing.T) {
+	frs := newFakeRCONServer(t)
+	defer frs.Close()
+
+	rc := NewRCONClient(frs.Address(), testRCONPassword)
+	defer rc.Close()
+
+	ctx := context.Background()
+	if _, err := rc.Exec(ctx, "say one"); err != nil {
+		t.Fatal(err)
+	}
+	frs.DropConnections()
+	if _, err := rc.Exec(ctx, "say two"); err != nil {
+		t.Fatal(err)
+	}
+	commands := frs.Commands()
+	if len(commands) != 2 || commands[1] != "say two" {
+		t.Errorf("Unexpected commands: %v\n", commands)
+	}
+}
+
+func TestRCONExecDoesNotRetrySentCommand(t *testing.T) {
+	frs := newFakeRCONServer(t)
+	defer frs.Close()
+	frs.closeOn["stop"] = true
+
+	rc := NewRCONClient(frs.Address(), testRCONPassword)
+	defer rc.Close()
+
+	ctx := context.Background()
+	if _, err := rc.Exec(ctx, "list"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rc.Exec(ctx, "stop"); err == nil {
+		t.Errorf("Expected to fail")
+	}
+	commands := frs.Commands()
+	if len(commands) != 2 || commands[1] != "stop" {
+		t.Errorf("Unexpected commands: %v\n", commands)
+	}
+}
+
+func TestRCONExecHandlesCanceledContext(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	// Accept connections, but never respond.
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(time.Second)
+		}
+	}()
+
+	rc := NewRCONClient(listener.Addr().String(), testRCONPassword)
+	defer rc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	_, err = rc.Exec(ctx, "list")
+	if err == nil {
+		t.Errorf("Expected to time out")
+	}
+	t.Log(err)
+}
+
+func TestRCONExecCommandTooLongFails(t *testing.T) {
+	rc := NewRCONClient("127.0.0.1:0", testRCONPassword)
+	_, err := rc.Exec(context.Background(),
+		strings.Repeat("a", rconMaxCommandSize+1))
+	if err == nil {
+		t.Errorf("Expected to fail")
+	}
+}
+
+func TestServerExecCommand(t *testing.T) {
+	frs := newFakeRCONServer(t)
+	defer frs.Close()
+	frs.responses["seed"] = "Seed: [1234]"
+
+	tempDir := t.TempDir()
+	serverConfig := fmt.Sprintf(`
+enable-rcon=true
+rcon.port=%d
+rcon.password=%s
+server-ip=127.0.0.1
+server-port=25565`, frs.Port(), testRCONPassword)
+	err := ioutil.WriteFile(path.Join(tempDir, "server.properties"),
+		[]byte(serverConfig), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := NewServer(tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := server.ExecCommand(context.Background(), "seed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != frs.responses["seed"] {
+		t.Errorf("Expected: %q Got: %q\n", frs.responses["seed"], output)
+	}
+}
+
+func TestServerExecCommandRequiresRCON(t *testing.T) {
+	tempDir := t.TempDir()
+	err := ioutil.WriteFile(path.Join(tempDir, "server.properties"),
+		[]byte("enable-rcon=false\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := NewServer(tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = server.ExecCommand(context.Background(), "seed")
+	if err != ErrRCONDisabled {
+		t.Errorf("Expected: %v Got: %v\n", ErrRCONDisabled, err)
+	}
+}
@@ -0,0 +1,35 @@
+package minecraft
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+var (
+	// Formatting codes like §a are used to color command output.
+	formattingRegexp = regexp.MustCompile(`§.`)
+	// TPS from last 1m, 5m, 15m: 20.0, 20.0, 20.0
+	tpsRegexp = regexp.MustCompile(`TPS from last 1m[^:]*:\s*\*?([\d.]+)`)
+)
+
+// GetTPS fetches the ticks per second over the last minute using the `tps`
+// command. The command is provided by Spigot and Paper servers, vanilla
+// servers will return an error.
+func (srv *Server) GetTPS(ctx context.Context) (float64, error) {
+	output, err := srv.ExecCommand(ctx, "tps")
+	if err != nil {
+		return 0, err
+	}
+	return parseTPS(output)
+}
+
+func parseTPS(output string) (float64, error) {
+	match := tpsRegexp.FindStringSubmatch(
+		formattingRegexp.ReplaceAllString(output, ""))
+	if match == nil {
+		return 0, fmt.Errorf("unexpected tps output: %q", output)
+	}
+	return strconv.ParseFloat(match[1], 64)
+}
@@ -0,0 +1,30 @@
+package minecraft
+
+import (
+	"testing"
+)
+
+func TestParseTPS(t *testing.T) {
+	tests := map[string]float64{
+		"§6TPS from last 1m, 5m, 15m: §a20.0, §a20.0, §a20.0":  20.0,
+		"TPS from last 1m, 5m, 15m: 18.5, 19.2, 19.9":          18.5,
+		"§6TPS from last 1m, 5m, 15m: §a*20.0, §a20.0, §a20.0": 20.0,
+	}
+	for output, expected := range tests {
+		tps, err := parseTPS(output)
+		if err != nil {
+			t.Errorf("Failed to parse %q: %v\n", output, err)
+			continue
+		}
+		if tps != expected {
+			t.Errorf("Expected: %f Got: %f\n", expected, tps)
+		}
+	}
+}
+
+func TestParseTPSHandlesUnknownCommand(t *testing.T) {
+	_, err := parseTPS("Unknown or incomplete command, see below for error")
+	if err == nil {
+		t.Errorf("Expected to fail to parse tps")
+	}
+}
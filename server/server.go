@@ -1,6 +1,11 @@
 package server
 
 import (
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+
 	"github.com/Coderlane/minecraft-sidecart/server/minecraft"
 )
 
@@ -16,20 +21,98 @@ const (
 	ServerTypeMinecraft Type = 1
 )
 
+func init() {
+	// Server info is passed to clients as an interface{}, register the
+	// concrete types so they can be sent over RPC.
+	gob.Register(minecraft.ServerInfo{})
+}
+
+func (t Type) String() string {
+	switch t {
+	case ServerTypeMinecraft:
+		return "minecraft"
+	default:
+		return "unknown"
+	}
+}
+
 // Server provides common functions for working with a game server
 type Server interface {
 	GetServerInfo() interface{}
 }
 
+// CommandExecutor is implemented by servers which can run remote commands.
+type CommandExecutor interface {
+	ExecCommand(context.Context, string) (string, error)
+}
+
+// EventWatcher is implemented by servers which can report events, like
+// players joining, as they happen.
+type EventWatcher interface {
+	WatchEvents(context.Context) <-chan minecraft.Event
+}
+
 func GetType(srv interface{}) Type {
 	switch srv.(type) {
-	case minecraft.Server:
+	case minecraft.Server, *minecraft.Server:
 		return ServerTypeMinecraft
 	default:
 		return ServerTypeUnknown
 	}
 }
 
+// GetOfflineServerInfo returns the info to report for srv when it is not
+// being monitored, or nil if the server type is unknown.
+func GetOfflineServerInfo(srv interface{}) interface{} {
+	switch srv := srv.(type) {
+	case *minecraft.Server:
+		return srv.GetOfflineServerInfo()
+	default:
+		return nil
+	}
+}
+
+// TPSReporter is implemented by servers which can report their ticks per
+// second.
+type TPSReporter interface {
+	GetTPS(context.Context) (float64, error)
+}
+
+// GetOnlinePlayers returns whether the server info reports the server as
+// online and how many players are on it.
+func GetOnlinePlayers(info interface{}) (bool, int) {
+	switch info := info.(type) {
+	case minecraft.ServerInfo:
+		return info.Online, info.OnlinePlayers
+	default:
+		return false, 0
+	}
+}
+
+// GetPlayers returns the players listed in the server info. The boolean is
+// false if the list may be incomplete, for example when the server only
+// reports a sample of its players.
+func GetPlayers(info interface{}) ([]minecraft.PlayerInfo, bool) {
+	switch info := info.(type) {
+	case minecraft.ServerInfo:
+		return info.Players, info.OnlinePlayers <= len(info.Players)
+	default:
+		return nil, false
+	}
+}
+
+// DecodeServerInfo decodes JSON encoded server info for a server of type t.
+func DecodeServerInfo(t Type, data []byte) (interface{}, error) {
+	switch t {
+	case ServerTypeMinecraft:
+		var info minecraft.ServerInfo
+		err := json.Unmarshal(data, &info)
+		return info, err
+	default:
+		return nil, fmt.Errorf("unknown server type: %d", t)
+	}
+}
+
 // NewServer creates a new server connection based on the configs in serverDir
 func NewServer(serverDir string) (Server, error) {
 	return minecraft.NewServer(serverDir)
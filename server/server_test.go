@@ -0,0 +1,73 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/Coderlane/minecraft-sidecart/server/minecraft"
+)
+
+func TestGetTypeDetectsMinecraft(t *testing.T) {
+	if GetType(&minecraft.Server{}) != ServerTypeMinecraft {
+		t.Errorf("Expected a minecraft server")
+	}
+	if GetType(minecraft.Server{}) != ServerTypeMinecraft {
+		t.Errorf("Expected a minecraft server")
+	}
+	if GetType(nil) != ServerTypeUnknown {
+		t.Errorf("Expected an unknown server")
+	}
+}
+
+func TestGetOfflineServerInfoHandlesUnknown(t *testing.T) {
+	if info := GetOfflineServerInfo(nil); info != nil {
+		t.Errorf("Expected no info for an unknown server: %v", info)
+	}
+}
+
+func TestGetPlayers(t *testing.T) {
+	info := minecraft.ServerInfo{
+		OnlinePlayers: 1,
+		Players:       []minecraft.PlayerInfo{{Name: "test", UUID: "abc"}},
+	}
+	players, complete := GetPlayers(info)
+	if len(players) != 1 || !complete {
+		t.Errorf("Expected a complete player list: %v", players)
+	}
+
+	info.OnlinePlayers = 20
+	if _, complete = GetPlayers(info); complete {
+		t.Errorf("Expected a partial player list")
+	}
+
+	if _, complete = GetPlayers(nil); complete {
+		t.Errorf("Expected an unknown player list")
+	}
+}
+
+func TestGetOnlinePlayers(t *testing.T) {
+	online, players := GetOnlinePlayers(
+		minecraft.ServerInfo{Online: true, OnlinePlayers: 3})
+	if !online || players != 3 {
+		t.Errorf("Expected 3 online players, got: %v %d", online, players)
+	}
+	online, players = GetOnlinePlayers(nil)
+	if online || players != 0 {
+		t.Errorf("Expected an offline server, got: %v %d", online, players)
+	}
+}
+
+func TestDecodeServerInfo(t *testing.T) {
+	info, err := DecodeServerInfo(ServerTypeMinecraft,
+		[]byte(`{"motd":"test","max_players":5}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mcInfo := info.(minecraft.ServerInfo)
+	if mcInfo.MotD != "test" || mcInfo.MaxPlayers != 5 {
+		t.Errorf("Unexpected info: %+v", mcInfo)
+	}
+
+	if _, err = DecodeServerInfo(ServerTypeUnknown, []byte(`{}`)); err == nil {
+		t.Errorf("Expected to fail to decode an unknown server type")
+	}
+}
@@ -3,25 +3,87 @@ package main
 import (
 	"fmt"
 	"os"
+	"path"
 
 	"github.com/Coderlane/minecraft-sidecart/cmd"
+	"github.com/Coderlane/minecraft-sidecart/daemon"
 	"github.com/Coderlane/minecraft-sidecart/firebase"
 
 	"github.com/urfave/cli/v2"
 )
 
+// newUserCache creates the user cache selected by the --user-cache flag. In
+// auto mode, if there is no keyring and no key for the file cache, users are
+// only kept in memory and a warning is printed.
+func newUserCache(c *cli.Context, projectID string) (firebase.UserCache, error) {
+	kind := c.String("user-cache")
+	switch kind {
+	case "keyring":
+		return NewLocalUserCache(projectID), nil
+	case "auto", "file":
+	default:
+		return nil, fmt.Errorf("unknown user cache: %s", kind)
+	}
+	if kind == "auto" && keyringAvailable(projectID) {
+		return NewLocalUserCache(projectID), nil
+	}
+	cachePath := path.Join(DefaultUserCacheDir(), "users.enc")
+	keyFile := c.String("user-cache-key-file")
+	if keyFile == "" {
+		var err error
+		keyFile, err = FindUserCacheKey()
+		if err != nil && kind == "auto" {
+			fmt.Fprintf(c.App.ErrWriter, "Warning: there is no keyring and no "+
+				"key for %s, signed in users will not be saved: %v\n", cachePath, err)
+			return &firebase.MemoryUserCache{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return NewFileUserCache(cachePath, keyFile)
+}
+
 func main() {
 	app := firebase.DefaultApp
-	uc := NewLocalUserCache(app.ProjectID)
-	auth := app.NewAuth(firebase.WithUserCache(uc))
 
 	cliApp := cli.NewApp()
 	cliApp.Usage = "A helper for minecraft servers"
+	cliApp.Flags = []cli.Flag{
+		&cli.StringFlag{
+			Name: "user-cache",
+			Usage: "Where to keep signed in users: keyring, file, or auto to " +
+				"use the keyring when it is available",
+			Value:   "auto",
+			EnvVars: []string{"SIDECART_USER_CACHE"},
+		},
+		&cli.StringFlag{
+			Name:    "user-cache-key-file",
+			Usage:   "The key for the file user cache",
+			EnvVars: []string{"SIDECART_USER_CACHE_KEY_FILE"},
+		},
+		&cli.StringFlag{
+			Name:    "runtime-dir",
+			Usage:   "The directory holding the daemon's socket",
+			Value:   daemon.DefaultRootDir,
+			EnvVars: []string{"SIDECART_RUNTIME_DIR"},
+		},
+	}
 	cliApp.Metadata = make(map[string]interface{})
 	cliApp.Metadata["app"] = app
-	cliApp.Metadata["auth"] = auth
-	cliApp.Metadata["oauth"] =
-		firebase.NewOAuthConfig(firebase.GoogleAuthProvider)
+	cliApp.Before = func(c *cli.Context) error {
+		daemon.DefaultRootDir = c.String("runtime-dir")
+		// Only commands which read credentials open the user cache.
+		cliApp.Metadata["new_auth"] = cmd.NewAuthFunc(func() (*firebase.Auth, error) {
+			uc, err := newUserCache(c, app.ProjectID)
+			if err != nil {
+				return nil, err
+			}
+			return app.NewAuth(firebase.WithUserCache(uc),
+				firebase.WithProfile(cmd.CurrentProfile())), nil
+		})
+		return nil
+	}
 	cliApp.Commands = cmd.Commands
 	err := cliApp.Run(os.Args)
 	if err != nil {
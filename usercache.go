@@ -2,12 +2,17 @@ package main
 
 import (
 	"encoding/json"
+	"sort"
 
 	"github.com/zalando/go-keyring"
 
 	"github.com/Coderlane/minecraft-sidecart/firebase"
 )
 
+// userIndexKey holds the names of every cached user, since the keyring can
+// not be listed.
+const userIndexKey = ".users"
+
 // LocalUserCache implements the UserCache interface by caching users
 // in the local keychain.
 type LocalUserCache struct {
@@ -46,10 +51,50 @@ func (luc *LocalUserCache) Set(userID string, user *firebase.User) error {
 	if err != nil {
 		panic(err)
 	}
-	return keyring.Set(luc.projectID, userID, string(data))
+	if err = keyring.Set(luc.projectID, userID, string(data)); err != nil {
+		return err
+	}
+	return luc.updateIndex(userID, true)
 }
 
 // Delete removes a user from the user cache.
 func (luc *LocalUserCache) Delete(userID string) {
 	keyring.Delete(luc.projectID, userID)
+	luc.updateIndex(userID, false)
+}
+
+// List returns the names of every cached user.
+func (luc *LocalUserCache) List() ([]string, error) {
+	data, err := keyring.Get(luc.projectID, userIndexKey)
+	if err != nil {
+		if err == keyring.ErrNotFound {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+	var names []string
+	if err = json.Unmarshal([]byte(data), &names); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// updateIndex adds or removes userID from the index of cached users.
+func (luc *LocalUserCache) updateIndex(userID string, add bool) error {
+	names, _ := luc.List()
+	updated := make([]string, 0, len(names)+1)
+	for _, name := range names {
+		if name != userID {
+			updated = append(updated, name)
+		}
+	}
+	if add {
+		updated = append(updated, userID)
+	}
+	sort.Strings(updated)
+	data, err := json.Marshal(updated)
+	if err != nil {
+		return err
+	}
+	return keyring.Set(luc.projectID, userIndexKey, string(data))
 }
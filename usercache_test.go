@@ -72,3 +72,36 @@ func TestUserCacheGetCorruptRecovers(t *testing.T) {
 		t.Errorf("Expected nil error getting unknown user: %v", err)
 	}
 }
+
+func TestUserCacheList(t *testing.T) {
+	keyring.MockInit()
+	defer func() {
+		keyring.Delete(testProjectID, testUserID)
+		keyring.Delete(testProjectID, "team")
+		keyring.Delete(testProjectID, userIndexKey)
+	}()
+
+	luc := NewLocalUserCache(testProjectID)
+	names, err := luc.List()
+	if err != nil || len(names) != 0 {
+		t.Errorf("Expected no users: %v %v\n", names, err)
+	}
+	for _, name := range []string{testUserID, "team", testUserID} {
+		if err = luc.Set(name, &firebase.User{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names, err = luc.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{"team", testUserID}) {
+		t.Errorf("Unexpected users: %v\n", names)
+	}
+
+	luc.Delete("team")
+	names, _ = luc.List()
+	if !reflect.DeepEqual(names, []string{testUserID}) {
+		t.Errorf("Unexpected users: %v\n", names)
+	}
+}